@@ -0,0 +1,285 @@
+package cast
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Namespaces of the messages
+const (
+	namespaceConnection = "urn:x-cast:com.google.cast.tp.connection"
+	namespaceHeartbeat  = "urn:x-cast:com.google.cast.tp.heartbeat"
+	namespaceReceiver   = "urn:x-cast:com.google.cast.receiver"
+	namespaceMedia      = "urn:x-cast:com.google.cast.media"
+)
+
+const (
+	senderID   = "sender-0"
+	receiverID = "receiver-0" // the platform of the device, which launches the applications
+
+	dialTimeout       = 10 * time.Second
+	requestTimeout    = 10 * time.Second
+	heartbeatInterval = 5 * time.Second
+	maxMessageSize    = 64 << 10
+)
+
+// message is a message of the channel, with its JSON payload.
+type message struct {
+	source      string
+	destination string
+	namespace   string
+	payload     []byte
+}
+
+// header is the part of the payloads every message has.
+type header struct {
+	Type      string `json:"type"`
+	RequestID int    `json:"requestId,omitempty"`
+}
+
+// Fields of CastMessage, the protobuf message framing every message
+const (
+	fieldProtocolVersion = 1
+	fieldSourceID        = 2
+	fieldDestinationID   = 3
+	fieldNamespace       = 4
+	fieldPayloadType     = 5
+	fieldPayloadUTF8     = 6
+)
+
+// marshal encodes the message as a CastMessage, CASTV2_1_0 with a string payload.
+func (m message) marshal() []byte {
+	var b []byte
+	b = protowire(b, fieldProtocolVersion, 0)
+	b = protobytes(b, fieldSourceID, []byte(m.source))
+	b = protobytes(b, fieldDestinationID, []byte(m.destination))
+	b = protobytes(b, fieldNamespace, []byte(m.namespace))
+	b = protowire(b, fieldPayloadType, 0)
+	return protobytes(b, fieldPayloadUTF8, m.payload)
+}
+
+func protowire(b []byte, field int, value uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3))
+	return binary.AppendUvarint(b, value)
+}
+
+func protobytes(b []byte, field int, value []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|2))
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// unmarshal decodes a CastMessage, binary payloads are ignored.
+func unmarshal(b []byte) (message, error) {
+	var m message
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return m, errors.New("invalid cast message")
+		}
+		b = b[n:]
+		switch key & 7 {
+		case 0: // varint
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return m, errors.New("invalid cast message")
+			}
+			b = b[n:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return m, errors.New("invalid cast message")
+			}
+			value := b[n : n+int(length)]
+			b = b[n+int(length):]
+			switch key >> 3 {
+			case fieldSourceID:
+				m.source = string(value)
+			case fieldDestinationID:
+				m.destination = string(value)
+			case fieldNamespace:
+				m.namespace = string(value)
+			case fieldPayloadUTF8:
+				m.payload = value
+			}
+		default:
+			return m, fmt.Errorf("unexpected wire type %d in cast message", key&7)
+		}
+	}
+	return m, nil
+}
+
+// channel is a connection to a device.
+type channel struct {
+	conn      net.Conn
+	writeMu   sync.Mutex
+	requestID atomic.Int64
+	mu        sync.Mutex
+	pending   map[int]chan message // answers awaited, by request ID
+	events    chan message         // messages which answer no request, e.g. the media status of the playback
+	closed    chan struct{}
+	err       error // why the channel closed, set before closed is closed
+}
+
+// dial connects to the device at {addr}, and keeps the connection alive until it is closed.
+func dial(ctx context.Context, addr string) (*channel, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: dialTimeout},
+		// The devices have self-signed certificates
+		Config: &tls.Config{InsecureSkipVerify: true},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &channel{
+		conn:    conn,
+		pending: map[int]chan message{},
+		events:  make(chan message, 16),
+		closed:  make(chan struct{}),
+	}
+	go c.read()
+	go c.heartbeat()
+	if err := c.connect(receiverID); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// close closes the connection, after closing the virtual connections to the device.
+func (c *channel) close() {
+	_ = c.send(namespaceConnection, receiverID, header{Type: "CLOSE"})
+	_ = c.conn.Close()
+	<-c.closed
+}
+
+// connect opens a virtual connection to {destination}, the platform or an application, before messaging it.
+func (c *channel) connect(destination string) error {
+	return c.send(namespaceConnection, destination, header{Type: "CONNECT"})
+}
+
+// send sends a payload without awaiting an answer.
+func (c *channel) send(namespace, destination string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	frame := message{source: senderID, destination: destination, namespace: namespace, payload: data}.marshal()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(requestTimeout))
+	if err := binary.Write(c.conn, binary.BigEndian, uint32(len(frame))); err != nil {
+		return err
+	}
+	_, err = c.conn.Write(frame)
+	return err
+}
+
+// request sends a payload with a request ID, and returns the answer to it.
+func (c *channel) request(namespace, destination string, payload map[string]any) (message, error) {
+	id := int(c.requestID.Add(1))
+	payload["requestId"] = id
+	answer := make(chan message, 1)
+	c.mu.Lock()
+	c.pending[id] = answer
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+	if err := c.send(namespace, destination, payload); err != nil {
+		return message{}, err
+	}
+	timeout := time.NewTimer(requestTimeout)
+	defer timeout.Stop()
+	select {
+	case m := <-answer:
+		return m, nil
+	case <-c.closed:
+		return message{}, c.err
+	case <-timeout.C:
+		return message{}, fmt.Errorf("no answer from the device to %s", namespace)
+	}
+}
+
+// read reads the messages until the connection closes, and dispatches them.
+func (c *channel) read() {
+	defer close(c.closed)
+	defer close(c.events)
+	for {
+		var size uint32
+		if err := binary.Read(c.conn, binary.BigEndian, &size); err != nil {
+			c.err = fmt.Errorf("connection to the device lost: %w", err)
+			return
+		}
+		if size > maxMessageSize {
+			c.err = fmt.Errorf("cast message too large: %d bytes", size)
+			_ = c.conn.Close()
+			return
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(c.conn, frame); err != nil {
+			c.err = fmt.Errorf("connection to the device lost: %w", err)
+			return
+		}
+		m, err := unmarshal(frame)
+		if err != nil {
+			logrus.Debugln("Cast:", err)
+			continue
+		}
+		var h header
+		if err := json.Unmarshal(m.payload, &h); err != nil {
+			logrus.Debugln("Cast:", err)
+			continue
+		}
+		if m.namespace == namespaceHeartbeat {
+			if h.Type == "PING" {
+				_ = c.send(namespaceHeartbeat, m.source, header{Type: "PONG"})
+			}
+			continue
+		}
+		c.mu.Lock()
+		answer := c.pending[h.RequestID]
+		c.mu.Unlock()
+		if h.RequestID != 0 && answer != nil {
+			select {
+			case answer <- m:
+			default: // answered already
+			}
+			continue
+		}
+		select {
+		case c.events <- m:
+		default:
+			logrus.Debugln("Cast: message dropped:", h.Type)
+		}
+	}
+}
+
+// heartbeat pings the device until the connection closes, the device closes the connections which do not.
+func (c *channel) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			if err := c.send(namespaceHeartbeat, receiverID, header{Type: "PING"}); err != nil {
+				logrus.Debugln("Cast:", err)
+			}
+		}
+	}
+}
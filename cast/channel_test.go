@@ -0,0 +1,255 @@
+package cast
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := message{
+		source:      senderID,
+		destination: receiverID,
+		namespace:   namespaceReceiver,
+		payload:     []byte(`{"type":"LAUNCH","appId":"CC1AD845","requestId":1}`),
+	}
+	got, err := unmarshal(m.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("unmarshal(marshal(m)) = %+v, want %+v", got, m)
+	}
+
+	// A payload longer than 127 bytes has a length of two varint bytes
+	m.payload = []byte(`{"type":"MEDIA_STATUS","status":[{"playerState":"PLAYING","idleReason":"","currentTime":` +
+		`1234.5,"media":{"duration":5400}}],"padding":"xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"}`)
+	if got, err = unmarshal(m.marshal()); err != nil || !reflect.DeepEqual(got, m) {
+		t.Errorf("unmarshal(marshal(m)) = %+v, %v, want %+v", got, err, m)
+	}
+
+	frame := m.marshal()
+	if _, err := unmarshal(frame[:len(frame)-1]); err == nil {
+		t.Error("unmarshal of a truncated message succeeded")
+	}
+}
+
+func TestChannelSplitRead(t *testing.T) {
+	conn, device := net.Pipe()
+	defer device.Close()
+	c := &channel{
+		conn:    conn,
+		pending: map[int]chan message{},
+		events:  make(chan message, 16),
+		closed:  make(chan struct{}),
+	}
+	go c.read()
+
+	m := message{source: fakeTransportID, destination: senderID, namespace: namespaceMedia, payload: []byte(`{"type":"MEDIA_STATUS","status":[]}`)}
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(m.marshal())))
+	frame = append(frame, m.marshal()...)
+	// The size and the message are both split across writes, as TCP may deliver them
+	for _, part := range [][]byte{frame[:2], frame[2:7], frame[7:20], frame[20:]} {
+		if _, err := device.Write(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case got := <-c.events:
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("event = %+v, want %+v", got, m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message read")
+	}
+
+	_ = device.Close()
+	select {
+	case <-c.closed:
+		if c.err == nil {
+			t.Error("channel closed without an error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("channel not closed with the connection")
+	}
+}
+
+// fakeDevice is a Cast v2 device running the Default Media Receiver.
+type fakeDevice struct {
+	listener net.Listener
+	received chan message // every message the device received
+}
+
+const (
+	fakeSessionID   = "session-1"
+	fakeTransportID = "transport-1"
+)
+
+func newFakeDevice(t *testing.T) *fakeDevice {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Fake Chromecast"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	device := &fakeDevice{listener: listener, received: make(chan message, 64)}
+	go device.serve()
+	return device
+}
+
+func (device *fakeDevice) serve() {
+	conn, err := device.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for {
+		var size uint32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(conn, frame); err != nil {
+			return
+		}
+		m, err := unmarshal(frame)
+		if err != nil {
+			return
+		}
+		device.received <- m
+		var request map[string]any
+		if err := json.Unmarshal(m.payload, &request); err != nil {
+			return
+		}
+		requestID, _ := request["requestId"].(float64)
+		switch request["type"] {
+		case "LAUNCH", "STOP":
+			device.send(conn, m.destination, namespaceReceiver, receiverStatusPayload(int(requestID)))
+		case "LOAD":
+			device.send(conn, m.destination, namespaceMedia, mediaStatusPayload(int(requestID), "BUFFERING", "", 0))
+			// The device tells the changes of the playback on its own
+			device.send(conn, m.destination, namespaceMedia, mediaStatusPayload(0, "PLAYING", "", 30))
+			device.send(conn, m.destination, namespaceMedia, mediaStatusPayload(0, "IDLE", "FINISHED", 0))
+		case "GET_STATUS":
+			device.send(conn, m.destination, namespaceMedia, mediaStatusPayload(int(requestID), "PLAYING", "", 30))
+		}
+	}
+}
+
+func (device *fakeDevice) send(conn net.Conn, source, namespace string, payload any) {
+	data, _ := json.Marshal(payload)
+	frame := message{source: source, destination: senderID, namespace: namespace, payload: data}.marshal()
+	_ = binary.Write(conn, binary.BigEndian, uint32(len(frame)))
+	_, _ = conn.Write(frame)
+}
+
+func receiverStatusPayload(requestID int) map[string]any {
+	return map[string]any{
+		"type": "RECEIVER_STATUS", "requestId": requestID,
+		"status": map[string]any{"applications": []map[string]any{{
+			"appId": defaultMediaReceiver, "sessionId": fakeSessionID, "transportId": fakeTransportID,
+		}}},
+	}
+}
+
+func mediaStatusPayload(requestID int, state, idleReason string, currentTime float64) map[string]any {
+	return map[string]any{
+		"type": "MEDIA_STATUS", "requestId": requestID,
+		"status": []map[string]any{{
+			"mediaSessionId": 1, "playerState": state, "idleReason": idleReason,
+			"currentTime": currentTime, "media": map[string]any{"duration": 100},
+		}},
+	}
+}
+
+func TestCast(t *testing.T) {
+	device := newFakeDevice(t)
+	d := &Device{Name: "Fake Chromecast", Addr: device.listener.Addr().String()}
+
+	var statuses []Status
+	err := d.Cast(Media{
+		URL:      "http://localhost:8080/files/1/movie.mkv",
+		Title:    "Movie",
+		Start:    30 * time.Second,
+		OnStatus: func(status Status) { statuses = append(statuses, status) },
+	}, nil)
+	if err != nil {
+		t.Fatalf("Cast: %v", err)
+	}
+
+	var got []string
+	var load map[string]any
+	// The device may still be reading the last messages
+	timeout := time.After(2 * time.Second)
+	for len(got) == 0 || got[len(got)-1] != receiverID+" CLOSE" {
+		var m message
+		select {
+		case m = <-device.received:
+		case <-timeout:
+			t.Fatalf("device received %q, and no CLOSE", got)
+		}
+		var h header
+		_ = json.Unmarshal(m.payload, &h)
+		if m.namespace == namespaceHeartbeat {
+			continue
+		}
+		got = append(got, m.destination+" "+h.Type)
+		if h.Type == "LOAD" {
+			_ = json.Unmarshal(m.payload, &load)
+		}
+	}
+	want := []string{
+		receiverID + " CONNECT",
+		receiverID + " LAUNCH",
+		fakeTransportID + " CONNECT",
+		fakeTransportID + " LOAD",
+		receiverID + " STOP",
+		receiverID + " CLOSE",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("device received %q, want %q", got, want)
+	}
+
+	if load == nil {
+		t.Fatal("no LOAD received")
+	}
+	media, _ := load["media"].(map[string]any)
+	if media["contentId"] != "http://127.0.0.1:8080/files/1/movie.mkv" || media["contentType"] != "video/mp4" {
+		t.Errorf("LOAD media = %v, want the stream on the address of this machine as video/mp4", media)
+	}
+	if load["sessionId"] != fakeSessionID || load["currentTime"] != 30.0 {
+		t.Errorf("LOAD = %v, want session %s at 30s", load, fakeSessionID)
+	}
+
+	wantStatus := Status{State: "PLAYING", Position: 30 * time.Second, Duration: 100 * time.Second}
+	if len(statuses) == 0 || statuses[0] != wantStatus {
+		t.Errorf("statuses = %+v, want %+v first", statuses, wantStatus)
+	}
+}
@@ -0,0 +1,253 @@
+package cast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMediaReceiver is the application ID of the Default Media Receiver, which plays a URL.
+const defaultMediaReceiver = "CC1AD845"
+
+// Following a cast
+const (
+	pollInterval = 2 * time.Second // the status of the playback is asked for, the device only sends it on changes
+	startTimeout = time.Minute     // for the device to start playing
+)
+
+// application is a receiver application running on a device.
+type application struct {
+	AppID       string `json:"appId"`
+	SessionID   string `json:"sessionId"`
+	TransportID string `json:"transportId"` // destination of the messages to the application
+}
+
+type receiverStatus struct {
+	header
+	Status struct {
+		Applications []application `json:"applications"`
+	} `json:"status"`
+}
+
+type mediaStatus struct {
+	header
+	Status []struct {
+		MediaSessionID int     `json:"mediaSessionId"`
+		PlayerState    string  `json:"playerState"`
+		IdleReason     string  `json:"idleReason"`
+		CurrentTime    float64 `json:"currentTime"`
+		Media          *struct {
+			Duration float64 `json:"duration"`
+		} `json:"media"`
+	} `json:"status"`
+}
+
+// launch launches the Default Media Receiver on the device, and returns it once it runs.
+func (c *channel) launch() (application, error) {
+	m, err := c.request(namespaceReceiver, receiverID, map[string]any{"type": "LAUNCH", "appId": defaultMediaReceiver})
+	if err != nil {
+		return application{}, err
+	}
+	var status receiverStatus
+	if err := json.Unmarshal(m.payload, &status); err != nil {
+		return application{}, err
+	}
+	if status.Type != "RECEIVER_STATUS" {
+		return application{}, fmt.Errorf("the device did not launch the media receiver: %s", status.Type)
+	}
+	for _, app := range status.Status.Applications {
+		if app.AppID == defaultMediaReceiver {
+			return app, nil
+		}
+	}
+	return application{}, errors.New("the device did not launch the media receiver")
+}
+
+// Cast plays the media on the device and returns once the device stopped playing it,
+// or once {stop} is closed: the media receiver is closed then.
+func (d *Device) Cast(m Media, stop <-chan struct{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	c, err := dial(ctx, d.Addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", d.Name, err)
+	}
+	defer c.close()
+	app, err := c.launch()
+	if err != nil {
+		return fmt.Errorf("%s: %w", d.Name, err)
+	}
+	if err := c.connect(app.TransportID); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := c.request(namespaceReceiver, receiverID, map[string]any{"type": "STOP", "sessionId": app.SessionID}); err != nil {
+			logrus.Debugln("Cast:", err)
+		}
+	}()
+
+	// The address of this machine on the network of the device
+	ip := c.conn.LocalAddr().(*net.TCPAddr).IP
+	mediaURL := localURL(m.URL, ip)
+	media := map[string]any{
+		"contentId":   mediaURL,
+		"contentType": m.ContentType,
+		"streamType":  "BUFFERED",
+		"metadata":    map[string]any{"metadataType": 0, "title": m.Title},
+	}
+	if m.ContentType == "" {
+		media["contentType"] = contentType(mediaURL)
+	}
+	load := map[string]any{"type": "LOAD", "sessionId": app.SessionID, "media": media, "autoplay": true}
+	if m.Start > 0 {
+		load["currentTime"] = m.Start.Seconds()
+	}
+	if m.SubtitlePath != "" {
+		subtitleURL, closeSubtitles, err := serveSubtitles(m.SubtitlePath, ip)
+		if err != nil {
+			logrus.Warnln("The subtitles are not sent to the device:", err)
+		} else {
+			defer closeSubtitles()
+			media["tracks"] = []map[string]any{{
+				"trackId": 1, "type": "TEXT", "subtype": "SUBTITLES", "name": "Subtitles",
+				"trackContentId": subtitleURL, "trackContentType": "text/vtt",
+			}}
+			load["activeTrackIds"] = []int{1}
+		}
+	}
+	logrus.Debugf("Cast: casting %s to %s", mediaURL, d.Name)
+	answer, err := c.request(namespaceMedia, app.TransportID, load)
+	if err != nil {
+		return fmt.Errorf("%s: %w", d.Name, err)
+	}
+	status, err := parseMediaStatus(answer)
+	if err != nil {
+		return fmt.Errorf("%s: %w", d.Name, err)
+	}
+	if len(status.Status) == 0 {
+		return fmt.Errorf("%s did not load the stream", d.Name)
+	}
+	return c.follow(app, status.Status[0].MediaSessionID, m, stop)
+}
+
+// parseMediaStatus returns the media status of a message, or why the media could not be loaded.
+func parseMediaStatus(m message) (mediaStatus, error) {
+	var status mediaStatus
+	if err := json.Unmarshal(m.payload, &status); err != nil {
+		return status, err
+	}
+	switch status.Type {
+	case "MEDIA_STATUS":
+		return status, nil
+	case "LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST":
+		return status, errors.New("the device did not play the stream, it may not support its format")
+	default:
+		return status, fmt.Errorf("unexpected answer: %s", status.Type)
+	}
+}
+
+// follow follows the playback of the media session until it ended, or until {stop} is closed.
+func (c *channel) follow(app application, sessionID int, m Media, stop <-chan struct{}) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	sought := m.Start > 0 || m.StartPercent <= 0
+	playing := false
+	started := time.Now()
+	for {
+		if !playing && time.Since(started) > startTimeout {
+			return errors.New("the device did not play the stream, it may not support its format")
+		}
+		var status mediaStatus
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			answer, err := c.request(namespaceMedia, app.TransportID, map[string]any{"type": "GET_STATUS", "mediaSessionId": sessionID})
+			if err != nil {
+				return err
+			}
+			if status, err = parseMediaStatus(answer); err != nil {
+				logrus.Debugln("Cast:", err)
+				continue
+			}
+		case event, ok := <-c.events:
+			if !ok {
+				return c.err
+			}
+			if ended(event, app) {
+				return nil
+			}
+			if event.namespace != namespaceMedia {
+				continue
+			}
+			var err error
+			if status, err = parseMediaStatus(event); err != nil {
+				logrus.Debugln("Cast:", err)
+				continue
+			}
+		}
+
+		if len(status.Status) == 0 {
+			// The media session ended
+			if playing {
+				return nil
+			}
+			continue
+		}
+		s := status.Status[0]
+		duration := time.Duration(0)
+		if s.Media != nil {
+			duration = time.Duration(s.Media.Duration * float64(time.Second))
+		}
+		switch s.PlayerState {
+		case "IDLE":
+			switch s.IdleReason {
+			case "FINISHED", "CANCELLED", "INTERRUPTED":
+				return nil
+			case "ERROR":
+				return errors.New("the device could not play the stream, it may not support its format")
+			}
+		case "PLAYING", "PAUSED":
+			playing = true
+			if !sought && duration > 0 {
+				sought = true
+				position := time.Duration(m.StartPercent / 100 * float64(duration))
+				if _, err := c.request(namespaceMedia, app.TransportID, map[string]any{
+					"type": "SEEK", "mediaSessionId": s.MediaSessionID, "currentTime": position.Seconds(),
+				}); err != nil {
+					logrus.Warnln("Error seeking to the start position:", err)
+				}
+				continue
+			}
+		}
+		if m.OnStatus != nil {
+			m.OnStatus(Status{State: s.PlayerState, Position: time.Duration(s.CurrentTime * float64(time.Second)), Duration: duration})
+		}
+	}
+}
+
+// ended reports whether a message tells the media receiver closed, e.g. when another sender launched an application.
+func ended(m message, app application) bool {
+	switch m.namespace {
+	case namespaceConnection:
+		var h header
+		return json.Unmarshal(m.payload, &h) == nil && h.Type == "CLOSE" && m.source == app.TransportID
+	case namespaceReceiver:
+		var status receiverStatus
+		if json.Unmarshal(m.payload, &status) != nil || status.Type != "RECEIVER_STATUS" {
+			return false
+		}
+		for _, running := range status.Status.Applications {
+			if running.SessionID == app.SessionID {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+/*
+Package cast plays the streams on the Chromecasts of the local network, and on the other Google Cast devices.
+The devices are found with mDNS (see `Discover`), and controlled with the Cast v2 protocol: JSON messages in
+protobuf frames over TLS. The Default Media Receiver is launched on a device, then loads the stream with its
+subtitles; the media status it sends back tells the playback position, and when the playback ended.
+*/
+package cast
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// MDNSAddr is where the mDNS queries are sent, the multicast address of mDNS.
+var MDNSAddr = "224.0.0.251:5353"
+
+// service is the mDNS service of the Cast devices.
+const service = "_googlecast._tcp.local."
+
+// Device is a Cast device.
+type Device struct {
+	Name  string // friendly name of the device
+	ID    string
+	Model string // e.g. Chromecast, Google Cast Group
+	Addr  string // host:port of the Cast v2 service
+}
+
+func (d *Device) String() string {
+	return d.Name
+}
+
+// instance is what the answers of the devices tell about a service instance.
+type instance struct {
+	target string // host name
+	port   uint16
+	txt    map[string]string
+	from   net.IP // of the device which answered the SRV record, when no A record gives the address of the host
+}
+
+// Discover queries the Cast devices of the network for {timeout}, and returns them by name.
+func Discover(timeout time.Duration) ([]*Device, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	addr, err := net.ResolveUDPAddr("udp4", MDNSAddr)
+	if err != nil {
+		return nil, err
+	}
+	name, err := dnsmessage.NewName(service)
+	if err != nil {
+		return nil, err
+	}
+	// Sent from another port than 5353, the devices answer to it directly (legacy unicast)
+	query := dnsmessage.Message{Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}}}
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	// UDP may lose a query, it is sent twice
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteTo(packet, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	instances := map[string]*instance{}
+	hosts := map[string]net.IP{}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		var m dnsmessage.Message
+		if err := m.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		get := func(name string) *instance {
+			if instances[name] == nil {
+				instances[name] = &instance{txt: map[string]string{}}
+			}
+			return instances[name]
+		}
+		for _, rr := range append(m.Answers, m.Additionals...) {
+			switch body := rr.Body.(type) {
+			case *dnsmessage.PTRResource:
+				if strings.EqualFold(rr.Header.Name.String(), service) {
+					get(body.PTR.String())
+				}
+			case *dnsmessage.SRVResource:
+				i := get(rr.Header.Name.String())
+				i.target, i.port = body.Target.String(), body.Port
+				if udp, ok := from.(*net.UDPAddr); ok {
+					i.from = udp.IP
+				}
+			case *dnsmessage.TXTResource:
+				i := get(rr.Header.Name.String())
+				for _, txt := range body.TXT {
+					if key, value, ok := strings.Cut(txt, "="); ok {
+						i.txt[key] = value
+					}
+				}
+			case *dnsmessage.AResource:
+				hosts[rr.Header.Name.String()] = net.IP(body.A[:])
+			}
+		}
+	}
+	return devices(instances, hosts), nil
+}
+
+// devices returns the devices of the instances answered with their address, sorted by name, once each.
+func devices(instances map[string]*instance, hosts map[string]net.IP) []*Device {
+	seen := map[string]bool{}
+	var found []*Device
+	for name, i := range instances {
+		ip := hosts[i.target]
+		if ip == nil {
+			ip = i.from
+		}
+		if !strings.HasSuffix(strings.ToLower(name), service) || ip == nil || i.port == 0 {
+			continue
+		}
+		d := &Device{
+			Name:  i.txt["fn"],
+			ID:    i.txt["id"],
+			Model: i.txt["md"],
+			Addr:  net.JoinHostPort(ip.String(), strconv.Itoa(int(i.port))),
+		}
+		if d.Name == "" {
+			d.Name = strings.TrimSuffix(name, "."+service)
+		}
+		if d.ID == "" {
+			d.ID = d.Addr
+		}
+		if !seen[d.ID] {
+			seen[d.ID] = true
+			found = append(found, d)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return strings.ToLower(found[i].Name) < strings.ToLower(found[j].Name)
+	})
+	return found
+}
@@ -0,0 +1,114 @@
+package cast
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Media is a stream played on a device.
+type Media struct {
+	URL         string
+	ContentType string // from the extension of the URL when empty
+	Title       string
+	// SubtitlePath is a .srt or .vtt file, served to the device as WebVTT while it plays
+	SubtitlePath string
+	// Where the playback starts: Start, or StartPercent of the duration when Start is 0
+	Start        time.Duration
+	StartPercent float64
+	// OnStatus is called with the status of the playback while the device plays, if not nil
+	OnStatus func(status Status)
+}
+
+// Status is the status of a playback.
+type Status struct {
+	State    string // PLAYING, PAUSED, BUFFERING or IDLE
+	Position time.Duration
+	Duration time.Duration // 0 when the device does not know
+}
+
+// Playable reports whether the Default Media Receiver plays a file of the format and the codecs, as named by ffprobe,
+// which the Chromecasts play all: other files have to be transcoded.
+func Playable(format, video, audio string) bool {
+	formats := map[string]bool{"mov,mp4,m4a,3gp,3g2,mj2": true, "matroska,webm": true, "mp3": true, "ogg": true, "flac": true, "wav": true, "hls": true}
+	videos := map[string]bool{"": true, "h264": true, "vp8": true, "vp9": true}
+	audios := map[string]bool{"": true, "aac": true, "mp3": true, "opus": true, "vorbis": true, "flac": true}
+	return formats[format] && videos[video] && audios[audio]
+}
+
+// contentType returns the MIME type of a stream from its extension, video/mp4 when unknown.
+func contentType(name string) string {
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".m3u8":
+		return "application/x-mpegurl"
+	case ".mkv":
+		// The receiver plays the Matroska files of the codecs it supports, given as MP4
+		return "video/mp4"
+	default:
+		if contentType := mime.TypeByExtension(ext); contentType != "" {
+			contentType, _, _ = strings.Cut(contentType, ";")
+			return contentType
+		}
+	}
+	return "video/mp4"
+}
+
+// localURL returns {rawURL} reachable from the network when it is served on the loopback: with the address {ip} instead.
+func localURL(rawURL string, ip net.IP) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || ip == nil {
+		return rawURL
+	}
+	host := u.Hostname()
+	if host == "" || host == "localhost" || net.ParseIP(host).IsLoopback() || net.ParseIP(host).IsUnspecified() {
+		u.Host = net.JoinHostPort(ip.String(), u.Port())
+	}
+	return u.String()
+}
+
+var srtTimestamp = regexp.MustCompile(`(\d{2}:\d{2}:\d{2}),(\d{3})`)
+
+// webVTT returns the subtitles of the .srt or .vtt file at {subtitlePath} as WebVTT, the only format of the receiver.
+func webVTT(subtitlePath string) ([]byte, error) {
+	data, err := os.ReadFile(subtitlePath)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	if bytes.HasPrefix(data, []byte("WEBVTT")) {
+		return data, nil
+	}
+	return append([]byte("WEBVTT\n\n"), srtTimestamp.ReplaceAll(data, []byte("$1.$2"))...), nil
+}
+
+// serveSubtitles serves the subtitles at {subtitlePath} as WebVTT on {ip} until it is closed, and returns their URL.
+func serveSubtitles(subtitlePath string, ip net.IP) (string, func(), error) {
+	vtt, err := webVTT(subtitlePath)
+	if err != nil {
+		return "", nil, err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return "", nil, err
+	}
+	modified := time.Now()
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The receiver is a web page, which loads the subtitles with CORS
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "text/vtt")
+		http.ServeContent(w, r, "subtitles.vtt", modified, bytes.NewReader(vtt))
+	})}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return fmt.Sprintf("http://%s/subtitles.vtt", listener.Addr()), func() { _ = server.Close() }, nil
+}
@@ -6,17 +6,19 @@ package client
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -27,6 +29,8 @@ import (
 
 	"github.com/stl3/torgo/config"
 	"github.com/stl3/torgo/models"
+	"github.com/stl3/torgo/ratelimit"
+	"github.com/stl3/torgo/transcode"
 )
 
 // Client manages the torrent downloading.
@@ -42,6 +46,25 @@ type Client struct {
 	downloadComplete chan struct{}
 	downloadStarted  bool
 	LargestFile      *torrent.File
+	// ChooseFile picks the file to stream when several files are big enough to be the video.
+	// When nil, the user is prompted to choose one.
+	ChooseFile func(files []*torrent.File) *torrent.File
+	// Seeding is how the torrent is uploaded, see `Client.StartSeeding`
+	Seeding SeedPolicy
+	// Limiter sets the rate limits of the client, they can be changed while streaming
+	Limiter *ratelimit.Limiter
+	// Transcoder converts the files for the devices which cannot play them, see `Client.TranscodeURL`
+	Transcoder *transcode.Transcoder
+	server     *http.Server
+	reads      readStats
+	files      openFiles
+	prio       prioritizer
+}
+
+// readStats counts what the player read from the stream.
+type readStats struct {
+	served   atomic.Int64 // bytes of the file sent to the player
+	position atomic.Int64 // offset in the file where the last read ended
 }
 
 var u, _ = user.Current()
@@ -86,14 +109,23 @@ func NewClient(dataDir string, torrentPort int, hostPort int) (*Client, error) {
 	clientConfig := torrent.NewDefaultClientConfig()
 	clientConfig.DataDir = dataDir
 	clientConfig.ListenPort = torrentPort
-	clientConfig.NoUpload = true
-	clientConfig.Seed = false
+	// Uploads are allowed per torrent, depending on the seeding policy
+	clientConfig.NoUpload = false
+	clientConfig.Seed = true
 	clientConfig.Debug = false
 	clientConfig.EstablishedConnsPerTorrent = configurations.ECPT
 	clientConfig.HalfOpenConnsPerTorrent = configurations.HOCPT
 	clientConfig.TotalHalfOpenConns = configurations.THOC
 	client.ClientConfig = clientConfig
 
+	limiter, err := ratelimit.FromConfig(configurations)
+	if err != nil {
+		logrus.Warnln("The rate limits are not applied:", err)
+		limiter = ratelimit.New(ratelimit.Limits{}, ratelimit.Limits{}, ratelimit.Schedule{})
+	}
+	limiter.Configure(clientConfig)
+	client.Limiter = limiter
+
 	clientConfig.HTTPProxy = func(req *http.Request) (*url.URL, error) {
 		proxyURL, err := url.Parse(configurations.Proxy)
 		if err != nil {
@@ -109,6 +141,9 @@ func NewClient(dataDir string, torrentPort int, hostPort int) (*Client, error) {
 	}
 	client.Client = c
 	client.HostPort = hostPort
+	go limiter.Run(c.Closed())
+	client.Seeding = ConfiguredSeedPolicy()
+	client.Transcoder = transcode.New(configurations.FFmpeg, filepath.Join(dataDir, transcodeDir))
 
 	// Create channel for signaling download completion
 	client.downloadComplete = make(chan struct{})
@@ -124,6 +159,9 @@ func (client *Client) SetSource(source models.Source) (*Client, error) {
 	t, err := client.Client.AddMagnet(source.Magnet)
 	if err == nil {
 		t.SetDisplayName(source.Title)
+		if !client.Seeding.Upload {
+			t.DisallowDataUpload()
+		}
 		client.Torrent = t
 	}
 	return client, err
@@ -146,6 +184,14 @@ func (client *Client) getLargestFile() *torrent.File {
 		client.LargestFile = largeFiles[0]
 		return largeFiles[0]
 	}
+	// Small torrents, every file is a candidate then
+	if len(largeFiles) == 0 {
+		largeFiles = client.Torrent.Files()
+	}
+	if client.ChooseFile != nil {
+		client.LargestFile = client.ChooseFile(largeFiles)
+		return client.LargestFile
+	}
 
 	// // // If there are multiple files, prompt the user to choose
 	// // for {
@@ -283,18 +329,15 @@ func (client *Client) download() {
 	// Get the largest file before entering the download loop
 	largestFile := client.getLargestFile()
 
-	// Immediately deselect all files except the selected (largest) one
+	// Immediately deselect all files, the pieces of the selected (largest) one are prioritized from the playback
 	for _, file := range t.Files() {
-		if file != largestFile {
-			file.SetPriority(torrent.PiecePriorityNone) // Deselect other files
-		} else {
-			file.SetPriority(torrent.PiecePriorityNormal) // Ensure the selected file is prioritized
-		}
+		file.SetPriority(torrent.PiecePriorityNone)
 	}
 
 	// Start the download for the selected file
-	largestFile.Download()
 	client.LargestFile = largestFile
+	client.play(largestFile)
+	go client.runPrioritizer()
 	client.downloadStarted = true
 
 	// Print the selected file information
@@ -329,8 +372,12 @@ func (client *Client) download() {
 				break
 			}
 
-			// Sleep before checking again
-			time.Sleep(2 * time.Second) // Adjust the interval as needed
+			// Sleep before checking again, unless the client was closed meanwhile
+			select {
+			case <-client.Client.Closed():
+				return
+			case <-time.After(2 * time.Second): // Adjust the interval as needed
+			}
 		}
 	}()
 
@@ -346,15 +393,20 @@ func (client *Client) download() {
 			client.PrintProgress()
 			return // Exit the loop if download is complete
 		}
+		// WaitAll also returns when the client is closed
+		if client.closed() {
+			return
+		}
 		// Sleep for a short duration before checking again
 		time.Sleep(time.Duration(1250) * time.Millisecond) // Convert to duration and sleep
 	}
 }
 
-// deleteUnselectedFiles removes all files in the torrent directory except the selected file.
+// deleteUnselectedFiles removes all files in the torrent directory except the selected file,
+// and the files that were requested from the server.
 func (client *Client) deleteUnselectedFiles(selectedFile *torrent.File) {
 	for _, file := range client.Torrent.Files() {
-		if file != selectedFile {
+		if file != selectedFile && file != client.LargestFile && !client.requested(file) {
 			// Construct the full path to the file to be deleted
 			filePath := filepath.Join(client.ClientConfig.DataDir, file.Path())
 
@@ -370,12 +422,31 @@ func (client *Client) deleteUnselectedFiles(selectedFile *torrent.File) {
 	}
 }
 
+// ErrNoMetadata is returned by `Client.StartWithin` when the metadata of the torrent did not arrive in time.
+var ErrNoMetadata = errors.New("no metadata received")
+
 // Start starts the client by getting the torrent information and allocating the priorities of each piece.
 func (client *Client) Start() {
 	<-client.Torrent.GotInfo() // blocks until it got the info
 	go client.download()       // download file
 }
 
+// StartWithin starts the client as `Client.Start`, unless the torrent information does not arrive within {timeout}:
+// ErrNoMetadata is returned then (or when the client is closed meanwhile) and nothing is downloaded.
+func (client *Client) StartWithin(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-client.Torrent.GotInfo():
+	case <-timer.C:
+		return fmt.Errorf("%w after %s", ErrNoMetadata, timeout)
+	case <-client.Client.Closed():
+		return ErrNoMetadata
+	}
+	go client.download()
+	return nil
+}
+
 // Stop is a new method to stop the client and associated resources
 func (client *Client) Stop() {
 	// Perform cleanup operations here
@@ -384,38 +455,6 @@ func (client *Client) Stop() {
 	client.Client.Close()
 }
 
-func (client *Client) streamHandler(w http.ResponseWriter, r *http.Request) {
-	var file *torrent.File
-	// Wait until client.largestFile has a value
-	for {
-		if client.LargestFile != nil {
-			file = client.LargestFile
-			break
-		}
-
-		// Introduce a short delay before checking again
-		time.Sleep(500 * time.Millisecond)
-	}
-
-	entry, err := NewFileReader(file)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	// w.Header().Set("Content-Disposition", "attachment; filename=\""+file.DisplayPath()+"\"")
-	// http.ServeContent(w, r, file.DisplayPath(), time.Now(), entry)
-
-	// Set the appropriate Content-Type header based on the file type
-	contentType := mime.TypeByExtension(filepath.Ext(file.Path()))
-	if contentType == "" {
-		// Default to application/octet-stream if content type is unknown
-		contentType = "application/octet-stream"
-	}
-	w.Header().Set("Content-Type", contentType)
-
-	http.ServeContent(w, r, file.DisplayPath(), time.Now(), entry)
-}
-
 // Serve serves the torrent via HTTP localhost:{port}.
 func (client *Client) Serve() {
 	p := strconv.Itoa(client.HostPort)
@@ -428,20 +467,26 @@ func (client *Client) Serve() {
 	// Set up HTTP server
 	server := &http.Server{
 		Addr:    ":" + p,
-		Handler: http.HandlerFunc(client.streamHandler),
+		Handler: client.routes(),
 	}
+	client.server = server
 
 	// Start serving in a separate goroutine
 	go func() {
 		// logger.Printf("Serving on http://localhost:%s\n", p)
 		err := server.ListenAndServe()
-		if err != nil && err != http.ErrServerClosed {
+		if err == http.ErrServerClosed {
+			return // closed by `Client.Close`
+		}
+		if err != nil {
 			logger.Printf("Error serving: %v\n", err)
 		}
-		<-client.downloadComplete
-
-		// Stop the client when the download is complete
-		client.Stop()
+		select {
+		case <-client.downloadComplete:
+			// Stop the client when the download is complete
+			client.Stop()
+		case <-client.Client.Closed():
+		}
 	}()
 
 	// Add a brief delay to ensure server setup before returning
@@ -573,12 +618,119 @@ func (client *Client) PrintProgress() {
 	client.lastPrintTime = currentTime
 }
 
-// Close cleans up the connections of the client.
+// BytesServed returns how many bytes of the file were sent to the player so far.
+func (client *Client) BytesServed() int64 {
+	return client.reads.served.Load()
+}
+
+// ReadPosition returns the offset in the file where the last read of the player ended.
+// Players buffer ahead, so the playback is usually a bit behind it.
+func (client *Client) ReadPosition() int64 {
+	return client.reads.position.Load()
+}
+
+// PrioritizeOffset makes the playback of the file played start at {offset}: its pieces are prioritized from there
+// until the player reads the file, so that it does not wait for the beginning of the file.
+// The ends of container files (where their headers are) are prioritized as well.
+func (client *Client) PrioritizeOffset(file *torrent.File, offset int64) {
+	if offset <= 0 || offset >= file.Length() {
+		return
+	}
+	client.prio.mu.Lock()
+	if client.prio.played == file {
+		client.prio.start = offset
+	}
+	client.prio.mu.Unlock()
+	client.prioritize()
+	logrus.Debugf("Prioritized %s to resume at %d", file.DisplayPath(), offset)
+}
+
+// NextFile returns the file following the one streamed in the torrent (in path order), skipping the small files
+// (samples, subtitles...), or nil if it is the last one.
+func (client *Client) NextFile() *torrent.File {
+	if client.LargestFile == nil {
+		return nil
+	}
+	var candidates []*torrent.File
+	for _, file := range client.Torrent.Files() {
+		if file.Length() > 15*1024*1024 || file == client.LargestFile {
+			candidates = append(candidates, file)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].DisplayPath() < candidates[j].DisplayPath()
+	})
+	for i, file := range candidates {
+		if file == client.LargestFile && i+1 < len(candidates) {
+			return candidates[i+1]
+		}
+	}
+	return nil
+}
+
+// SetFile switches the stream to another file of the torrent: it is downloaded instead of the current one,
+// and served to the next requests.
+func (client *Client) SetFile(file *torrent.File) {
+	if previous := client.LargestFile; previous != nil && previous != file {
+		previous.SetPriority(torrent.PiecePriorityNone)
+	}
+	client.LargestFile = file
+	client.play(file)
+	client.reads.position.Store(0)
+	logrus.Debugln("Streaming", file.DisplayPath())
+}
+
+// BufferedFrom returns how many bytes of the file are downloaded in a row from {offset}.
+func (client *Client) BufferedFrom(file *torrent.File, offset int64) int64 {
+	t := client.Torrent
+	info := t.Info()
+	if info == nil || offset < 0 || offset >= file.Length() {
+		return 0
+	}
+	pieceLength := info.PieceLength
+	start := file.Offset() + offset
+	end := start
+	for i := int(start / pieceLength); i < file.EndPieceIndex(); i++ {
+		if !t.PieceState(i).Complete {
+			break
+		}
+		end = int64(i+1) * pieceLength
+	}
+	if end > file.Offset()+file.Length() {
+		end = file.Offset() + file.Length()
+	}
+	return end - start
+}
+
+// Close shuts the HTTP server down and cleans up the connections of the client,
+// so that a new client can be started on the same ports.
 func (client *Client) Close() {
-	client.Torrent.Drop()
+	if client.server != nil {
+		_ = client.server.Close()
+	}
+	// Without torrent when the source could not be set
+	if client.Torrent != nil {
+		// The transcodes are only cached for the seeks of this stream
+		if client.Transcoder != nil {
+			if err := client.Transcoder.Remove(client.Torrent.InfoHash().HexString()); err != nil {
+				logrus.Debugln("Error deleting the transcodes:", err)
+			}
+		}
+		client.Torrent.Drop()
+	}
 	client.Client.Close()
 }
 
+// closed reports whether the torrent client was closed.
+func (client *Client) closed() bool {
+	select {
+	case <-client.Client.Closed():
+		return true
+	default:
+		return false
+	}
+}
+
 // SeekableContent describes an io.ReadSeeker that can be closed as well.
 type SeekableContent interface {
 	io.ReadSeeker
@@ -589,24 +741,44 @@ type SeekableContent interface {
 type FileEntry struct {
 	*torrent.File
 	torrent.Reader
+	stats  *readStats   // counts the reads, when set
+	offset atomic.Int64 // offset in the file of the next read
+	onSeek func()       // called after a seek, when set
 }
 
-// Seek seeks to the correct file position, paying attention to the offset.
+// Read reads from the torrent file.
+func (f *FileEntry) Read(p []byte) (int, error) {
+	n, err := f.Reader.Read(p)
+	pos := f.offset.Add(int64(n))
+	if f.stats != nil {
+		f.stats.served.Add(int64(n))
+		f.stats.position.Store(pos)
+	}
+	return n, err
+}
+
+// Seek seeks in the torrent file, offsets are relative to the beginning of the file.
 func (f *FileEntry) Seek(offset int64, whence int) (int64, error) {
-	return f.Reader.Seek(offset+f.File.Offset(), whence)
+	pos, err := f.Reader.Seek(offset, whence)
+	if err == nil {
+		f.offset.Store(pos)
+		if f.onSeek != nil {
+			f.onSeek()
+		}
+	}
+	return pos, err
 }
 
 // NewFileReader sets up a torrent file for streaming reading.
 func NewFileReader(f *torrent.File) (SeekableContent, error) {
-	t := f.Torrent()
-	reader := t.NewReader()
+	// The reader of the file only covers the file, so that its end (and size) is the end of the file
+	reader := f.NewReader()
 
-	// We read ahead 1% of the file continuously.
-	reader.SetReadahead(f.Length() / 100)
+	// We read ahead 1% of the file continuously, within bounds
+	reader.SetReadahead(readahead(f))
 	reader.SetResponsive()
-	_, err := reader.Seek(f.Offset(), io.SeekStart)
 
-	return &FileEntry{File: f, Reader: reader}, err
+	return &FileEntry{File: f, Reader: reader}, nil
 }
 
 func init() {
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Streaming windows of the prioritizer
+const (
+	nextPieces = 2 // pieces after a playhead downloaded right after its piece
+	// The readahead window is 1% of the file, within these bounds
+	minReadahead = 8 << 20
+	maxReadahead = 64 << 20
+	preloadBytes = 2 << 20 // start and end of the container files, downloaded before the player starts
+)
+
+// prioritizeInterval is how often the priorities follow the readers, besides their seeks.
+const prioritizeInterval = time.Second
+
+// containers are the extensions of the files whose headers or index may be at their end (e.g. the moov atom of MP4),
+// players read both ends before starting.
+var containers = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".webm": true, ".avi": true,
+	".m4a": true, ".m4b": true, ".wmv": true, ".flv": true,
+}
+
+// prioritizer sets the priorities of the pieces of the files streamed, around their playheads (the offsets of their readers):
+// the piece of a playhead is needed now, the next ones right after, then the readahead window.
+// The file played is downloaded from its first playhead on, the pieces behind it are not wanted anymore,
+// and both ends of container files are preloaded.
+type prioritizer struct {
+	mu      sync.Mutex
+	played  *torrent.File // file played, nil until it is chosen
+	start   int64         // offset the playback of the file played starts at, a playhead besides the readers
+	readers map[*FileEntry]bool
+	set     map[int]types.PiecePriority // priorities set, by piece index
+}
+
+// readahead returns the readahead window of a file.
+func readahead(f *torrent.File) int64 {
+	return min(max(f.Length()/100, minReadahead), maxReadahead)
+}
+
+// play makes the prioritizer download {file} from its playheads, instead of the file played before.
+// The priority of the file is left to the pieces.
+func (client *Client) play(file *torrent.File) {
+	file.SetPriority(torrent.PiecePriorityNone)
+	client.prio.mu.Lock()
+	client.prio.played = file
+	client.prio.start = 0
+	client.prio.mu.Unlock()
+	client.prioritize()
+}
+
+// follow prioritizes the pieces around the offset of {entry} until it is closed.
+func (client *Client) follow(entry *FileEntry) {
+	client.prio.mu.Lock()
+	if client.prio.readers == nil {
+		client.prio.readers = map[*FileEntry]bool{}
+	}
+	client.prio.readers[entry] = true
+	client.prio.mu.Unlock()
+	entry.onSeek = client.prioritize
+}
+
+// unfollow stops prioritizing the pieces of {entry}.
+func (client *Client) unfollow(entry *FileEntry) {
+	client.prio.mu.Lock()
+	delete(client.prio.readers, entry)
+	client.prio.mu.Unlock()
+	client.prioritize()
+}
+
+// runPrioritizer follows the readers until the client is closed.
+func (client *Client) runPrioritizer() {
+	ticker := time.NewTicker(prioritizeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-client.Client.Closed():
+			return
+		case <-ticker.C:
+			client.prioritize()
+		}
+	}
+}
+
+// prioritize sets the priorities of the pieces from the playheads, only the pieces whose priority changed are updated.
+func (client *Client) prioritize() {
+	t := client.Torrent
+	if t == nil || t.Info() == nil || client.closed() {
+		return
+	}
+	p := &client.prio
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pieceLength := t.Info().PieceLength
+	pieceOf := func(f *torrent.File, offset int64) int {
+		return int((f.Offset() + offset) / pieceLength)
+	}
+	want := map[int]types.PiecePriority{}
+	raise := func(first, last int, priority types.PiecePriority) {
+		for i := first; i <= last; i++ {
+			if priority > want[i] {
+				want[i] = priority
+			}
+		}
+	}
+
+	playheads := map[*torrent.File][]int64{}
+	for entry := range p.readers {
+		playheads[entry.File] = append(playheads[entry.File], entry.offset.Load())
+	}
+	if f := p.played; f != nil && f.Length() > 0 {
+		if p.start > 0 {
+			playheads[f] = append(playheads[f], p.start)
+		}
+		from := int64(0)
+		if heads := playheads[f]; len(heads) > 0 {
+			from = heads[0]
+			for _, offset := range heads[1:] {
+				from = min(from, offset)
+			}
+		}
+		last := f.EndPieceIndex() - 1
+		raise(pieceOf(f, from), last, torrent.PiecePriorityNormal)
+		if containers[strings.ToLower(filepath.Ext(f.Path()))] {
+			raise(f.BeginPieceIndex(), pieceOf(f, min(preloadBytes, f.Length()-1)), torrent.PiecePriorityHigh)
+			raise(pieceOf(f, max(f.Length()-preloadBytes, 0)), last, torrent.PiecePriorityHigh)
+		}
+	}
+	for f, heads := range playheads {
+		last := f.EndPieceIndex() - 1
+		for _, offset := range heads {
+			if offset < 0 || offset >= f.Length() {
+				continue
+			}
+			now := pieceOf(f, offset)
+			raise(now, now, torrent.PiecePriorityNow)
+			raise(now+1, min(now+nextPieces, last), torrent.PiecePriorityNext)
+			raise(now+nextPieces+1, min(pieceOf(f, min(offset+readahead(f), f.Length()-1)), last), torrent.PiecePriorityReadahead)
+		}
+	}
+
+	changed := 0
+	for i := range p.set {
+		if _, ok := want[i]; !ok {
+			t.Piece(i).SetPriority(torrent.PiecePriorityNone)
+			changed++
+		}
+	}
+	for i, priority := range want {
+		if p.set[i] != priority {
+			t.Piece(i).SetPriority(priority)
+			changed++
+		}
+	}
+	p.set = want
+	if changed > 0 {
+		logrus.Debugf("Prioritizer: %d pieces changed, %d playheads", changed, len(p.readers))
+	}
+}
+
+// Downloading reports whether a piece the prioritizer wants is still incomplete. Only then can the download
+// of the files streamed progress: once the file played is downloaded from its playheads to its end
+// (e.g. after a resume or a seek), what is behind them is not wanted, and nothing is downloaded anymore.
+func (client *Client) Downloading() bool {
+	t := client.Torrent
+	if t == nil || t.Info() == nil {
+		return false
+	}
+	client.prio.mu.Lock()
+	defer client.prio.mu.Unlock()
+	for i, priority := range client.prio.set {
+		if priority != torrent.PiecePriorityNone && !t.PieceState(i).Complete {
+			return true
+		}
+	}
+	return false
+}
+
+// Preloaded reports whether both ends of a container file are downloaded, always true for the other files.
+func (client *Client) Preloaded(file *torrent.File) bool {
+	if !containers[strings.ToLower(filepath.Ext(file.Path()))] {
+		return true
+	}
+	head := min(preloadBytes, file.Length())
+	return client.BufferedFrom(file, 0) >= head && client.BufferedFrom(file, file.Length()-head) >= head
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const testPieceLength = 16 << 10
+
+// newTestClient returns a client streaming {name}, a file of {pieces} pieces whose pieces from {have} on are
+// already downloaded. It connects to no peer.
+func newTestClient(t *testing.T, name string, pieces, have int) *Client {
+	t.Helper()
+	data := make([]byte, pieces*testPieceLength)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// The metainfo of the whole file, then the file with its first pieces missing in the data directory
+	source := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(source, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: testPieceLength}
+	if err := info.BuildFromFilePath(source); err != nil {
+		t.Fatal(err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDir := t.TempDir()
+	partial := append(make([]byte, have*testPieceLength), data[have*testPieceLength:]...)
+	if err := os.WriteFile(filepath.Join(dataDir, name), partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := torrent.NewDefaultClientConfig()
+	config.DataDir = dataDir
+	config.ListenPort = 0
+	config.NoDHT = true
+	config.DisableTrackers = true
+	config.NoDefaultPortForwarding = true
+	config.Seed = false
+	cl, err := torrent.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+	tt, err := cl.AddTorrent(&metainfo.MetaInfo{InfoBytes: infoBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-tt.GotInfo()
+	tt.VerifyData()
+	if got := tt.BytesCompleted(); got != int64(len(data)-have*testPieceLength) {
+		t.Fatalf("%d bytes verified, want %d", got, len(data)-have*testPieceLength)
+	}
+	return &Client{Client: cl, Torrent: tt}
+}
+
+func TestDownloadingResumedToTheEnd(t *testing.T) {
+	// Resumed at 50%, the second half is downloaded: the first half stays incomplete, and is not wanted
+	c := newTestClient(t, "movie.ts", 16, 8)
+	file := c.Torrent.Files()[0]
+	c.SetFile(file)
+	c.PrioritizeOffset(file, file.Length()/2)
+	if file.BytesCompleted() >= file.Length() {
+		t.Fatal("file complete")
+	}
+	if c.Downloading() {
+		t.Error("downloading once the file is downloaded from the resume position to its end")
+	}
+
+	// A seek back before the resume position wants the first half again
+	c.play(file)
+	if !c.Downloading() {
+		t.Error("not downloading the missing pieces from the start of the file")
+	}
+}
+
+func TestDownloadingContainerEnds(t *testing.T) {
+	// The start of a container file is wanted even when the playback resumes after it
+	c := newTestClient(t, "movie.mkv", 16, 8)
+	file := c.Torrent.Files()[0]
+	c.SetFile(file)
+	c.PrioritizeOffset(file, file.Length()/2)
+	if !c.Downloading() {
+		t.Error("not downloading the header of the container")
+	}
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SeedPolicy is how the torrent is uploaded to the peers, set in the configuration.
+type SeedPolicy struct {
+	Upload bool          // upload while streaming
+	Ratio  float64       // once the stream ended, seed until the upload ratio reaches it (0 for no ratio limit)
+	Time   time.Duration // once the stream ended, seed at most this long (0 for no time limit)
+	// Slots is how many peers the torrent stays connected to while seeding (0 for the default):
+	// every interested peer connected is uploaded to.
+	Slots int
+}
+
+// ConfiguredSeedPolicy returns the seeding policy of the configuration.
+func ConfiguredSeedPolicy() SeedPolicy {
+	policy := SeedPolicy{
+		Upload: configurations.Upload,
+		Ratio:  configurations.SeedRatio,
+		Slots:  configurations.UploadSlots,
+	}
+	if configurations.SeedTime != "" {
+		d, err := time.ParseDuration(configurations.SeedTime)
+		if err != nil {
+			logrus.Warnf("Invalid SeedTime %q, expected e.g. 30m or 2h: %v", configurations.SeedTime, err)
+		} else {
+			policy.Time = d
+		}
+	}
+	return policy
+}
+
+// Seeds reports whether the torrent is seeded once the stream ended.
+func (p SeedPolicy) Seeds() bool {
+	return p.Ratio > 0 || p.Time > 0
+}
+
+// Done reports whether the seeding reached a limit of the policy, after {elapsed}.
+func (p SeedPolicy) Done(transfer Transfer, elapsed time.Duration) bool {
+	return (p.Ratio > 0 && transfer.Ratio() >= p.Ratio) || (p.Time > 0 && elapsed >= p.Time)
+}
+
+// Transfer is how much data of the torrent was exchanged with the peers during the session.
+type Transfer struct {
+	Downloaded int64
+	Uploaded   int64
+	Completed  int64 // bytes of the torrent on disk
+}
+
+// Ratio returns the uploaded bytes over the downloaded bytes,
+// or over the completed bytes when nothing was downloaded (the data was already on disk).
+func (t Transfer) Ratio() float64 {
+	base := t.Downloaded
+	if base == 0 {
+		base = t.Completed
+	}
+	if base == 0 {
+		return 0
+	}
+	return float64(t.Uploaded) / float64(base)
+}
+
+// Transfer returns what the torrent exchanged with the peers so far.
+func (client *Client) Transfer() Transfer {
+	stats := client.Torrent.Stats()
+	return Transfer{
+		Downloaded: stats.BytesReadData.Int64(),
+		Uploaded:   stats.BytesWrittenData.Int64(),
+		Completed:  client.Torrent.BytesCompleted(),
+	}
+}
+
+// StartSeeding uploads what was downloaded of the torrent, even if the policy does not upload while streaming:
+// nothing more is downloaded, and only the upload slots of the policy stay connected.
+func (client *Client) StartSeeding() {
+	client.Torrent.DisallowDataDownload()
+	client.Torrent.AllowDataUpload()
+	if client.Seeding.Slots > 0 {
+		client.Torrent.SetMaxEstablishedConns(client.Seeding.Slots)
+	}
+}
@@ -0,0 +1,341 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/dustin/go-humanize"
+
+	"github.com/stl3/torgo/dlna"
+	"github.com/stl3/torgo/ratelimit"
+	"github.com/stl3/torgo/transcode"
+)
+
+// transcodeDir is the directory of the data directory where the transcoded segments are cached.
+const transcodeDir = ".transcode"
+
+// openFiles tracks the files of the torrent read by the requests to the server.
+type openFiles struct {
+	mu        sync.Mutex
+	readers   map[*torrent.File]int  // number of requests reading each file
+	requested map[*torrent.File]bool // files requested at least once
+}
+
+// routes returns the handler of the server:
+//
+//	GET /                        index of the files of the torrent (HTML, or JSON with `?format=json`)
+//	GET /playlist.m3u            playlist of the media files, in torrent order
+//	GET /files/<index>/<name>    stream of a file, <name> is only there for the players to show it
+//	GET /transcode/<index>/...   file transcoded to HLS or MP4 by ffmpeg, see `transcode.Transcoder.Serve`
+//	GET|PUT /api/limits          rate limits of the client, see `ratelimit.Limiter.Handler`, from this machine only
+//
+// The server listens on every interface for the devices of the network (DLNA, Chromecast), which only read the files.
+func (client *Client) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", client.indexHandler)
+	mux.HandleFunc("GET /playlist.m3u", client.playlistHandler)
+	mux.HandleFunc("GET /files/{index}/{name...}", client.fileHandler)
+	mux.HandleFunc("GET /transcode/{index}/{name...}", client.transcodeHandler)
+	mux.Handle(ratelimit.Path, loopbackOnly(client.Limiter.Handler()))
+	return mux
+}
+
+// loopbackOnly refuses the requests which do not come from this machine.
+func loopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// FilePath returns the path of the file on the server.
+func (client *Client) FilePath(file *torrent.File) string {
+	for i, f := range client.Torrent.Files() {
+		if f == file {
+			return fmt.Sprintf("/files/%d/%s", i, url.PathEscape(path.Base(file.DisplayPath())))
+		}
+	}
+	return "/"
+}
+
+// TranscodePath returns the path of the HLS master playlist of the file on the server.
+func (client *Client) TranscodePath(file *torrent.File) string {
+	for i, f := range client.Torrent.Files() {
+		if f == file {
+			return fmt.Sprintf("/transcode/%d/%s", i, transcode.MasterPlaylist)
+		}
+	}
+	return "/"
+}
+
+// TranscodeURL returns the URL of the file played transcoded to HLS, for the devices which cannot play it.
+func (client *Client) TranscodeURL() string {
+	if client.LargestFile == nil {
+		return client.URL
+	}
+	return client.URL + client.TranscodePath(client.LargestFile)
+}
+
+// StreamURL returns the URL of the stream of the file played, once it is chosen.
+// probeParam marks the requests of the tools reading the file before the player, see `Client.ProbeURL`.
+const probeParam = "probe"
+
+// ProbeURL returns the stream URL for the tools reading the file before the player plays it (e.g. ffprobe):
+// their reads are not counted as played, see `Client.BytesServed` and `Client.ReadPosition`.
+func (client *Client) ProbeURL() string {
+	return client.StreamURL() + "?" + probeParam
+}
+
+func (client *Client) StreamURL() string {
+	if client.LargestFile == nil {
+		return client.URL
+	}
+	return client.URL + client.FilePath(client.LargestFile)
+}
+
+// waitInfo waits for the metadata of the torrent, it returns false if the client was closed meanwhile.
+func (client *Client) waitInfo() bool {
+	select {
+	case <-client.Torrent.GotInfo():
+		return true
+	case <-client.Client.Closed():
+		return false
+	}
+}
+
+// fileHandler streams a file of the torrent. Its pieces are only downloaded while it is being read,
+// unless it is the file played.
+func (client *Client) fileHandler(w http.ResponseWriter, r *http.Request) {
+	if !client.waitInfo() {
+		http.Error(w, "torrent closed", http.StatusServiceUnavailable)
+		return
+	}
+	files := client.Torrent.Files()
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= len(files) {
+		http.NotFound(w, r)
+		return
+	}
+	file := files[index]
+
+	entry, err := NewFileReader(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer entry.Close()
+	if file == client.LargestFile && !r.URL.Query().Has(probeParam) {
+		entry.(*FileEntry).stats = &client.reads
+	}
+	client.open(file)
+	defer client.release(file)
+	client.follow(entry.(*FileEntry))
+	defer client.unfollow(entry.(*FileEntry))
+
+	// Set the appropriate Content-Type header based on the file type
+	contentType := mime.TypeByExtension(filepath.Ext(file.Path()))
+	if contentType == "" {
+		// Default to application/octet-stream if content type is unknown
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	dlna.ContentFeatures(w, r)
+
+	http.ServeContent(w, r, file.DisplayPath(), time.Now(), entry)
+}
+
+// transcodeHandler serves a file of the torrent transcoded by ffmpeg, which reads it from its stream on this server.
+func (client *Client) transcodeHandler(w http.ResponseWriter, r *http.Request) {
+	if !client.waitInfo() {
+		http.Error(w, "torrent closed", http.StatusServiceUnavailable)
+		return
+	}
+	files := client.Torrent.Files()
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= len(files) {
+		http.NotFound(w, r)
+		return
+	}
+	in := transcode.Input{
+		ID:  fmt.Sprintf("%s/%d", client.Torrent.InfoHash().HexString(), index),
+		URL: client.URL + client.FilePath(files[index]),
+	}
+	client.Transcoder.Serve(w, r, in, r.PathValue("name"))
+}
+
+// open raises the priority of a file while requests read it.
+func (client *Client) open(file *torrent.File) {
+	client.files.mu.Lock()
+	defer client.files.mu.Unlock()
+	if client.files.readers == nil {
+		client.files.readers = map[*torrent.File]int{}
+		client.files.requested = map[*torrent.File]bool{}
+	}
+	client.files.readers[file]++
+	client.files.requested[file] = true
+	// The pieces of the file played are prioritized from its playheads
+	if file != client.LargestFile && file.Priority() == torrent.PiecePriorityNone {
+		file.SetPriority(torrent.PiecePriorityNormal)
+	}
+}
+
+// release lowers the priority of a file once no request reads it anymore, unless it is the file played.
+func (client *Client) release(file *torrent.File) {
+	client.files.mu.Lock()
+	defer client.files.mu.Unlock()
+	client.files.readers[file]--
+	if client.files.readers[file] <= 0 {
+		delete(client.files.readers, file)
+		if file != client.LargestFile && !client.closed() {
+			file.SetPriority(torrent.PiecePriorityNone)
+		}
+	}
+}
+
+// requested reports whether the file was requested from the server.
+func (client *Client) requested(file *torrent.File) bool {
+	client.files.mu.Lock()
+	defer client.files.mu.Unlock()
+	return client.files.requested[file]
+}
+
+// StreamedFiles returns the file played and the files requested from the server, in the order of the torrent.
+func (client *Client) StreamedFiles() []*torrent.File {
+	var files []*torrent.File
+	for _, file := range client.Torrent.Files() {
+		if file == client.LargestFile || client.requested(file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// fileInfo describes a file of the torrent in the index.
+type fileInfo struct {
+	Index     int     `json:"index"`
+	Path      string  `json:"path"`
+	Size      int64   `json:"size"`
+	Completed int64   `json:"completed"`
+	Percent   float64 `json:"percent"`
+	Playing   bool    `json:"playing"`
+	URL       string  `json:"url"`
+	Transcode string  `json:"transcode,omitempty"` // HLS master playlist of the media files
+}
+
+func (client *Client) fileInfos(base string) []fileInfo {
+	var infos []fileInfo
+	for i, file := range client.Torrent.Files() {
+		info := fileInfo{
+			Index:     i,
+			Path:      file.DisplayPath(),
+			Size:      file.Length(),
+			Completed: file.BytesCompleted(),
+			Playing:   file == client.LargestFile,
+			URL:       base + client.FilePath(file),
+		}
+		if isMedia(info.Path) {
+			info.Transcode = base + client.TranscodePath(file)
+		}
+		if info.Size > 0 {
+			info.Percent = float64(info.Completed) / float64(info.Size) * 100
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// baseURL returns the URL of the server as the client of the request reached it,
+// so that the links work from another device of the network.
+func baseURL(r *http.Request) string {
+	return "http://" + r.Host
+}
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"bytes": func(n int64) string { return humanize.Bytes(uint64(n)) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Name}}</title></head>
+<body>
+<h1>{{.Name}}</h1>
+<p><a href="/playlist.m3u">playlist.m3u</a></p>
+<table>
+<tr><th>#</th><th>File</th><th>Size</th><th>Downloaded</th></tr>
+{{range .Files}}<tr>
+<td>{{.Index}}</td>
+<td><a href="{{.URL}}">{{.Path}}</a>{{if .Transcode}} (<a href="{{.Transcode}}">HLS</a>){{end}}{{if .Playing}} (playing){{end}}</td>
+<td>{{bytes .Size}}</td>
+<td>{{printf "%.1f" .Percent}}%</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// indexHandler lists the files of the torrent, as HTML or as JSON (`?format=json` or `Accept: application/json`).
+func (client *Client) indexHandler(w http.ResponseWriter, r *http.Request) {
+	if !client.waitInfo() {
+		http.Error(w, "torrent closed", http.StatusServiceUnavailable)
+		return
+	}
+	files := client.fileInfos(baseURL(r))
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":      client.Torrent.Name(),
+			"info_hash": client.Torrent.InfoHash().HexString(),
+			"files":     files,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = indexTemplate.Execute(w, map[string]interface{}{"Name": client.Torrent.Name(), "Files": files})
+}
+
+// isMedia reports whether the file is a video or an audio file, from its extension.
+func isMedia(name string) bool {
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	return strings.HasPrefix(contentType, "video/") || strings.HasPrefix(contentType, "audio/") ||
+		strings.EqualFold(filepath.Ext(name), ".mkv")
+}
+
+// playlistHandler returns an M3U playlist of the media files of the torrent (every file if it has none), in torrent order.
+func (client *Client) playlistHandler(w http.ResponseWriter, r *http.Request) {
+	if !client.waitInfo() {
+		http.Error(w, "torrent closed", http.StatusServiceUnavailable)
+		return
+	}
+	files := client.fileInfos(baseURL(r))
+	var media []fileInfo
+	for _, file := range files {
+		if isMedia(file.Path) {
+			media = append(media, file)
+		}
+	}
+	if len(media) == 0 {
+		media = files
+	}
+
+	w.Header().Set("Content-Type", "audio/x-mpegurl")
+	w.Header().Set("Content-Disposition", `inline; filename="playlist.m3u"`)
+	fmt.Fprintln(w, "#EXTM3U")
+	for _, file := range media {
+		fmt.Fprintf(w, "#EXTINF:-1,%s\n%s\n", path.Base(file.Path), file.URL)
+	}
+}
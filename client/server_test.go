@@ -0,0 +1,42 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stl3/torgo/ratelimit"
+)
+
+func TestLimitsFromThisMachineOnly(t *testing.T) {
+	client := &Client{Limiter: ratelimit.New(ratelimit.Limits{}, ratelimit.Limits{}, ratelimit.Schedule{})}
+	routes := client.routes()
+	tests := []struct {
+		remoteAddr string
+		method     string
+		want       int
+	}{
+		{"127.0.0.1:50000", http.MethodGet, http.StatusOK},
+		{"127.0.0.1:50000", http.MethodPut, http.StatusOK},
+		{"[::1]:50000", http.MethodPut, http.StatusOK},
+		{"192.168.1.20:50000", http.MethodGet, http.StatusForbidden},
+		{"192.168.1.20:50000", http.MethodPut, http.StatusForbidden},
+		{"[fe80::1]:50000", http.MethodPut, http.StatusForbidden},
+		// A web page can send a POST without asking
+		{"127.0.0.1:50000", http.MethodPost, http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, ratelimit.Path, strings.NewReader(`{"download": 1000000}`))
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.remoteAddr, w.Code, test.want)
+		}
+	}
+	if limits := client.Limiter.Status().Limits; limits.Download != 1000000 {
+		t.Errorf("download limit = %d, want 1000000", limits.Download)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo/cast"
+	"github.com/stl3/torgo/player"
+	"github.com/stl3/torgo/transcode"
+)
+
+// castPrefix starts the names of the players of the Chromecasts.
+const castPrefix = "Chromecast: "
+
+// castDevices are the Chromecasts of the network, searched once in the background by discoverCastDevices.
+var castDevices struct {
+	once  sync.Once
+	done  chan struct{}
+	found []*cast.Device
+}
+
+// discoverCastDevices starts the search of the Chromecasts, unless it was started already.
+func discoverCastDevices() {
+	castDevices.once.Do(func() {
+		castDevices.done = make(chan struct{})
+		go func() {
+			defer close(castDevices.done)
+			found, err := cast.Discover(discoveryTimeout)
+			if err != nil {
+				logrus.Debugln("Cast:", err)
+			}
+			castDevices.found = found
+		}()
+	})
+}
+
+// castPlayers returns a player for each Chromecast of the network, once they are found.
+func castPlayers() []*player.Player {
+	discoverCastDevices()
+	<-castDevices.done
+	var players []*player.Player
+	for _, d := range castDevices.found {
+		players = append(players, castPlayer(d))
+	}
+	return players
+}
+
+// castPlayer returns the player casting to the Chromecast {d}, until the playback ends or Ctrl+C.
+func castPlayer(d *cast.Device) *player.Player {
+	return &player.Player{
+		Name: castPrefix + d.Name,
+		Launch: func(p *player.Player, url string, subtitlePath string, title string, start player.Position) error {
+			stop, release := stopOnInterrupt()
+			defer release()
+			media := cast.Media{
+				Title:        title,
+				SubtitlePath: subtitlePath,
+				Start:        time.Duration(start.Seconds * float64(time.Second)),
+				StartPercent: start.Percent,
+			}
+			media.URL, media.ContentType = castStream(p, url)
+			state := ""
+			media.OnStatus = func(status cast.Status) {
+				if status.State != state {
+					state = status.State
+					infoPrint(fmt.Sprintf("%s: %s", d.Name, strings.ToLower(state)))
+				}
+				if p.OnPosition != nil && status.Duration > 0 && status.Position > 0 {
+					p.OnPosition(player.Position{Seconds: status.Position.Seconds(), Percent: float64(status.Position) / float64(status.Duration) * 100})
+				}
+			}
+
+			infoPrint(fmt.Sprintf("Casting to %s, press Ctrl+C to stop", d.Name))
+			return d.Cast(media, stop)
+		},
+	}
+}
+
+// castStream returns the URL of the stream cast, and its content type when it is not the one of its extension:
+// the stream itself when the Chromecasts play its format, or the stream transcoded to HLS.
+func castStream(p *player.Player, url string) (string, string) {
+	if p.Transcoder == nil || p.TranscodeURL == "" {
+		return url, ""
+	}
+	codecs, err := p.Transcoder.Codecs(url)
+	if errors.Is(err, transcode.ErrNoFFmpeg) {
+		logrus.Warnln("ffmpeg is not installed, the stream is cast as it is")
+		return url, ""
+	} else if err != nil {
+		logrus.Debugln(err)
+		return url, ""
+	}
+	if cast.Playable(codecs.Format, codecs.Video, codecs.Audio) {
+		return url, ""
+	}
+	infoPrint(fmt.Sprintf("The Chromecasts cannot play %s, transcoding it", strings.Trim(codecs.Video+"/"+codecs.Audio, "/")))
+	return p.TranscodeURL, "application/x-mpegurl"
+}
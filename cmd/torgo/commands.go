@@ -0,0 +1,540 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo"
+	"github.com/stl3/torgo/client"
+	"github.com/stl3/torgo/models"
+	"github.com/stl3/torgo/player"
+	"github.com/stl3/torgo/subtitles"
+)
+
+// command is a non-interactive subcommand, it returns the exit code of the program.
+type command struct {
+	usage string
+	run   func(args []string) int
+}
+
+var commands map[string]command
+
+func init() {
+	// Assigned here because the `help` command lists the commands
+	commands = map[string]command{
+		"search":    {"search [flags] <query>", searchCommand},
+		"stream":    {"stream [flags] <query | magnet>", streamCommand},
+		"download":  {"download [flags] <query | magnet>", downloadCommand},
+		"info":      {"info [flags] <query | magnet>", infoCommand},
+		"providers": {"providers [check [-strict] [names...]]", providersCommand},
+		"history":   {"history [list | search <text> | replay <id> | delete <id...>]", historyCommand},
+		"daemon":    {"daemon [serve | add | list | show | select | pause | resume | remove | url] [flags] [hash] [args...]", daemonCommand},
+		"limits":    {"limits [-download <rate>] [-upload <rate>] [-reset] [-daemon]", limitsCommand},
+		"players":   {"players", playersCommand},
+		"subtitles": {"subtitles [flags] <query | video file>", subtitlesCommand},
+		"dlna":      {"dlna [list | play | pause | stop | seek | status] [flags] [renderer] [url | position]", dlnaCommand},
+		"help":      {"help", helpCommand},
+	}
+}
+
+func helpCommand([]string) int {
+	fmt.Println("Usage:")
+	fmt.Println("  torgo                     start the interactive wizard")
+	fmt.Println("  torgo <magnet>            stream a magnet")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println("  torgo " + commands[name].usage)
+	}
+	fmt.Println("\nRun 'torgo <command> -h' for the flags of a command.")
+	return 0
+}
+
+// searchFlags are the flags shared by every command that searches the providers.
+type searchFlags struct {
+	category  string
+	providers string
+	sortBy    string
+	limit     int
+	index     int
+	best      bool
+	results   []models.Source // results of the search of `source`, nil for a magnet
+}
+
+func (sf *searchFlags) register(fs *flag.FlagSet, pick bool) {
+	fs.StringVar(&sf.category, "category", "all", "category: all, movie, tv, anime, audiobook, porn, documentaries")
+	fs.StringVar(&sf.providers, "providers", "", "comma separated providers to search (default: every provider supporting the category)")
+	fs.StringVar(&sf.sortBy, "sort", "seeders", "sort results by: default, seeders, leechers, size")
+	fs.IntVar(&sf.limit, "limit", configurations.ResultsLimit, "maximum number of results")
+	if pick {
+		fs.IntVar(&sf.index, "index", 0, "pick the result at this position (1-based) of the search results")
+		fs.BoolVar(&sf.best, "best", false, "pick the result with the most seeders")
+	}
+}
+
+// parse validates the flags and returns the providers, category and sort to search with.
+func (sf *searchFlags) parse() ([]interface{}, torgo.Category, torgo.SortBy, error) {
+	category, err := torgo.ParseCategory(sf.category)
+	if err != nil {
+		return nil, category, "", err
+	}
+	sortBy, err := torgo.ParseSortBy(sf.sortBy)
+	if err != nil {
+		return nil, category, sortBy, err
+	}
+
+	var providers []interface{}
+	var wanted []string
+	for _, name := range strings.Split(sf.providers, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted = append(wanted, name)
+		}
+	}
+	for _, provider := range torgo.AllProviders {
+		if torgo.GetCategoryURL(category, provider.GetCategories()) == "" {
+			continue
+		}
+		if len(wanted) == 0 || containsFold(wanted, strings.TrimSpace(provider.GetName())) {
+			providers = append(providers, provider)
+		}
+	}
+	for _, name := range wanted {
+		if !containsProvider(providers, name) {
+			return nil, category, sortBy, fmt.Errorf("provider %q does not exist or does not support category %v", name, category)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, category, sortBy, fmt.Errorf("no provider supports category %v", category)
+	}
+	return providers, category, sortBy, nil
+}
+
+// search queries the providers with the parsed flags.
+func (sf *searchFlags) search(query string) ([]models.Source, error) {
+	providers, category, sortBy, err := sf.parse()
+	if err != nil {
+		return nil, err
+	}
+	results := torgo.ListResults(providers, query, sf.limit, category, sortBy)
+	if len(results) == 0 {
+		return nil, errors.New("no torrents found")
+	}
+	return results, nil
+}
+
+// pick returns the result chosen with -index or -best.
+func (sf *searchFlags) pick(results []models.Source) (models.Source, error) {
+	var source models.Source
+	switch {
+	case sf.best:
+		source = results[0]
+		for _, result := range results[1:] {
+			if result.Seeders > source.Seeders {
+				source = result
+			}
+		}
+	case sf.index >= 1 && sf.index <= len(results):
+		source = results[sf.index-1]
+	case sf.index != 0:
+		return source, fmt.Errorf("-index out of range (1-%d)", len(results))
+	default:
+		return source, errors.New("no result picked: use -index or -best")
+	}
+	err := source.ResolveMagnet()
+	return source, err
+}
+
+// source returns the source given as argument: either a magnet, or a query whose result is picked with the flags.
+func (sf *searchFlags) source(args []string) (models.Source, error) {
+	arg := strings.TrimSpace(strings.Join(args, " "))
+	if arg == "" {
+		return models.Source{}, errors.New("missing query or magnet")
+	}
+	if strings.HasPrefix(arg, "magnet:") {
+		return models.Source{From: "User Provided", Title: "Unknown", Magnet: arg}, nil
+	}
+	results, err := sf.search(arg)
+	if err != nil {
+		return models.Source{}, err
+	}
+	sf.results = results
+	return sf.pick(results)
+}
+
+func containsProvider(providers []interface{}, name string) bool {
+	for _, p := range providers {
+		if strings.EqualFold(p.(models.ProviderInterface).GetName(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func searchCommand(args []string) int {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	sf := searchFlags{}
+	sf.register(fs, false)
+	format := fs.String("format", formatTable, "output format: table, json, ndjson, csv, magnets")
+	_ = fs.Parse(args)
+
+	query := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if query == "" {
+		errorPrint("missing query")
+		return 2
+	}
+	writer, streaming, err := newResultWriter(*format, os.Stdout)
+	if err != nil {
+		errorPrint(err)
+		return 2
+	}
+	if *format != formatTable {
+		// Keep stdout clean for the tools reading it
+		logrus.SetOutput(os.Stderr)
+		color.Output = os.Stderr
+	}
+
+	// The machine-readable formats carry every field, magnets included
+	resolve := func(results []models.Source) {
+		if *format != formatTable {
+			models.ResolveMagnets(results, 0)
+		}
+	}
+
+	if streaming {
+		// Results are written as soon as each provider is done
+		providers, category, sortBy, err := sf.parse()
+		if err != nil {
+			errorPrint(err)
+			return 2
+		}
+		found := false
+		torgo.StreamResults(providers, query, sf.limit, category, sortBy, func(results []models.Source) {
+			found = true
+			resolve(results)
+			if err := writer.Write(results); err != nil {
+				errorPrint(err)
+			}
+		})
+		_ = writer.Close()
+		if !found {
+			errorPrint("no torrents found")
+			return 1
+		}
+		return 0
+	}
+
+	results, err := sf.search(query)
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	resolve(results)
+	if err := writer.Write(results); err != nil {
+		errorPrint(err)
+		return 1
+	}
+	if err := writer.Close(); err != nil {
+		errorPrint(err)
+		return 1
+	}
+	return 0
+}
+
+// printResults prints every result in a table, without truncating the titles.
+func printResults(results []models.Source) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"#", "From", "Name", "S", "L", "Size"})
+	for i, result := range results {
+		table.Append([]string{
+			strconv.Itoa(i + 1),
+			result.From,
+			strings.TrimSpace(result.Title),
+			strconv.Itoa(result.Seeders),
+			strconv.Itoa(result.Leechers),
+			humanize.Bytes(uint64(result.FileSize)),
+		})
+	}
+	table.Render()
+}
+
+// defaultStreamPlayer returns the player of `torgo stream` without -player: DefaultPlayer of the configuration, or mpv.
+func defaultStreamPlayer() string {
+	if configurations.DefaultPlayer != "" {
+		return configurations.DefaultPlayer
+	}
+	return "mpv"
+}
+
+func streamCommand(args []string) int {
+	fs := flag.NewFlagSet("stream", flag.ExitOnError)
+	sf := searchFlags{}
+	sf.register(fs, true)
+	playerName := fs.String("player", defaultStreamPlayer(), "player to launch, or 'none' to only serve the stream")
+	subLang := fs.String("sub-lang", "", "comma separated subtitle languages (e.g. eng,fre), the first subtitle found is used")
+	fileIndex := fs.Int("file", 0, "file of the torrent to stream (1-based, as listed by 'torgo info'), default: the largest")
+	resume := fs.Bool("resume", true, "resume the playback where it stopped last time")
+	keep := fs.Bool("keep", configurations.KeepDownloads, "keep the files, finishing their download once the player is closed")
+	library := fs.String("library", libraryDir, "directory the kept files are moved into once downloaded")
+	buffer := fs.Bool("prebuffer", true, "buffer the start of the file before launching the player")
+	failover := fs.Bool("failover", failoverPolicy != failoverOff, "switch to the next result with the same title and quality when the source is dead")
+	_ = fs.Parse(args)
+
+	if !strings.EqualFold(*playerName, "none") {
+		if _, err := findPlayer(*playerName); err != nil {
+			errorPrint(err)
+			return 2
+		}
+	}
+	source, err := sf.source(fs.Args())
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	resumePolicy = resumeNever
+	if *resume {
+		resumePolicy = resumeAlways
+	}
+	keepPolicy = keepNever
+	if *keep {
+		keepPolicy = keepAlways
+	}
+	libraryDir = *library
+	prebuffer = *buffer
+	failoverPolicy = failoverOff
+	if *failover {
+		failoverPolicy = failoverAuto
+	}
+	return streamSource(source, sf.results, *playerName, *subLang, fileChooser(*fileIndex))
+}
+
+// streamSource streams the source with the named player ("none" to only serve it) without prompting,
+// with the first subtitle found in {subLang} (comma separated languages), and returns the exit code.
+// When the source is dead, the alternatives among {results} are streamed as the failover policy says.
+func streamSource(source models.Source, results []models.Source, playerName string, subLang string, chooser func(*client.Client) func([]*torrent.File) *torrent.File) int {
+	var p *player.Player
+	if !strings.EqualFold(playerName, "none") {
+		var err error
+		if p, err = findPlayer(playerName); err != nil {
+			errorPrint(err)
+			return 2
+		}
+	}
+	subtitlePath := ""
+	if subLang != "" && p != nil {
+		var err error
+		query := subtitlesQuery(source.Title, strings.Split(subLang, ","))
+		if subtitlePath, err = fetchSubtitles(query, subtitlesDir, func([]subtitles.Subtitle) int { return 0 }); err != nil {
+			errorPrint(err)
+		}
+	}
+	chooseFile = chooser
+	if err := streamFailover(p, source, subtitlePath, results); err != nil {
+		errorPrint(err)
+		return 1
+	}
+	return 0
+}
+
+// fileChooser returns a non-interactive `client.ChooseFile`: the file at {index} (1-based, torrent order)
+// or the largest candidate when index is 0.
+func fileChooser(index int) func(*client.Client) func([]*torrent.File) *torrent.File {
+	return func(c *client.Client) func([]*torrent.File) *torrent.File {
+		return func(files []*torrent.File) *torrent.File {
+			all := c.Torrent.Files()
+			if index >= 1 && index <= len(all) {
+				return all[index-1]
+			}
+			largest := files[0]
+			for _, file := range files[1:] {
+				if file.Length() > largest.Length() {
+					largest = file
+				}
+			}
+			return largest
+		}
+	}
+}
+
+func downloadCommand(args []string) int {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	sf := searchFlags{}
+	sf.register(fs, true)
+	dir := fs.String("dir", dataDir, "directory to download into")
+	fileIndex := fs.Int("file", 0, "only download this file of the torrent (1-based, as listed by 'torgo info'), default: all files")
+	_ = fs.Parse(args)
+
+	source, err := sf.source(fs.Args())
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	c, err := client.NewClient(*dir, configurations.TorrentPort, configurations.HostPort)
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	if _, err := c.SetSource(source); err != nil {
+		c.Client.Close()
+		errorPrint(err)
+		return 1
+	}
+	defer c.Close()
+
+	infoPrint("Waiting for torrent metadata...")
+	<-c.Torrent.GotInfo()
+	t := c.Torrent
+	total := t.Length()
+	if *fileIndex != 0 {
+		files := t.Files()
+		if *fileIndex < 1 || *fileIndex > len(files) {
+			errorPrint(fmt.Sprintf("-file out of range (1-%d)", len(files)))
+			return 2
+		}
+		file := files[*fileIndex-1]
+		file.Download()
+		total = file.Length()
+		infoPrint("Downloading", file.DisplayPath(), "to", *dir)
+		waitDownload(func() int64 { return file.BytesCompleted() }, total, nil)
+	} else {
+		t.DownloadAll()
+		infoPrint("Downloading", t.Name(), "to", *dir)
+		waitDownload(t.BytesCompleted, total, nil)
+	}
+	fmt.Print("\n")
+	infoPrint("Download complete")
+	seedTorrent(c)
+	printTransfer(c)
+	return 0
+}
+
+// waitDownload prints the download progress until {completed} reaches {total}, or a signal is received on {stop}
+// (nil to wait for the end), and reports whether the download completed.
+func waitDownload(completed func() int64, total int64, stop <-chan os.Signal) bool {
+	ticker := time.NewTicker(1500 * time.Millisecond)
+	defer ticker.Stop()
+	last, lastTime := completed(), time.Now()
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+		}
+		done := completed()
+		speed := float64(done-last) / time.Since(lastTime).Seconds()
+		last, lastTime = done, time.Now()
+		fmt.Printf("\rProgress: %s / %s  %s%%  Download Speed: %s/s\033[K",
+			color.GreenString(humanize.Bytes(uint64(done))),
+			color.BlueString(humanize.Bytes(uint64(total))),
+			color.YellowString("%.2f", float64(done)/float64(total)*100),
+			color.CyanString(humanize.Bytes(uint64(speed))))
+		if done >= total {
+			return true
+		}
+	}
+}
+
+func infoCommand(args []string) int {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	sf := searchFlags{}
+	sf.register(fs, true)
+	timeout := fs.Duration("timeout", 60*time.Second, "how long to wait for the torrent metadata (0 to skip the file list)")
+	_ = fs.Parse(args)
+
+	source, err := sf.source(fs.Args())
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	printSource(source, 0)
+	if *timeout <= 0 {
+		return 0
+	}
+
+	c, err := client.NewClient(dataDir, configurations.TorrentPort, configurations.HostPort)
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	if _, err := c.SetSource(source); err != nil {
+		c.Client.Close()
+		errorPrint(err)
+		return 1
+	}
+	defer c.Close()
+	select {
+	case <-c.Torrent.GotInfo():
+	case <-time.After(*timeout):
+		errorPrint("Timed out waiting for the torrent metadata")
+		return 1
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"#", "File", "Size"})
+	for i, file := range c.Torrent.Files() {
+		table.Append([]string{strconv.Itoa(i + 1), file.DisplayPath(), humanize.Bytes(uint64(file.Length()))})
+	}
+	table.Render()
+	return 0
+}
+
+func providersCommand(args []string) int {
+	if len(args) > 0 && args[0] == "check" {
+		fs := flag.NewFlagSet("providers check", flag.ExitOnError)
+		strict := fs.Bool("strict", false, "exit with status 1 when any provider fails, not only when one regressed")
+		_ = fs.Parse(args[1:])
+		return providersCheck(fs.Args(), *strict)
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Provider", "Site", "Categories"})
+	for _, provider := range torgo.AllProviders {
+		var categories []string
+		for _, category := range []torgo.Category{torgo.CategoryAll, torgo.CategoryMovie, torgo.CategoryTV, torgo.CategoryAnime,
+			torgo.CategoryAudiobook, torgo.CategoryPorn, torgo.CategoryDocumentaries} {
+			if torgo.GetCategoryURL(category, provider.GetCategories()) != "" {
+				categories = append(categories, strings.ToLower(string(category)))
+			}
+		}
+		table.Append([]string{provider.GetName(), provider.GetSite(), strings.Join(categories, ", ")})
+	}
+	table.Render()
+	return 0
+}
+
+// playersCommand lists the players installed, with their path and version, and the devices of the network.
+func playersCommand([]string) int {
+	discoverNetworkPlayers()
+	player.Detect()
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Player", "Path", "Version"})
+	for _, p := range player.Players {
+		path := "not installed"
+		if p.Installed {
+			path = p.Path
+		}
+		table.Append([]string{p.Name, path, p.Version})
+	}
+	for _, p := range networkPlayers() {
+		table.Append([]string{p.Name, "network", ""})
+	}
+	table.Render()
+	return 0
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/stl3/torgo/daemon"
+	"github.com/stl3/torgo/ratelimit"
+	"github.com/stl3/torgo/webui"
+)
+
+// defaultDaemonAddr is where the daemon listens when the config does not say: this machine only,
+// as the API has no authentication.
+const defaultDaemonAddr = "127.0.0.1:8790"
+
+func daemonAddr() string {
+	if configurations.DaemonAddr != "" {
+		return configurations.DaemonAddr
+	}
+	return defaultDaemonAddr
+}
+
+// loopback reports whether {addr} (host:port) only listens on this machine.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+func daemonCommand(args []string) int {
+	action := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("daemon "+action, flag.ExitOnError)
+	addr := fs.String("addr", daemonAddr(), "address of the daemon (host:port)")
+	web := fs.Bool("webui", true, "serve: serve the web UI at the address of the daemon")
+	all := fs.Bool("all", false, "select: select every file")
+	deleteData := fs.Bool("data", false, "remove: delete the downloaded files as well")
+	_ = fs.Parse(args)
+	if action == "serve" {
+		return serveDaemon(*addr, *web)
+	}
+
+	remote := daemon.NewRemote(*addr)
+	switch action {
+	case "add":
+		if fs.NArg() == 0 {
+			errorPrint("missing magnet or .torrent file")
+			return 2
+		}
+		code := 0
+		for _, arg := range fs.Args() {
+			var status daemon.Status
+			var err error
+			if strings.HasPrefix(arg, "magnet:") {
+				status, err = remote.AddMagnet(arg)
+			} else {
+				var data []byte
+				if data, err = os.ReadFile(arg); err == nil {
+					status, err = remote.AddTorrentFile(data)
+				}
+			}
+			if err != nil {
+				errorPrint(arg+":", err)
+				code = 1
+				continue
+			}
+			infoPrint(fmt.Sprintf("Added %s %s", status.InfoHash, status.Name))
+		}
+		return code
+
+	case "list":
+		statuses, err := remote.List()
+		if err != nil {
+			errorPrint(err)
+			return 1
+		}
+		printDaemonTorrents(statuses)
+
+	case "show", "url":
+		status, err := findDaemonTorrent(remote, fs.Arg(0))
+		if err != nil {
+			errorPrint(err)
+			return 1
+		}
+		if action == "show" {
+			printDaemonFiles(status)
+			return 0
+		}
+		// Stream URLs of the given files, or of the selected ones
+		for _, file := range status.Files {
+			if fs.NArg() > 1 {
+				if !containsArg(fs.Args()[1:], strconv.Itoa(file.Index)) {
+					continue
+				}
+			} else if !file.Selected {
+				continue
+			}
+			fmt.Println(file.StreamURL)
+		}
+
+	case "select":
+		var files []int
+		if !*all {
+			files = []int{}
+			for _, arg := range fs.Args()[min(1, fs.NArg()):] {
+				index, err := strconv.Atoi(arg)
+				if err != nil {
+					errorPrint("invalid file index:", arg)
+					return 2
+				}
+				files = append(files, index)
+			}
+		}
+		status, err := findDaemonTorrent(remote, fs.Arg(0))
+		if err == nil {
+			status, err = remote.SelectFiles(status.InfoHash, files)
+		}
+		if err != nil {
+			errorPrint(err)
+			return 1
+		}
+		printDaemonFiles(status)
+
+	case "pause", "resume":
+		status, err := findDaemonTorrent(remote, fs.Arg(0))
+		if err == nil {
+			if action == "pause" {
+				status, err = remote.Pause(status.InfoHash)
+			} else {
+				status, err = remote.Resume(status.InfoHash)
+			}
+		}
+		if err != nil {
+			errorPrint(err)
+			return 1
+		}
+		infoPrint(fmt.Sprintf("%s %s: %s", status.InfoHash, status.Name, status.State))
+
+	case "remove":
+		status, err := findDaemonTorrent(remote, fs.Arg(0))
+		if err == nil {
+			err = remote.Remove(status.InfoHash, *deleteData)
+		}
+		if err != nil {
+			errorPrint(err)
+			return 1
+		}
+		infoPrint(fmt.Sprintf("Removed %s %s", status.InfoHash, status.Name))
+
+	default:
+		errorPrint("Unknown daemon action:", action)
+		return 2
+	}
+	return 0
+}
+
+// serveDaemon runs the daemon until it is interrupted, with its web UI if {web}.
+func serveDaemon(addr string, web bool) int {
+	limiter, err := ratelimit.FromConfig(configurations)
+	if err != nil {
+		errorPrint("Error in the rate limits of the config:", err)
+		return 1
+	}
+	d, err := daemon.New(daemon.Config{
+		DataDir:                    filepath.Join(dataDir, "daemon"),
+		TorrentPort:                configurations.TorrentPort,
+		Proxy:                      configurations.Proxy,
+		EstablishedConnsPerTorrent: configurations.ECPT,
+		HalfOpenConnsPerTorrent:    configurations.HOCPT,
+		TotalHalfOpenConns:         configurations.THOC,
+		Limiter:                    limiter,
+		FFmpeg:                     configurations.FFmpeg,
+	})
+	if err != nil {
+		errorPrint("Error starting the daemon:", err)
+		return 1
+	}
+	defer d.Close()
+
+	server := &http.Server{Addr: addr, Handler: d.Handler()}
+	if web {
+		limit := configurations.ResultsLimit
+		if limit <= 0 {
+			limit = 100
+		}
+		server.Handler = webui.Handler(d, limit)
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		<-stop
+		_ = server.Close()
+	}()
+
+	infoPrint(fmt.Sprintf("Daemon listening on %s (Ctrl+C to stop)", addr))
+	if !loopback(addr) {
+		infoPrint("The daemon has no authentication: anyone on the network can add, remove and delete its torrents")
+	}
+	if web {
+		infoPrint(fmt.Sprintf("Web UI on %s/", daemon.NewRemote(addr).URL))
+	}
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errorPrint("Error serving the daemon API:", err)
+		return 1
+	}
+	return 0
+}
+
+// findDaemonTorrent returns the torrent of the daemon whose info hash starts with {prefix}.
+func findDaemonTorrent(remote *daemon.Remote, prefix string) (daemon.Status, error) {
+	if prefix == "" {
+		return daemon.Status{}, errors.New("missing info hash")
+	}
+	if len(prefix) == 40 {
+		return remote.Get(prefix)
+	}
+	statuses, err := remote.List()
+	if err != nil {
+		return daemon.Status{}, err
+	}
+	var found []daemon.Status
+	for _, status := range statuses {
+		if strings.HasPrefix(status.InfoHash, strings.ToLower(prefix)) {
+			found = append(found, status)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return daemon.Status{}, fmt.Errorf("%w: %s", daemon.ErrNotFound, prefix)
+	case 1:
+		return found[0], nil
+	}
+	return daemon.Status{}, fmt.Errorf("%d torrents match %s", len(found), prefix)
+}
+
+func containsArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func printDaemonTorrents(statuses []daemon.Status) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Hash", "Name", "State", "Done", "Size", "Peers", "Up"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.BgHiYellowColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.BgHiMagentaColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiGreenColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiCyanColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiBlueColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiRedColor, tablewriter.FgBlackColor},
+	)
+	for _, status := range statuses {
+		name := status.Name
+		if name == "" {
+			name = "(fetching metadata)"
+		}
+		table.Append([]string{
+			status.InfoHash[:8],
+			shorten(name, 50),
+			status.State,
+			fmt.Sprintf("%.1f%%", status.Percent),
+			humanize.Bytes(uint64(status.Size)),
+			strconv.Itoa(status.Peers),
+			humanize.Bytes(uint64(status.Uploaded)),
+		})
+	}
+	table.Render()
+}
+
+func printDaemonFiles(status daemon.Status) {
+	fmt.Println(status.InfoHash, status.Name, "-", status.State)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"#", "File", "Size", "Done", "Selected"})
+	for _, file := range status.Files {
+		selected := ""
+		if file.Selected {
+			selected = "✓"
+		}
+		done := 0.0
+		if file.Size > 0 {
+			done = float64(file.Completed) / float64(file.Size) * 100
+		}
+		table.Append([]string{
+			strconv.Itoa(file.Index),
+			shorten(file.Path, 60),
+			humanize.Bytes(uint64(file.Size)),
+			fmt.Sprintf("%.1f%%", done),
+			selected,
+		})
+	}
+	table.Render()
+}
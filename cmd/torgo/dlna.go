@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo/dlna"
+	"github.com/stl3/torgo/player"
+)
+
+// dlnaPrefix starts the names of the players of the DLNA renderers.
+const dlnaPrefix = "DLNA: "
+
+// discoveryTimeout is how long the DLNA renderers answer the search for.
+const discoveryTimeout = 3 * time.Second
+
+// renderers are the DLNA renderers of the network, searched once in the background by discoverRenderers.
+var renderers struct {
+	once  sync.Once
+	done  chan struct{}
+	found []*dlna.Renderer
+}
+
+// discoverRenderers starts the search of the DLNA renderers, unless it was started already.
+func discoverRenderers() {
+	renderers.once.Do(func() {
+		renderers.done = make(chan struct{})
+		go func() {
+			defer close(renderers.done)
+			found, err := dlna.Discover(discoveryTimeout)
+			if err != nil {
+				logrus.Debugln("DLNA:", err)
+			}
+			renderers.found = found
+		}()
+	})
+}
+
+// dlnaPlayers returns a player for each DLNA renderer of the network, once they are found.
+func dlnaPlayers() []*player.Player {
+	discoverRenderers()
+	<-renderers.done
+	var players []*player.Player
+	for _, r := range renderers.found {
+		players = append(players, dlnaPlayer(r))
+	}
+	return players
+}
+
+// dlnaPlayer returns the player casting to the renderer {r}, until the renderer stops or Ctrl+C.
+func dlnaPlayer(r *dlna.Renderer) *player.Player {
+	return &player.Player{
+		Name: dlnaPrefix + r.Name,
+		Launch: func(p *player.Player, url string, subtitlePath string, title string, start player.Position) error {
+			stop, release := stopOnInterrupt()
+			defer release()
+			infoPrint(fmt.Sprintf("Casting to %s, press Ctrl+C to stop", r.Name))
+			return r.Cast(dlna.Media{
+				URL:          url,
+				Title:        title,
+				SubtitlePath: subtitlePath,
+				Start:        time.Duration(start.Seconds * float64(time.Second)),
+				StartPercent: start.Percent,
+				OnPosition: func(position, duration time.Duration) {
+					if p.OnPosition == nil || duration <= 0 {
+						return
+					}
+					p.OnPosition(player.Position{Seconds: position.Seconds(), Percent: float64(position) / float64(duration) * 100})
+				},
+			}, stop)
+		},
+	}
+}
+
+// stopOnInterrupt returns a channel closed on Ctrl+C, until released: the network players stop their device then.
+func stopOnInterrupt() (<-chan struct{}, func()) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			close(stop)
+		case <-done:
+		}
+	}()
+	return stop, func() {
+		signal.Stop(interrupt)
+		close(done)
+	}
+}
+
+// findRenderer returns the renderer named {name}, or at the description URL {name}.
+func findRenderer(name string) (*dlna.Renderer, error) {
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+		defer cancel()
+		return dlna.NewRenderer(ctx, name)
+	}
+	discoverRenderers()
+	<-renderers.done
+	for _, r := range renderers.found {
+		if strings.EqualFold(r.Name, name) {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no DLNA renderer named %q, see `torgo dlna list`", name)
+}
+
+// dlnaCommand lists the DLNA renderers, and controls their playback.
+func dlnaCommand(args []string) int {
+	action := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("dlna "+action, flag.ExitOnError)
+	title := fs.String("title", "", "play: title shown by the renderer")
+	subtitles := fs.String("sub", "", "play: subtitle file (.srt) sent to the renderer")
+	_ = fs.Parse(args)
+
+	if action == "list" {
+		discoverRenderers()
+		<-renderers.done
+		if len(renderers.found) == 0 {
+			infoPrint("No DLNA renderer found")
+			return 1
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoWrapText(false)
+		table.SetHeader([]string{"Name", "Location"})
+		for _, r := range renderers.found {
+			table.Append([]string{r.Name, r.Location})
+		}
+		table.Render()
+		return 0
+	}
+
+	if fs.NArg() == 0 {
+		errorPrint("missing renderer name")
+		return 2
+	}
+	r, err := findRenderer(fs.Arg(0))
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	switch action {
+	case "play":
+		if fs.NArg() < 2 {
+			// Resumes the playback
+			err = r.Play()
+			break
+		}
+		p := dlnaPlayer(r)
+		p.Start(fs.Arg(1), *subtitles, *title, player.Position{})
+		return 0
+	case "pause":
+		err = r.Pause()
+	case "stop":
+		err = r.Stop()
+	case "seek":
+		var position time.Duration
+		if position, err = time.ParseDuration(fs.Arg(1)); err != nil {
+			errorPrint("invalid position, expected e.g. 1h2m30s:", fs.Arg(1))
+			return 2
+		}
+		err = r.Seek(position)
+	case "status":
+		var state string
+		var position, duration time.Duration
+		if state, err = r.State(); err == nil {
+			position, duration, err = r.Position()
+		}
+		if err == nil {
+			fmt.Printf("%s: %s %s / %s\n", r.Name, state, position, duration)
+		}
+	default:
+		errorPrint("unknown action:", action)
+		return 2
+	}
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo/client"
+	"github.com/stl3/torgo/models"
+	"github.com/stl3/torgo/player"
+)
+
+// Whether a dead source is replaced by another result of the search
+const (
+	failoverAsk = iota
+	failoverAuto
+	failoverOff
+)
+
+// failoverPolicy is set by the Failover configuration and the non-interactive commands.
+var failoverPolicy = failoverAsk
+
+// defaultDeadTimeout is how long the metadata is waited for, and how long the download may not progress,
+// before a source is considered dead, when the config does not say.
+const defaultDeadTimeout = time.Minute
+
+// errDeadSource is returned by startClient when the swarm of the source is dead:
+// its metadata never arrived, or its download stalled.
+var errDeadSource = errors.New("dead source")
+
+// parseFailover returns the failover policy named in the configuration.
+func parseFailover(name string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "ask":
+		return failoverAsk, nil
+	case "auto":
+		return failoverAuto, nil
+	case "off":
+		return failoverOff, nil
+	}
+	return failoverAsk, fmt.Errorf("invalid Failover %q, expected ask, auto or off", name)
+}
+
+// metadataTimeout returns how long the metadata of a torrent is waited for.
+func metadataTimeout() time.Duration {
+	if configurations.MetadataTimeout <= 0 {
+		return defaultDeadTimeout
+	}
+	return time.Duration(configurations.MetadataTimeout) * time.Second
+}
+
+// stallTimeout returns how long the download of a stream may not progress.
+func stallTimeout() time.Duration {
+	if configurations.StallTimeout <= 0 {
+		return defaultDeadTimeout
+	}
+	return time.Duration(configurations.StallTimeout) * time.Second
+}
+
+// stallWatch follows the download of the file streamed by a client, to tell when it stalls.
+type stallWatch struct {
+	c        *client.Client
+	progress atomic.Int64 // when the download last progressed, in unix nanoseconds
+}
+
+// watchStall follows the download of the client until {stop} is closed.
+func watchStall(c *client.Client, stop <-chan struct{}) *stallWatch {
+	w := &stallWatch{c: c}
+	w.progress.Store(time.Now().UnixNano())
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		downloaded := c.Transfer().Downloaded
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			// Nothing to download is no stall: the timeout starts once a wanted piece is missing again (e.g. after a seek)
+			if d := c.Transfer().Downloaded; d != downloaded || !c.Downloading() {
+				downloaded = d
+				w.progress.Store(time.Now().UnixNano())
+			}
+		}
+	}()
+	return w
+}
+
+// stalled returns an errDeadSource if nothing was downloaded for the stall timeout while pieces of the file streamed
+// are wanted (see `client.Client.Downloading`): the file may stay incomplete, behind the position the playback resumed at.
+func (w *stallWatch) stalled() error {
+	if w.c.LargestFile == nil || !w.c.Downloading() {
+		return nil
+	}
+	timeout := stallTimeout()
+	if time.Since(time.Unix(0, w.progress.Load())) < timeout {
+		return nil
+	}
+	return fmt.Errorf("%w: no download progress for %s", errDeadSource, timeout)
+}
+
+// stallMessage returns what to tell when the download stalls during the playback, {quits} being whether torgo
+// closes the player itself (mpv, through its IPC) to switch to another result.
+func stallMessage(err error, quits bool) string {
+	switch {
+	case failoverPolicy == failoverOff:
+		return err.Error()
+	case failoverPolicy == failoverAuto && quits:
+		return fmt.Sprintf("%v, switching to another result", err)
+	}
+	return fmt.Sprintf("%v, close the player to switch to another result", err)
+}
+
+var (
+	qualityPattern = regexp.MustCompile(`(?i)\b(2160p|4k|uhd|1080p|1080i|720p|576p|480p)\b`)
+	yearPattern    = regexp.MustCompile(`\b(19|20)\d{2}\b`)
+	numberPattern  = regexp.MustCompile(`\d+`)
+)
+
+// release is what the title of a result tells about its content.
+type release struct {
+	name    string // words of the title before the year, episode or quality
+	year    string
+	episode string // e.g. s01e02, empty for a movie
+	quality string // e.g. 1080p, empty when unknown
+}
+
+// parseRelease reads the release of a result from its title, e.g. "The.Show.S01E02.1080p.WEB.x264-GRP".
+func parseRelease(title string) release {
+	var r release
+	end := len(title)
+	if loc := qualityPattern.FindStringIndex(title); loc != nil {
+		r.quality = strings.ToLower(title[loc[0]:loc[1]])
+		if r.quality == "4k" || r.quality == "uhd" {
+			r.quality = "2160p"
+		}
+		end = min(end, loc[0])
+	}
+	if loc := episodePattern.FindStringIndex(title); loc != nil {
+		numbers := numberPattern.FindAllString(title[loc[0]:loc[1]], 2)
+		var season, episode int
+		fmt.Sscan(numbers[0], &season)
+		fmt.Sscan(numbers[1], &episode)
+		r.episode = fmt.Sprintf("s%02de%02d", season, episode)
+		end = min(end, loc[0])
+	}
+	// The first year after the start, a title may be a year itself
+	if locs := yearPattern.FindAllStringIndex(title, -1); len(locs) > 0 {
+		loc := locs[0]
+		if loc[0] == 0 && len(locs) > 1 {
+			loc = locs[1]
+		}
+		if loc[0] > 0 {
+			r.year = title[loc[0]:loc[1]]
+			end = min(end, loc[0])
+		}
+	}
+	words := strings.FieldsFunc(strings.ToLower(title[:end]), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	r.name = strings.Join(words, " ")
+	return r
+}
+
+// sameRelease reports whether two releases are the same content at the same quality.
+// The year is only compared when both titles have one.
+func sameRelease(a, b release) bool {
+	return a.name != "" && a.name == b.name && a.episode == b.episode && a.quality == b.quality &&
+		(a.year == "" || b.year == "" || a.year == b.year)
+}
+
+// infoHash returns the info hash of the magnet of a source, empty when it has none.
+func infoHash(source models.Source) string {
+	magnet, err := metainfo.ParseMagnetUri(source.Magnet)
+	if err != nil {
+		return ""
+	}
+	return magnet.InfoHash.HexString()
+}
+
+// alternatives returns the results with the same title and quality as {source}, the most seeded first.
+func alternatives(source models.Source, results []models.Source) []models.Source {
+	want := parseRelease(source.Title)
+	var found []models.Source
+	for _, result := range results {
+		if result.URL == source.URL && result.From == source.From && result.Magnet == source.Magnet {
+			continue
+		}
+		if sameRelease(want, parseRelease(result.Title)) {
+			found = append(found, result)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Seeders > found[j].Seeders
+	})
+	return found
+}
+
+// streamFailover streams {source} as startClient does. When its swarm is dead, the next alternative of the source
+// in {results} is streamed instead, with the same player and subtitles, as the failover policy says.
+// The subtitles are deleted once the last source streamed is dead too.
+func streamFailover(p *player.Player, source models.Source, subtitlePath string, results []models.Source) error {
+	candidates := alternatives(source, results)
+	tried := map[string]bool{infoHash(source): true}
+	for {
+		err := startClient(p, source, subtitlePath)
+		if !errors.Is(err, errDeadSource) {
+			return err
+		}
+		if failoverPolicy == failoverOff || len(candidates) == 0 {
+			removeSubtitles()
+			return err
+		}
+		errorPrint(fmt.Sprintf("%s: %v", source.Title, err))
+
+		var next *models.Source
+		for len(candidates) > 0 && next == nil {
+			candidate := candidates[0]
+			candidates = candidates[1:]
+			if err := candidate.ResolveMagnet(); err != nil {
+				logrus.Debugln(err)
+				continue
+			}
+			hash := infoHash(candidate)
+			if hash == "" || tried[hash] {
+				continue
+			}
+			tried[hash] = true
+			next = &candidate
+		}
+		if next == nil {
+			removeSubtitles()
+			return errors.New("no other result with the same title and quality to switch to")
+		}
+		if failoverPolicy == failoverAsk {
+			switchSource := true
+			prompt := &survey.Confirm{
+				Message: fmt.Sprintf("Switch to %s (%d seeders, from %s)?", next.Title, next.Seeders, next.From),
+				Default: true,
+			}
+			if err := survey.AskOne(prompt, &switchSource, nil); err != nil || !switchSource {
+				removeSubtitles()
+				return nil
+			}
+		}
+		infoPrint(fmt.Sprintf("Switching to %s (%d seeders, from %s)", next.Title, next.Seeders, next.From))
+		source = *next
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+
+	"github.com/stl3/torgo/client"
+)
+
+// resumedClient returns a client streaming a file of 16 pieces resumed at 50%, whose second half is downloaded.
+func resumedClient(t *testing.T) *client.Client {
+	t.Helper()
+	const pieceLength, pieces = 16 << 10, 16
+	data := make([]byte, pieces*pieceLength)
+	rand.New(rand.NewSource(1)).Read(data)
+	source := filepath.Join(t.TempDir(), "movie.ts")
+	if err := os.WriteFile(source, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo.Info{PieceLength: pieceLength}
+	if err := info.BuildFromFilePath(source); err != nil {
+		t.Fatal(err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDir := t.TempDir()
+	partial := append(make([]byte, len(data)/2), data[len(data)/2:]...)
+	if err := os.WriteFile(filepath.Join(dataDir, "movie.ts"), partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := torrent.NewDefaultClientConfig()
+	config.DataDir = dataDir
+	config.ListenPort = 0
+	config.NoDHT = true
+	config.DisableTrackers = true
+	config.NoDefaultPortForwarding = true
+	cl, err := torrent.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+	tt, err := cl.AddTorrent(&metainfo.MetaInfo{InfoBytes: infoBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-tt.GotInfo()
+	tt.VerifyData()
+
+	c := &client.Client{Client: cl, Torrent: tt}
+	file := tt.Files()[0]
+	c.SetFile(file)
+	c.PrioritizeOffset(file, file.Length()/2)
+	return c
+}
+
+func TestStalledResumedToTheEnd(t *testing.T) {
+	c := resumedClient(t)
+	w := &stallWatch{c: c}
+	w.progress.Store(time.Now().Add(-2 * stallTimeout()).UnixNano())
+
+	// Nothing is downloaded anymore, though the file is incomplete: the stream is healthy
+	if file := c.LargestFile; file.BytesCompleted() >= file.Length() {
+		t.Fatal("file complete")
+	}
+	if err := w.stalled(); err != nil {
+		t.Errorf("stalled: %v, once the file is downloaded from the resume position to its end", err)
+	}
+
+	// The file played from its start again wants the missing first half, which does not come
+	c.SetFile(c.LargestFile)
+	if err := w.stalled(); !errors.Is(err, errDeadSource) {
+		t.Errorf("stalled: %v, want errDeadSource", err)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/anacrolix/torrent"
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/stl3/torgo/client"
+	"github.com/stl3/torgo/history"
+	"github.com/stl3/torgo/models"
+	"github.com/stl3/torgo/player"
+)
+
+// recordWatch adds the stream of the client to the watch history and returns the ID of the entry (0 on failure).
+// It must be called once the file to stream is known.
+func recordWatch(c *client.Client, playerName string) int {
+	title := c.Source.Title
+	if title == "" || title == "Unknown" {
+		title = c.Torrent.Name()
+	}
+	entry, err := history.Record(history.Entry{
+		InfoHash: c.Torrent.InfoHash().HexString(),
+		Magnet:   c.Source.Magnet,
+		Title:    title,
+		Provider: c.Source.From,
+		URL:      c.Source.URL,
+		File:     c.LargestFile.DisplayPath(),
+		FileSize: c.LargestFile.Length(),
+		Player:   playerName,
+		Started:  time.Now(),
+	})
+	if err != nil {
+		errorPrint("Error recording the watch history:", err)
+		return 0
+	}
+	return entry.ID
+}
+
+// finishWatch records the end of the stream of the client in its history entry,
+// and where the playback stopped so that it can be resumed.
+// {playback} is where the player reported it stopped, the last read of the player is used if it is unknown.
+func finishWatch(id int, c *client.Client, playback player.Position) {
+	if c.LargestFile == nil {
+		return
+	}
+	position := history.Position{
+		InfoHash: c.Torrent.InfoHash().HexString(),
+		File:     c.LargestFile.DisplayPath(),
+	}
+	if playback.Seconds > 0 {
+		position.Seconds = playback.Seconds
+		position.Percent = playback.Percent
+		position.Offset = int64(playback.Percent / 100 * float64(c.LargestFile.Length()))
+	} else {
+		position.Offset = c.ReadPosition()
+		position.Percent = float64(position.Offset) / float64(c.LargestFile.Length()) * 100
+	}
+	err := history.RecordPosition(position)
+	if err != nil {
+		errorPrint("Error recording the playback position:", err)
+	}
+
+	if id == 0 {
+		return
+	}
+	err = history.Update(id, func(entry *history.Entry) {
+		entry.Ended = time.Now()
+		entry.BytesWatched = c.BytesServed()
+	})
+	if err != nil {
+		errorPrint("Error recording the watch history:", err)
+	}
+}
+
+// Whether a stream stopped halfway is resumed
+const (
+	resumeAsk = iota
+	resumeAlways
+	resumeNever
+)
+
+// resumePolicy is set by the non-interactive commands, the wizard asks.
+var resumePolicy = resumeAsk
+
+// resumeRewind is how far back (in percent of the file) a playback resumed from a read offset starts,
+// as the player had read ahead of what it played.
+const resumeRewind = 1.0
+
+// resumePosition returns where the player should start the file of the client: where it stopped last time
+// if the user wants to resume, the beginning otherwise. The pieces at that position are prioritized.
+func resumePosition(c *client.Client, p *player.Player) player.Position {
+	if resumePolicy == resumeNever {
+		return player.Position{}
+	}
+	store, err := history.Load()
+	if err != nil {
+		errorPrint("Error loading the watch history:", err)
+		return player.Position{}
+	}
+	stopped, ok := store.Position(c.Torrent.InfoHash().HexString(), c.LargestFile.DisplayPath())
+	if !ok {
+		return player.Position{}
+	}
+	start := player.Position{Seconds: stopped.Seconds, Percent: stopped.Percent}
+	offset := stopped.Offset
+	if start.Seconds <= 0 {
+		start.Percent = math.Max(0, start.Percent-resumeRewind)
+		offset = int64(start.Percent / 100 * float64(c.LargestFile.Length()))
+	}
+	if !p.CanStartAt(start) {
+		infoPrint(p.Name, "can not start at a given position, playing from the beginning")
+		return player.Position{}
+	}
+
+	if resumePolicy == resumeAsk {
+		at := fmt.Sprintf("%.1f%%", start.Percent)
+		if start.Seconds > 0 {
+			at = (time.Duration(start.Seconds) * time.Second).String()
+		}
+		resume := true
+		prompt := &survey.Confirm{
+			Message: fmt.Sprintf("Resume %s at %s (stopped %s)?", c.LargestFile.DisplayPath(), at, humanize.Time(stopped.Updated)),
+			Default: true,
+		}
+		if err := survey.AskOne(prompt, &resume, nil); err != nil || !resume {
+			return player.Position{}
+		}
+	}
+	c.PrioritizeOffset(c.LargestFile, offset)
+	return start
+}
+
+func historyCommand(args []string) int {
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	store, err := history.Load()
+	if err != nil {
+		errorPrint("Error loading the watch history:", err)
+		return 1
+	}
+
+	switch action {
+	case "list":
+		fs := flag.NewFlagSet("history list", flag.ExitOnError)
+		count := fs.Int("n", 20, "number of entries to list, 0 for all")
+		_ = fs.Parse(args)
+		entries := store.Search("")
+		if *count > 0 && len(entries) > *count {
+			entries = entries[:*count]
+		}
+		printHistory(entries)
+
+	case "search":
+		query := strings.Join(args, " ")
+		if strings.TrimSpace(query) == "" {
+			errorPrint("missing search text")
+			return 2
+		}
+		entries := store.Search(query)
+		if len(entries) == 0 {
+			errorPrint("No entry matches", query)
+			return 1
+		}
+		printHistory(entries)
+
+	case "replay":
+		fs := flag.NewFlagSet("history replay", flag.ExitOnError)
+		playerName := fs.String("player", "", "player to launch, or 'none' to only serve the stream (default: the player used last time)")
+		subLang := fs.String("sub-lang", "", "comma separated subtitle languages (e.g. eng,fre), the first subtitle found is used")
+		resume := fs.Bool("resume", true, "resume the playback where it stopped last time")
+		keep := fs.Bool("keep", configurations.KeepDownloads, "keep the files, finishing their download once the player is closed")
+		_ = fs.Parse(args)
+		resumePolicy = resumeNever
+		if *resume {
+			resumePolicy = resumeAlways
+		}
+		keepPolicy = keepNever
+		if *keep {
+			keepPolicy = keepAlways
+		}
+		id, err := strconv.Atoi(fs.Arg(0))
+		if err != nil {
+			errorPrint("missing or invalid entry ID")
+			return 2
+		}
+		entry, ok := store.Get(id)
+		if !ok {
+			errorPrint("No history entry", id)
+			return 1
+		}
+		source := models.Source{From: entry.Provider, Title: entry.Title, URL: entry.URL, Magnet: entry.Magnet}
+		if source.Magnet == "" {
+			source.Magnet = "magnet:?xt=urn:btih:" + entry.InfoHash
+		}
+		if *playerName == "" {
+			*playerName = entry.Player
+		}
+		return streamSource(source, nil, *playerName, *subLang, fileNamed(entry.File))
+
+	case "delete":
+		fs := flag.NewFlagSet("history delete", flag.ExitOnError)
+		all := fs.Bool("all", false, "delete every entry")
+		_ = fs.Parse(args)
+		var ids []int
+		if *all {
+			for _, entry := range store.Entries {
+				ids = append(ids, entry.ID)
+			}
+		} else {
+			for _, arg := range fs.Args() {
+				id, err := strconv.Atoi(arg)
+				if err != nil {
+					errorPrint("invalid entry ID:", arg)
+					return 2
+				}
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			errorPrint("missing entry IDs (or -all)")
+			return 2
+		}
+		removed := 0
+		err := history.Change(func(store *history.Store) {
+			removed = store.Delete(ids...)
+		})
+		if err != nil {
+			errorPrint("Error saving the watch history:", err)
+			return 1
+		}
+		infoPrint(fmt.Sprintf("Deleted %d entries", removed))
+
+	default:
+		errorPrint("Unknown history action:", action)
+		return 2
+	}
+	return 0
+}
+
+func printHistory(entries []history.Entry) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"ID", "Date", "Title", "File", "From", "Player", "Watched", "Time"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.BgHiYellowColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiBlueColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.BgHiCyanColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiMagentaColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiGreenColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiBlueColor, tablewriter.FgBlackColor},
+	)
+	for _, entry := range entries {
+		watched := humanize.Bytes(uint64(entry.BytesWatched))
+		if entry.FileSize > 0 {
+			watched += fmt.Sprintf(" (%.0f%%)", float64(entry.BytesWatched)/float64(entry.FileSize)*100)
+		}
+		duration := "-"
+		if d := entry.Duration(); d > 0 {
+			duration = d.Round(time.Second).String()
+		}
+		table.Append([]string{
+			strconv.Itoa(entry.ID),
+			entry.Started.Format("2006-01-02 15:04"),
+			shorten(entry.Title, 45),
+			shorten(entry.File, 35),
+			entry.Provider,
+			entry.Player,
+			watched,
+			duration,
+		})
+	}
+	table.Render()
+}
+
+// shorten truncates s to {max} characters.
+func shorten(s string, max int) string {
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-3]) + "..."
+	}
+	return s
+}
+
+// fileNamed returns a non-interactive `client.ChooseFile` picking the file with the given path,
+// or the largest candidate if the torrent has no such file.
+func fileNamed(path string) func(*client.Client) func([]*torrent.File) *torrent.File {
+	return func(c *client.Client) func([]*torrent.File) *torrent.File {
+		largest := fileChooser(0)(c)
+		return func(files []*torrent.File) *torrent.File {
+			for _, file := range c.Torrent.Files() {
+				if file.DisplayPath() == path {
+					return file
+				}
+			}
+			return largest(files)
+		}
+	}
+}
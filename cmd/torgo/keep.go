@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/anacrolix/torrent"
+
+	"github.com/stl3/torgo/client"
+)
+
+// Whether the files of a stream are kept once the player is closed
+const (
+	keepAsk = iota
+	keepAlways
+	keepNever
+)
+
+// keepPolicy is set by the KeepDownloads configuration and the non-interactive commands, the wizard asks.
+var keepPolicy = keepAsk
+
+// libraryDir is where the kept files are moved once downloaded, empty to leave them in the data directory.
+var libraryDir string
+
+// keepDownloads reports whether the files of the stream are kept.
+func keepDownloads(c *client.Client) bool {
+	switch keepPolicy {
+	case keepAlways:
+		return true
+	case keepNever:
+		return false
+	}
+	keep := false
+	prompt := &survey.Confirm{
+		Message: fmt.Sprintf("Keep %s (its download is finished first)?", c.LargestFile.DisplayPath()),
+		Default: false,
+	}
+	if err := survey.AskOne(prompt, &keep, nil); err != nil {
+		return false
+	}
+	return keep
+}
+
+// finishDownloads downloads the rest of the files streamed, until Ctrl+C is pressed,
+// and reports whether they are complete.
+func finishDownloads(files []*torrent.File) bool {
+	var total int64
+	for _, file := range files {
+		file.Download()
+		total += file.Length()
+	}
+	completed := func() int64 {
+		var done int64
+		for _, file := range files {
+			done += file.BytesCompleted()
+		}
+		return done
+	}
+	if completed() >= total {
+		return true
+	}
+
+	infoPrint("Finishing the download, press Ctrl+C to stop and keep the partial files...")
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	complete := waitDownload(completed, total, stop)
+	fmt.Print("\n")
+	return complete
+}
+
+// organizeDownloads keeps the files streamed from the torrent {tn} and deletes its other files. Once {complete},
+// the files are moved into the library, if any. The subtitle is kept next to the file {played}, with its name.
+func organizeDownloads(tn string, files []*torrent.File, played *torrent.File, subtitlePath string, complete bool) {
+	kept := map[string]bool{}
+	for _, file := range files {
+		kept[downloadPath(file)] = true
+	}
+	torrentDir := filepath.Join(dataDir, tn)
+	_ = filepath.Walk(torrentDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && !kept[path] {
+			if err := os.Remove(path); err != nil {
+				errorPrint("Error deleting file:", err)
+			}
+		}
+		return nil
+	})
+
+	dir := dataDir
+	if complete && libraryDir != "" {
+		dir = libraryDir
+		for _, file := range files {
+			target := filepath.Join(libraryDir, filepath.FromSlash(file.Path()))
+			if err := moveFile(downloadPath(file), target); err != nil {
+				errorPrint("Error moving to the library:", err)
+				dir = dataDir
+				continue
+			}
+			infoPrint("Moved to", target)
+		}
+		if dir == libraryDir {
+			_ = os.RemoveAll(torrentDir)
+		}
+	} else {
+		for _, file := range files {
+			infoPrint("Kept", downloadPath(file))
+		}
+	}
+
+	if subtitlePath != "" && played != nil {
+		video := filepath.Join(dir, filepath.FromSlash(played.Path()))
+		target := strings.TrimSuffix(video, filepath.Ext(video)) + filepath.Ext(subtitlePath)
+		if err := moveFile(subtitlePath, target); err != nil {
+			errorPrint("Error keeping the subtitles:", err)
+		}
+	}
+}
+
+// downloadPath returns where a file of a torrent is downloaded.
+func downloadPath(file *torrent.File) string {
+	return filepath.Join(dataDir, filepath.FromSlash(file.Path()))
+}
+
+// moveFile moves a file, creating the directory of {target}. Across file systems the file is copied, then removed.
+func moveFile(source, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(source, target); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return errors.Join(err, os.Remove(target))
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(source)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/stl3/torgo/daemon"
+	"github.com/stl3/torgo/ratelimit"
+)
+
+// limitsCommand prints or changes the rate limits of a running stream session, or of the daemon.
+func limitsCommand(args []string) int {
+	fs := flag.NewFlagSet("limits", flag.ExitOnError)
+	download := fs.String("download", "", "download rate limit per second (e.g. 2MB, 0 for no limit)")
+	upload := fs.String("upload", "", "upload rate limit per second (e.g. 500kB, 0 for no limit)")
+	reset := fs.Bool("reset", false, "go back to the limits of the configuration")
+	toDaemon := fs.Bool("daemon", false, "change the limits of the daemon instead of the stream session")
+	addr := fs.String("addr", "", "address of the stream session or daemon (default: localhost:HostPort, or DaemonAddr with -daemon)")
+	_ = fs.Parse(args)
+
+	address := *addr
+	if address == "" {
+		address = ":" + strconv.Itoa(configurations.HostPort)
+		if *toDaemon {
+			address = daemonAddr()
+		}
+	}
+	baseURL := daemon.NewRemote(address).URL
+
+	change := ratelimit.Change{Reset: *reset}
+	for _, r := range []struct {
+		text  string
+		value **int64
+	}{{*download, &change.Download}, {*upload, &change.Upload}} {
+		if r.text == "" {
+			continue
+		}
+		rate, err := ratelimit.ParseRate(r.text)
+		if err != nil {
+			errorPrint(err)
+			return 2
+		}
+		*r.value = &rate
+	}
+
+	var status ratelimit.Status
+	var err error
+	if change == (ratelimit.Change{}) {
+		status, err = ratelimit.Get(baseURL)
+	} else {
+		status, err = ratelimit.Update(baseURL, change)
+	}
+	if err != nil {
+		errorPrint(fmt.Sprintf("Error reaching %s (is a stream or `torgo daemon` running?): %v", baseURL, err))
+		return 1
+	}
+
+	fmt.Printf("Download: %s\nUpload:   %s\n", ratelimit.FormatRate(status.Download), ratelimit.FormatRate(status.Upload))
+	if status.Schedule != "" {
+		state := "normal"
+		if status.Alternative {
+			state = "alternative"
+		}
+		fmt.Printf("Schedule: alternative limits %s (%s limits now)\n", status.Schedule, state)
+	}
+	if status.Overridden {
+		fmt.Println("Changed while running, until the schedule switches or -reset")
+	}
+	return 0
+}
@@ -1,18 +1,13 @@
 package main
 
 import (
-	"archive/zip"
-	"bufio"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"os/user"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -24,17 +19,16 @@ import (
 	"github.com/fatih/color"
 	"github.com/olekukonko/tablewriter"
 
-	"github.com/oz/osdb"
 	"github.com/sirupsen/logrus"
 
-	// "github.com/stl3/osdb"
-
 	// "gopkg.in/AlecAivazis/survey.v1"
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/anacrolix/torrent"
 
 	"github.com/stl3/torgo"
 	"github.com/stl3/torgo/client"
 	"github.com/stl3/torgo/config"
+	"github.com/stl3/torgo/history"
 	"github.com/stl3/torgo/models"
 	"github.com/stl3/torgo/player"
 )
@@ -48,7 +42,9 @@ var configurations config.TorgoConfig
 
 var dataDir string
 var subtitlesDir string
-var tmagnet string
+
+// chooseFile makes the file choice of a client non-interactive when set, see `fileChooser`.
+var chooseFile func(c *client.Client) func([]*torrent.File) *torrent.File
 
 func errorPrint(arg ...interface{}) {
 	c := color.New(color.FgHiRed).Add(color.Bold)
@@ -62,37 +58,48 @@ func infoPrint(arg ...interface{}) {
 	_, _ = c.Println(arg...)
 }
 
-func pickCategory() string {
+// pickCategory asks for the category to search in. {back} is the label of the option going back (`errBack`).
+func pickCategory(back string) (string, error) {
 	category := ""
 	prompt := &survey.Select{
 		Message: "Choose a category:",
-		Options: []string{"All", "Movie", "TV", "Anime", "Porn", "Audiobook", "Documentaries"},
+		Options: []string{"All", "Movie", "TV", "Anime", "Porn", "Audiobook", "Documentaries", back},
 	}
-	err := survey.AskOne(prompt, &category, nil)
-	if err != nil {
-		// Handle the error (e.g., print a message or return a default category)
-		fmt.Println("Error selecting category:", err)
-		return "All" // Default to "All" category in case of error
+	if err := survey.AskOne(prompt, &category, nil); err != nil {
+		return "", err
 	}
-	return category
+	if category == back {
+		return "", errBack
+	}
+	return category, nil
 }
 
-func pickProviders(options []string) []interface{} {
+func pickProviders(options []string) ([]interface{}, error) {
 	var providers []interface{}
+	// Providers which failed their last health check are greyed out
+	labels, byLabel := providerLabels(options)
+	labels = append(labels, backOption)
 
 	for {
 		var chosen []string
 		prompt := &survey.MultiSelect{
 			Message: "Choose providers [use ? for help]:",
-			Options: options,
-			Help:    "[Use arrows to move, space to select checkbox, type to filter, enter when done]",
+			Options: labels,
+			Help:    "[Use arrows to move, space to select checkbox, type to filter, enter when done] (broken) providers failed `torgo providers check`",
+		}
+		if err := survey.AskOne(prompt, &chosen, nil); err != nil {
+			return nil, err
 		}
-		_ = survey.AskOne(prompt, &chosen, nil)
 
+		for _, choice := range chosen {
+			if choice == backOption {
+				return nil, errBack
+			}
+		}
 		if len(chosen) > 0 {
 			for _, choice := range chosen {
 				for _, provider := range torgo.AllProviders {
-					if provider.GetName() == choice {
+					if provider.GetName() == byLabel[choice] {
 						providers = append(providers, provider)
 					}
 				}
@@ -103,10 +110,10 @@ func pickProviders(options []string) []interface{} {
 		}
 	}
 
-	return providers
+	return providers, nil
 }
 
-func inputQuery() string {
+func inputQuery() (string, error) {
 	query := ""
 	// prompt := &survey.Input{Message: "Search Torrents:"}
 	prompt := &survey.Input{
@@ -116,43 +123,131 @@ func inputQuery() string {
 				"- Do the same for TV Shows.\n"+
 				"- tv.show.s01e01\n"+
 				"- movie.name.2023\n") +
+			color.HiBlackString("(leave empty to go back)\n") +
 			color.HiGreenString("Search Torrents:"),
 	}
-	_ = survey.AskOne(prompt, &query, nil)
+	if err := survey.AskOne(prompt, &query, nil); err != nil {
+		return "", err
+	}
 
 	// // Properly encode the search query
 	// query = url.QueryEscape(query)
 	// fmt.Println(query)
-	return query
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "", errBack
+	}
+	return query, nil
 }
 
-func pickSortBy() string {
+func pickSortBy() (string, error) {
 	sortBy := ""
 	prompt := &survey.Select{
 		Message: "Sort by:",
 		Default: "default",
-		Options: []string{"default", "seeders", "leechers", "size"},
+		Options: []string{"default", "seeders", "leechers", "size", backOption},
+	}
+	if err := survey.AskOne(prompt, &sortBy, nil); err != nil {
+		return "", err
+	}
+	if sortBy == backOption {
+		return "", errBack
+	}
+	return sortBy, nil
+}
+
+// discoverNetworkPlayers starts the search of the devices of the network the streams can be played on.
+func discoverNetworkPlayers() {
+	discoverRenderers()
+	discoverCastDevices()
+}
+
+// networkPlayers returns a player for each device of the network, once they are found: DLNA renderers and Chromecasts.
+func networkPlayers() []*player.Player {
+	return append(dlnaPlayers(), castPlayers()...)
+}
+
+// lookupPlayer returns the player named {name}: a player of `player.Players`, or a device of the network
+// by its name, with or without the prefix of its kind (e.g. "DLNA: ").
+func lookupPlayer(name string) *player.Player {
+	if p := player.GetPlayer(name); p != nil {
+		return p
+	}
+	for _, p := range networkPlayers() {
+		_, device, _ := strings.Cut(p.Name, ": ")
+		if strings.EqualFold(p.Name, name) || strings.EqualFold(device, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// findPlayer returns the player named {name}, if it is installed.
+func findPlayer(name string) (*player.Player, error) {
+	p := lookupPlayer(name)
+	if p == nil {
+		return nil, fmt.Errorf("unknown player: %s", name)
+	}
+	if p.Launch == nil && !p.Installed {
+		return nil, fmt.Errorf("%s is not installed, it is neither in the PATH nor in its usual locations", p.Name)
+	}
+	return p, nil
+}
+
+// defaultPlayer returns the name of the player preselected: DefaultPlayer of the configuration, or the last one used.
+func defaultPlayer() string {
+	if configurations.DefaultPlayer != "" {
+		return configurations.DefaultPlayer
+	}
+	store, err := history.Load()
+	if err != nil {
+		logrus.Debugln(err)
+		return ""
+	}
+	for i := len(store.Entries) - 1; i >= 0; i-- {
+		if name := store.Entries[i].Player; name != "" && name != "none" {
+			return name
+		}
 	}
-	_ = survey.AskOne(prompt, &sortBy, nil)
-	return sortBy
+	return ""
 }
 
-func pickPlayer() string {
+// pickPlayer asks for one of the players installed, or of the devices of the network.
+func pickPlayer() (string, error) {
 	options := []string{"None"}
 	playerChoice := ""
-	for _, p := range player.Players {
+	for _, p := range player.Available() {
 		options = append(options, p.Name)
 	}
+	for _, p := range networkPlayers() {
+		options = append(options, p.Name)
+	}
+	if len(options) == 1 {
+		infoPrint("No player found: install mpv or VLC, or define one in the config (see Custom players in CLI.md)")
+	}
 	fmt.Println(color.HiYellowString("Select None for standalone server"))
 
 	prompt := &survey.Select{
 		Message: "Player:",
-		Options: options,
+		Options: append(options, backOption),
 	}
-	_ = survey.AskOne(prompt, &playerChoice, nil)
-	return playerChoice
+	if name := defaultPlayer(); name != "" {
+		for _, option := range options {
+			if strings.EqualFold(option, name) {
+				prompt.Default = option
+			}
+		}
+	}
+	if err := survey.AskOne(prompt, &playerChoice, nil); err != nil {
+		return "", err
+	}
+	if playerChoice == backOption {
+		return "", errBack
+	}
+	return playerChoice, nil
 }
 
+// chooseResults prints the results as a table and asks for the number of one, "" to go back.
 func chooseResults(results []models.Source) string {
 	// Create table
 	table := tablewriter.NewWriter(os.Stdout)
@@ -202,304 +297,37 @@ func chooseResults(results []models.Source) string {
 
 	table.Render()
 
-	// Prompt choice
+	// Prompt choice, empty or "b" to go back
 	choice := ""
 	question := &survey.Question{
-		Prompt: &survey.Input{Message: "Choice(#):"},
+		Prompt: &survey.Input{Message: "Choice(#), or b / enter to go back:"},
 		Validate: func(val interface{}) error {
-			index, err := strconv.Atoi(val.(string))
+			input := strings.TrimSpace(val.(string))
+			if input == "" || strings.EqualFold(input, "b") {
+				return nil
+			}
+			index, err := strconv.Atoi(input)
 			if err != nil {
-				return fmt.Errorf("input must be numbers")
+				return fmt.Errorf("input must be numbers, or b to go back")
 			} else if index < 1 || index > len(results) {
 				return fmt.Errorf("input range exceeded (1-%d)", len(results))
 			}
 			return nil
 		},
 	}
-	_ = survey.Ask([]*survey.Question{question}, &choice)
-	return choice
-}
-
-func pickLangs() []string {
-	languagesMap := map[string]string{
-		"English":               "eng",
-		"Chinese (traditional)": "zht",
-		"Chinese (simplified)":  "chi",
-		"Arabic":                "ara",
-		"Hindi":                 "hin",
-		"Dutch":                 "dut",
-		"French":                "fre",
-		"Portuguese":            "por",
-		"Russian":               "rus",
-	}
-	var languagesOpts []string
-	for k := range languagesMap {
-		languagesOpts = append(languagesOpts, k)
-	}
-
-	var chosen []string
-	prompt := &survey.MultiSelect{
-		Message: "Choose subtitles languages:",
-		Default: []string{"English"},
-		Options: languagesOpts,
-	}
-	_ = survey.AskOne(prompt, &chosen, nil)
-
-	var languages []string
-	for _, choice := range chosen {
-		languages = append(languages, languagesMap[choice])
-	}
-	return languages
-}
-
-func chooseSubtitles(subtitles osdb.Subtitles) string {
-	// Create table
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetAutoWrapText(false)
-	table.SetHeader([]string{"#", "Name", "Lang", "Fmt", "HI", "Size"})
-	table.SetHeaderColor(
-		tablewriter.Colors{tablewriter.BgHiYellowColor, tablewriter.FgBlackColor},
-		tablewriter.Colors{tablewriter.Bold},
-		tablewriter.Colors{tablewriter.BgHiCyanColor, tablewriter.FgBlackColor},
-		tablewriter.Colors{tablewriter.BgHiMagentaColor, tablewriter.FgBlackColor},
-		tablewriter.Colors{tablewriter.BgHiBlueColor, tablewriter.FgBlackColor},
-		tablewriter.Colors{tablewriter.BgYellowColor, tablewriter.FgBlackColor},
-	)
-	table.SetColumnColor(
-		tablewriter.Colors{tablewriter.FgHiYellowColor},
-		tablewriter.Colors{}, // name
-		tablewriter.Colors{tablewriter.FgHiCyanColor},
-		tablewriter.Colors{tablewriter.FgHiMagentaColor},
-		tablewriter.Colors{}, // hi
-		tablewriter.Colors{tablewriter.FgYellowColor},
-	)
-	for i, sub := range subtitles {
-		// hearing impaired
-		var hiSymbol string
-		hi, _ := strconv.Atoi(sub.SubHearingImpaired)
-		if hi != 0 {
-			hiSymbol = color.HiGreenString("Y")
-		} else {
-			hiSymbol = color.HiRedString("N")
-		}
-		// name
-		name := strings.TrimSpace(sub.MovieReleaseName)
-		if len(name) > 42 {
-			name = name[:39] + "..."
-		}
-		// size
-		size, _ := strconv.ParseUint(sub.SubSize, 10, 0)
-
-		table.Append([]string{strconv.Itoa(i + 1), name, sub.SubLanguageID, sub.SubFormat, hiSymbol, humanize.Bytes(size)})
+	if err := survey.Ask([]*survey.Question{question}, &choice); err != nil {
+		return ""
 	}
-	table.Render()
-
-	// Prompt choice
-	choice := ""
-	question := &survey.Question{
-		Prompt: &survey.Input{Message: "Choice(#):"},
-		Validate: func(val interface{}) error {
-			index, err := strconv.Atoi(val.(string))
-			if err != nil {
-				return fmt.Errorf("input must be numbers")
-			} else if index < 1 || index > len(subtitles) {
-				return fmt.Errorf("input range exceeded (1-%d)", len(subtitles))
-			}
-			return nil
-		},
+	choice = strings.TrimSpace(choice)
+	if strings.EqualFold(choice, "b") {
+		return ""
 	}
-	_ = survey.Ask([]*survey.Question{question}, &choice)
 	return choice
 }
 
-func getSubtitles(query string) (subtitlePath string) {
-	// yes or no
-	need := false
-	prompt := &survey.Confirm{
-		Message: "Need subtitles?",
-	}
-	_ = survey.AskOne(prompt, &need, nil)
-	// if need == false {
-	// 	return
-	// }
-	if !need {
-		return
-	}
-
-	// pick subtitle languages
-	langs := pickLangs()
-	c, _ := osdb.NewClient()
-	if err := c.LogIn("", "", ""); err != nil {
-		errorPrint(err)
-		os.Exit(1)
-	}
-	// search subtitles
-	langstr := strings.Join(langs, ",")
-	params := []interface{}{
-		c.Token,
-		[]struct {
-			Query string `xmlrpc:"query"`
-			Langs string `xmlrpc:"sublanguageid"`
-		}{{
-			query,
-			langstr,
-		}},
-	}
-	subtitles, err := c.SearchSubtitles(&params)
-	if err != nil {
-		errorPrint(err)
-		os.Exit(1)
-	}
-	if len(subtitles) == 0 {
-		errorPrint("No subtitles found")
-		return
-	}
-	// choose subtitles
-	choice := chooseSubtitles(subtitles)
-	index, _ := strconv.Atoi(choice)
-	subtitle := subtitles[index-1]
-	// Define a regular expression pattern for matching URLs
-	urlPattern := regexp.MustCompile(`https://[^\s]+`)
-
-	// Find all matches in the SubDownloadLink field
-	matches := urlPattern.FindAllString(subtitle.ZipDownloadLink, -1)
-
-	// Get the last URL
-	var lastURL string
-	if len(matches) > 0 {
-		lastURL = matches[len(matches)-1]
-	}
-	// Print the result
-	fmt.Println("Last URL:", lastURL)
-
-	// download
-	fmt.Println(color.HiYellowString("[i] Downloading subtitle to"), subtitlesDir)
-	subtitlePath = filepath.Join(subtitlesDir, subtitle.SubFileName)
-	// err = c.DownloadTo(&subtitle, subtitlePath)
-	err = downloadAndExtractSubtitle(subtitle, subtitlePath)
-	// err = parseAndDownloadSubtitle(subtitle, subtitlesDir)
-	fmt.Println(color.HiYellowString("[i] SubtitlePath: "), subtitlePath)
-	// fmt.Println(color.HiYellowString("[i] Subtitle: "), &subtitle)
-	if err != nil {
-		// errorPrint(err)
-		// os.Exit(1)
-		fmt.Println(color.HiRedString("Error downloading subtitle:"), err)
-		// Ask the user if they want to try again
-		tryAgain := false
-		prompt := &survey.Confirm{
-			Message: "Do you want to try again?",
-		}
-		_ = survey.AskOne(prompt, &tryAgain, nil)
-		if tryAgain {
-			// Recursively call the function again
-			return getSubtitles(query)
-		}
-	}
-	// cleanup
-	_ = c.LogOut()
-	_ = c.Close()
-	return
-}
-
-func downloadAndExtractSubtitle(subtitle osdb.Subtitle, outputPath string) error {
-	// Get the download URL from the last URL in the struct
-	// downloadURL := subtitle.SubDownloadLink
-	downloadURL := subtitle.ZipDownloadLink
-	fmt.Println("Downloading subtitle from:", downloadURL)
-
-	err := downloadWithWget(downloadURL, subtitlesDir)
-	if err != nil {
-		fmt.Printf("Error downloading file: %s\n", err)
-		return err
-	}
-
-	// fmt.Printf("File downloaded to: %s\n", outputPath)
-	// fmt.Printf("File downloaded to: %s\n", subtitlesDir)
-
-	return nil
-}
-
-func downloadWithWget(url, outputPath string) error {
-	// // // cmd := exec.Command("wget", "-O", outputPath+"/subtitle.zip", url)
-	// // // cmd.Stdout = os.Stdout
-	// // // cmd.Stderr = os.Stderr
-
-	// // // err := cmd.Run()
-	// // // if err != nil {
-	// // // 	return fmt.Errorf("error running wget: %s", err)
-	// // // }
-	// // // fmt.Printf("File downloaded to: %s\n", subtitlesDir)
-
-	// Create the output file
-	outputFile, err := os.Create(filepath.Join(outputPath, "subtitle.zip"))
-	if err != nil {
-		return err
-	}
-	defer outputFile.Close()
-
-	// Make the HTTP request
-	response, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
-
-	// Check if the response status is OK
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download: %s", response.Status)
-	}
-
-	// Copy the response body to the output file
-	_, err = io.Copy(outputFile, response.Body)
-	if err != nil {
-		return err
-	}
-
-	fmt.Printf("File downloaded to: %s\n", filepath.Join(outputPath, "subtitle.zip"))
-
-	// Open the zip file
-	reader, err := zip.OpenReader(outputPath + "/subtitle.zip")
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-
-	// Extract files from the zip archive
-	for _, file := range reader.File {
-		filePath := filepath.Join(outputPath, file.Name)
-		if strings.HasSuffix(filePath, string(filepath.Separator)) {
-			// Skip directory entries
-			continue
-		}
-
-		// Create the file
-		fileWriter, err := os.Create(filePath)
-		if err != nil {
-			return err
-		}
-
-		// Read from the zip file and write to the destination file
-		fileReader, err := file.Open()
-		if err != nil {
-			fileWriter.Close()
-			return err
-		}
-		_, err = io.Copy(fileWriter, fileReader)
-
-		fileReader.Close()
-		fileWriter.Close()
-
-		if err != nil {
-			return err
-		}
-	}
-
-	fmt.Println("Subtitle extracted to:", outputPath)
-
-	return nil
-}
-
-func startClient(player *player.Player, source models.Source, subtitlePath string) {
+// startClient streams the source until the player exits (or until Ctrl+C without a player),
+// then deletes the downloaded data and returns.
+func startClient(player *player.Player, source models.Source, subtitlePath string) error {
 	var printProgressEnabled = true
 
 	// Play the video
@@ -508,52 +336,25 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 	c, err := client.NewClient(dataDir, configurations.TorrentPort, configurations.HostPort)
 
 	if err != nil {
-		errorPrint(err)
-		os.Exit(1)
+		return err
 	}
 	_, err = c.SetSource(source)
 	if err != nil {
-		errorPrint(err)
-		os.Exit(1)
+		c.Client.Close()
+		return err
+	}
+	if chooseFile != nil {
+		c.ChooseFile = chooseFile(c)
 	}
 
-	// Create a channel to signal when c.Start() has completed
-	done := make(chan struct{})
-
-	// Start c.Start() in a goroutine
-	go func() {
-		defer close(done)
-		c.Start()
-	}()
-
-	// Wait for c.Start() to complete
-	<-done
+	// Wait for the torrent information, a source whose metadata never arrives is dead
+	if err := c.StartWithin(metadataTimeout()); err != nil {
+		c.Close()
+		return fmt.Errorf("%w: %v", errDeadSource, err)
+	}
 	tn := c.Torrent.Name()
 	// Introduce a flag to control whether c.PrintProgress() should be executed
 
-	// WatchedDatabase-torgo.db code
-	// Check if "WatchedDatabase-torgo.db" exists
-	watchedDBPath := "WatchedDatabase-torgo.db"
-	if _, err := os.Stat(watchedDBPath); os.IsNotExist(err) {
-		// Create the file if it doesn't exist
-		createWatchedDB(watchedDBPath)
-	} else {
-		// File exists, check number of lines
-		numLines, err := countLines(watchedDBPath)
-		if err != nil {
-			errorPrint("Error counting lines in WatchedDatabase:", err)
-			os.Exit(1)
-		}
-
-		if numLines > 500 {
-			// Rename the file to "WatchedDatabase-torgo-{datetime}.db"
-			renameWatchedDB(watchedDBPath)
-
-			// Create a new "WatchedDatabase-torgo.db"
-			createWatchedDB(watchedDBPath)
-		}
-	}
-
 	// handle exit signals
 	interruptChannel := make(chan os.Signal, 1)
 	signal.Notify(interruptChannel,
@@ -566,69 +367,67 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 	// Channels to control goroutines
 	exitChan := make(chan struct{})
 	progressStopChan := make(chan struct{})
+	// File the subtitles were chosen for
+	var played *torrent.File
+	// Holds the history entry of this stream once the file is known, and follows the playback in mpv
+	playback := newMpvSession(c, 0)
+	finish := func() {
+		id, position := playback.result()
+		finishWatch(id, c, position)
+	}
+	// Tells when the download stops progressing
+	stall := watchStall(c, exitChan)
+	playback.stall = stall
+	// dead ends a stream whose download stalled, before the player started or once it exited
+	dead := func(err error) error {
+		close(exitChan)
+		finish()
+		fmt.Print("\n")
+		c.Close()
+		if keepPolicy != keepAlways {
+			removeData(tn)
+		}
+		return err
+	}
+
+	defer signal.Stop(interruptChannel)
 
 	go func(interruptChannel chan os.Signal, exitChan chan struct{}, progressStopChan chan struct{}) {
-		for {
-			select {
-			case <-interruptChannel:
-				close(progressStopChan)
-				// infoPrint("Stopping processes...")
-				// Set the flag to disable PrintProgress
-				printProgressEnabled = false
-				// c.Stop()
-				// c.Close()
-				// fmt.Print("\n")
-				// infoPrint("Exiting...")
-				dirPath := filepath.Join(dataDir, tn)
-				fmt.Print("\n")
-				// infoPrint("Deleting downloads...", filepath.Join(dataDir, tn))
-
-				// Define the maximum number of retries
-				maxRetries := 5
-				retryCount := 0
-
-				for {
-					time.Sleep(2500 * time.Millisecond)
-
-					if err := os.RemoveAll(dirPath); err != nil {
-						errorPrint("Error deleting directory:", err)
-
-						// Check if maximum retries reached
-						if retryCount >= maxRetries {
-							errorPrint("Maximum retries reached. Exiting...")
-							os.Exit(1)
-						}
-
-						// Increment the retry count
-						retryCount++
-						infoPrint("Retrying...", retryCount)
-						continue // Retry the deletion
-					}
-					// Deletion successful, break out of the loop
-					break
-				}
-				// Delete files inside subtitlesDir
-				subtitleFiles, err := filepath.Glob(filepath.Join(subtitlesDir, "*"))
-				if err != nil {
-					errorPrint("No subtitles to delete", err)
-				} else {
-					for _, subtitlePath := range subtitleFiles {
-						infoPrint("Deleting subtitles...", subtitlePath)
-						if err := os.Remove(subtitlePath); err != nil {
-							errorPrint("Error deleting subtitle file:", err)
-						}
-					}
+		var sig os.Signal
+		select {
+		case sig = <-interruptChannel:
+			for sig == os.Interrupt && prebuffering.Load() {
+				// Ctrl+C starts the player while buffering, see prebufferStream
+				select {
+				case sig = <-interruptChannel:
+				case <-exitChan:
+					close(progressStopChan)
+					printProgressEnabled = false
+					return
 				}
-				os.Exit(0)
-
-			case <-exitChan:
-
-				close(progressStopChan) // Signal to stop the progress goroutine
-				// Set the flag to disable PrintProgress
-				printProgressEnabled = false
-				return // Exit the goroutine
-				// }
 			}
+			close(progressStopChan)
+			// Set the flag to disable PrintProgress
+			printProgressEnabled = false
+			if sig == os.Interrupt {
+				// Ctrl+C only ends this stream: the player gets it as well,
+				// and the standalone server stops waiting for it
+				return
+			}
+			finish()
+			fmt.Print("\n")
+			printTransfer(c)
+			c.Close()
+			if keepPolicy != keepAlways {
+				removeDownloads(tn)
+			}
+			os.Exit(0)
+
+		case <-exitChan:
+			close(progressStopChan) // Signal to stop the progress goroutine
+			// Set the flag to disable PrintProgress
+			printProgressEnabled = false
+			return // Exit the goroutine
 		}
 	}(interruptChannel, exitChan, progressStopChan)
 	if player != nil {
@@ -644,35 +443,28 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 			// Introduce a short delay before checking again
 			time.Sleep(500 * time.Millisecond)
 		}
+		played = c.LargestFile
 		selectedTitle := c.LargestFile.DisplayPath()
-
-		// We write watch data to file
-		file, err := os.OpenFile(watchedDBPath, os.O_APPEND|os.O_WRONLY, 0644)
-		if err != nil {
-			errorPrint("Error opening WatchedDatabase for append:", err)
-			os.Exit(1)
-		}
-		defer file.Close()
-
-		// Get current date and time in the desired format
-		currentDate := time.Now().Format("2006-01-02 15:04:05")
-
-		// Prepare the data to append
-		data := fmt.Sprintf("[%s] Torrent: %s Title: %s Magnet: %s\n", currentDate, tn, selectedTitle, tmagnet)
-
-		// Append the data to the file
-		if _, err := file.WriteString(data); err != nil {
-			errorPrint("Error appending data to WatchedDatabase:", err)
-			// os.Exit(1)
-		}
-
-		fmt.Println(color.HiYellowString("[i] Serving on"), c.URL)
+		streamURL := c.StreamURL()
+		playback.setWatch(recordWatch(c, player.Name))
+		// Where the playback stopped last time, if the user wants to resume
+		start := resumePosition(c, player)
+		player.OnIPC = playback.run
+		player.OnPosition = playback.report
+		player.Transcoder, player.TranscodeURL = c.Transcoder, c.TranscodeURL()
+
+		fmt.Println(color.HiYellowString("[i] Serving on"), streamURL)
 		fmt.Println(color.HiYellowString("[i] Torrent Port:"), c.ClientConfig.ListenPort)
+		if err := prebufferStream(c, int64(start.Percent/100*float64(c.LargestFile.Length())), stall); err != nil {
+			return dead(err)
+		}
 		// goroutine ticker loop to update PrintProgress
 		go func() {
 			// Delay for ticker update time. Use whatever sane values you want. I use 500-1500
 			ticker := time.NewTicker(1500 * time.Millisecond)
 			defer ticker.Stop()
+			// The players other than mpv are not told when the download stalls, the terminal is
+			stallTold := false
 
 			// for range ticker.C {
 			for {
@@ -687,6 +479,13 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 						fmt.Print("\r")
 						os.Stdout.Sync() // Flush the output buffer to ensure immediate display
 					}
+					if err := stall.stalled(); err == nil {
+						stallTold = false
+					} else if !stallTold && !playback.following() {
+						stallTold = true
+						fmt.Print("\n")
+						errorPrint(stallMessage(err, false))
+					}
 				case <-progressStopChan:
 					return // Exit the goroutine when signaled
 				}
@@ -695,12 +494,12 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 
 		if subtitlePath != "" { // With subs
 			if runtime.GOOS != "android" {
-				player.Start(c.URL, subtitlePath, selectedTitle)
+				player.Start(streamURL, subtitlePath, selectedTitle, start)
 				// Just for debugging:
 				// fmt.Println(color.HiYellowString("[i] Launched player with subtitle"), subtitlePath)
 			} else if runtime.GOOS == "android" {
 				if player.Name == "mpv" {
-					cmd := exec.Command("am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d", c.URL, "-n", "is.xyz.mpv/.MPVActivity")
+					cmd := exec.Command("am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d", streamURL, "-n", "is.xyz.mpv/.MPVActivity")
 					logCmd(cmd)
 					err_cmd := cmd.Run()
 					if err_cmd != nil {
@@ -708,7 +507,7 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 					}
 					gofuncTicker(c)
 				} else if player.Name == "vlc" {
-					cmd := exec.Command("am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d", c.URL, "-n", "org.videolan.vlc/org.videolan.vlc.gui.video.VideoPlayerActivity")
+					cmd := exec.Command("am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d", streamURL, "-n", "org.videolan.vlc/org.videolan.vlc.gui.video.VideoPlayerActivity")
 					logCmd(cmd)
 					err_cmd := cmd.Run()
 					if err_cmd != nil {
@@ -720,7 +519,7 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 		} else { // Without subs
 			if runtime.GOOS == "android" {
 				if player.Name == "mpv" {
-					cmd := exec.Command("am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d", c.URL, "-n", "is.xyz.mpv/.MPVActivity")
+					cmd := exec.Command("am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d", streamURL, "-n", "is.xyz.mpv/.MPVActivity")
 					logCmd(cmd)
 					err_cmd := cmd.Run()
 					if err_cmd != nil {
@@ -728,7 +527,7 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 					}
 					gofuncTicker(c)
 				} else if player.Name == "vlc" {
-					cmd := exec.Command("am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d", c.URL, "-n", "org.videolan.vlc/org.videolan.vlc.gui.video.VideoPlayerActivity")
+					cmd := exec.Command("am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d", streamURL, "-n", "org.videolan.vlc/org.videolan.vlc.gui.video.VideoPlayerActivity")
 					logCmd(cmd)
 					err_cmd := cmd.Run()
 					if err_cmd != nil {
@@ -738,7 +537,7 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 				}
 			} else {
 				// open player without subtitle
-				player.Start(c.URL, "", selectedTitle)
+				player.Start(streamURL, "", selectedTitle, start)
 				// Just for debugging:
 				fmt.Println(color.HiYellowString("[i] Launched player without subtitle"), player.Name)
 			}
@@ -756,7 +555,9 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 			// Introduce a short delay before checking again
 			time.Sleep(500 * time.Millisecond)
 		}
-		fmt.Println(color.HiYellowString("[i] Serving on"), c.URL)
+		playback.setWatch(recordWatch(c, "none"))
+		fmt.Println(color.HiYellowString("[i] Serving on"), c.StreamURL())
+		fmt.Println(color.HiYellowString("[i] Every file:"), c.URL, color.HiYellowString("playlist:"), c.URL+"/playlist.m3u")
 		gofuncTicker(c)
 	}
 	// tn := c.Torrent.Name()
@@ -764,13 +565,42 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 	infoPrint("Stopping processes...")
 	// Set the flag to disable PrintProgress
 	printProgressEnabled = false
+	if player != nil {
+		// The player was likely closed because the playback stalled
+		if err := stall.stalled(); err != nil {
+			return dead(err)
+		}
+	}
 	close(exitChan)
-	c.Close()
+	finish()
 	fmt.Print("\n")
-	infoPrint("Exiting...")
+	if keepDownloads(c) {
+		files := c.StreamedFiles()
+		complete := finishDownloads(files)
+		seedTorrent(c)
+		printTransfer(c)
+		c.Close()
+		organizeDownloads(tn, files, played, subtitlePath, complete)
+		removeSubtitles()
+		return nil
+	}
+	seedTorrent(c)
+	printTransfer(c)
+	c.Close()
+	removeDownloads(tn)
+	return nil
+}
+
+// removeDownloads deletes the downloaded data of the torrent and the subtitles.
+func removeDownloads(tn string) {
+	removeData(tn)
+	removeSubtitles()
+}
+
+// removeData deletes the downloaded data of the torrent.
+func removeData(tn string) {
 	dirPath := filepath.Join(dataDir, tn)
-	fmt.Print("\n")
-	infoPrint("Deleting downloads...", filepath.Join(dataDir, tn))
+	infoPrint("Deleting downloads...", dirPath)
 
 	// Define the maximum number of retries
 	maxRetries := 5
@@ -784,8 +614,8 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 
 			// Check if maximum retries reached
 			if retryCount >= maxRetries {
-				errorPrint("Maximum retries reached. Exiting...")
-				os.Exit(1)
+				errorPrint("Maximum retries reached, the downloads are left in", dirPath)
+				break
 			}
 
 			// Increment the retry count
@@ -796,6 +626,10 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 		// Deletion successful, break out of the loop
 		break
 	}
+}
+
+// removeSubtitles deletes the downloaded subtitles.
+func removeSubtitles() {
 	// Delete files inside subtitlesDir
 	subtitleFiles, err := filepath.Glob(filepath.Join(subtitlesDir, "*"))
 	if err != nil {
@@ -808,91 +642,35 @@ func startClient(player *player.Player, source models.Source, subtitlePath strin
 			}
 		}
 	}
-	os.Exit(0)
-}
-
-func createWatchedDB(filePath string) {
-	file, err := os.Create(filePath)
-	if err != nil {
-		errorPrint("Error creating WatchedDatabase:", err)
-		os.Exit(1)
-	}
-	defer file.Close()
-}
-
-func countLines(filePath string) (int, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return 0, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	lineCount := 0
-	for scanner.Scan() {
-		lineCount++
-	}
-
-	if err := scanner.Err(); err != nil {
-		return 0, err
-	}
-
-	return lineCount, nil
-}
-
-func renameWatchedDB(filePath string) {
-	// Get current date and time in the desired format
-	datetime := time.Now().Format("02-1-2006-150PM")
-	newFilePath := fmt.Sprintf("WatchedDatabase-torgo-%s.db", datetime)
-
-	// Rename the file
-	err := os.Rename(filePath, newFilePath)
-	if err != nil {
-		errorPrint("Error renaming WatchedDatabase:", err)
-		os.Exit(1)
-	}
 }
 
-// func appendWatchedData(filePath string) {
-// 	// Open the file in append mode
-// 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0644)
-// 	if err != nil {
-// 		errorPrint("Error opening WatchedDatabase for append:", err)
-// 		os.Exit(1)
-// 	}
-// 	defer file.Close()
-
-// 	// Get current date and time in the desired format
-// 	currentDate := time.Now().Format("2006-01-02 15:04:05")
-
-// 	// Prepare the data to append
-// 	data := fmt.Sprintf("[%s] Torrent: %s Title: %s Magnet: %s\n", currentDate,  c.client.Torrent.Name(), client.Client.LargestFile.DisplayPath(), tmagnet)
-
-// 	// Append the data to the file
-// 	if _, err := file.WriteString(data); err != nil {
-// 		errorPrint("Error appending data to WatchedDatabase:", err)
-// 		os.Exit(1)
-// 	}
-// }
-
 func logCmd(cmd *exec.Cmd) {
 	log.Printf("\x1b[36mLaunching player:\x1b[0m \x1b[33m%v\x1b[0m\n", cmd)
 }
 
+// gofuncTicker prints the progress of the client until Ctrl+C is pressed.
 func gofuncTicker(c *client.Client) {
+	stop := make(chan struct{})
+	defer close(stop)
 	go func() {
 		ticker := time.NewTicker(1500 * time.Millisecond)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			c.PrintProgress()
-			fmt.Print("\r")
-			os.Stdout.Sync() // Flush the output buffer to ensure immediate display
+		for {
+			select {
+			case <-ticker.C:
+				c.PrintProgress()
+				fmt.Print("\r")
+				os.Stdout.Sync() // Flush the output buffer to ensure immediate display
+			case <-stop:
+				return
+			}
 		}
 	}()
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
 	<-sig // Wait for Ctrl+C
 }
 
@@ -920,6 +698,16 @@ func init() {
 		dataDir = filepath.Join(home, dataDir[2:]) // expand user home directory for path in configurations file
 	}
 	configurations.DataDir = dataDir
+	libraryDir = configurations.LibraryDir
+	if strings.HasPrefix(libraryDir, "~/") {
+		libraryDir = filepath.Join(home, libraryDir[2:])
+	}
+	if configurations.KeepDownloads {
+		keepPolicy = keepAlways
+	}
+	if failoverPolicy, err = parseFailover(configurations.Failover); err != nil {
+		errorPrint(err)
+	}
 	subtitlesDir = filepath.Join(dataDir, "subtitles")
 
 	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
@@ -945,6 +733,13 @@ func init() {
 }
 
 func main() {
+	// Non-interactive subcommands
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+
 	name := color.HiYellowString("[torgo v%s]", version)
 	banner :=
 		`
@@ -974,77 +769,15 @@ func main() {
 			Title:  "Unknown",
 			Magnet: os.Args[1],
 		}
-		// player
-		playerChoice := pickPlayer()
-		if playerChoice == "" {
-			errorPrint("Operation aborted")
-			return
-		}
-		var p *player.Player
-		if playerChoice == "None" {
-			p = nil
-		} else {
-			p = player.GetPlayer(playerChoice)
-		}
-		// start
-		startClient(p, source, "")
-	}
-
-	// Prepare options and query for searching torrents
-	category := pickCategory()
-	if category == "" {
-		errorPrint("Operation aborted")
-		return
-	}
-	cat := torgo.Category(strings.ToUpper(category))
-	var options []string
-	// check for availibility of each category for each provider
-	for _, provider := range torgo.AllProviders {
-		if torgo.GetCategoryURL(cat, provider.GetCategories()) != "" {
-			options = append(options, provider.GetName())
-		}
-	}
-	providers := pickProviders(options)
-	if len(providers) == 0 {
-		errorPrint("Operation aborted")
+		runSession(&session{source: &source})
 		return
 	}
-	query := inputQuery()
-	query = strings.TrimSpace(query)
-	// Replace spaces with dots
-	// query = strings.ReplaceAll(query, " ", ".")
 
-	if query == "" {
-		errorPrint("Operation aborted")
-		return
-	}
-	sortBy := pickSortBy()
-	if sortBy == "" {
-		errorPrint("Operation aborted")
-		return
-	}
-	sb := torgo.SortBy(strings.ToLower(sortBy))
-
-	// Call torgo API to search for torrents
-	limit := configurations.ResultsLimit
-	results := torgo.ListResults(providers, query, limit, cat, sb)
-	if len(results) == 0 {
-		errorPrint("No torrents found")
-		return
-	}
-
-	// Prompt for source choosing
-	fmt.Print("\033c") // reset screen
-	choice := chooseResults(results)
-	if choice == "" {
-		errorPrint("Operation aborted")
-		return
-	}
-	index, _ := strconv.Atoi(choice)
-	source := results[index-1]
+	runSession(&session{})
+}
 
-	// Print source information
-	fmt.Print("\033c") // reset screen
+// printSource prints the information of the source, with the magnet truncated to {magnetLength} (0 to keep it whole).
+func printSource(source models.Source, magnetLength int) {
 	boldYellow := color.New(color.Bold, color.FgBlue)
 	_, _ = boldYellow.Print("Title: ")
 	fmt.Println(source.Title)
@@ -1060,31 +793,11 @@ func main() {
 	humanFileSize := humanize.Bytes(uint64(source.FileSize))
 	fmt.Println(color.CyanString(humanFileSize))
 	_, _ = boldYellow.Print("Magnet: ")
-	truncatedMagnet := truncateMagnet(source.Magnet, 60) // Adjust the length as needed
-	fmt.Println(truncatedMagnet)
-	tmagnet = truncatedMagnet
-
-	// Player
-	playerChoice := pickPlayer()
-	if playerChoice == "" {
-		errorPrint("Operation aborted")
-		return
-	}
-	var p *player.Player
-	var subtitlePath string
-	if playerChoice == "None" {
-		p = nil
-		// Asks for subtitles when using no player
-		// subtitlePath = getSubtitles(source.Title)
+	if magnetLength > 0 {
+		fmt.Println(truncateMagnet(source.Magnet, magnetLength))
 	} else {
-		// Get subtitles
-		subtitlePath = getSubtitles(source.Title)
-		p = player.GetPlayer(playerChoice)
+		fmt.Println(source.Magnet)
 	}
-
-	// Start playing video...
-	startClient(p, source, subtitlePath)
-
 }
 
 func truncateMagnet(magnet string, maxLength int) string {
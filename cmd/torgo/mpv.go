@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo/client"
+	"github.com/stl3/torgo/player"
+)
+
+// IDs of the mpv properties observed
+const (
+	observeTimePos = iota + 1
+	observeDuration
+	observePause
+	observeBuffering
+)
+
+// osdAfterSeek is how long the download status stays on the mpv OSD after a seek.
+const osdAfterSeek = 4 * time.Second
+
+// mpvSession follows the playback in mpv through its JSON IPC: it knows the playback position,
+// shows the download status on the OSD while paused, buffering or seeking,
+// and plays the next file of the torrent in the same mpv once a file ends.
+// When the download stalls, it says so on the OSD, and quits mpv to switch to another result as the failover policy says.
+// For the other players it only holds the history entry of the stream.
+type mpvSession struct {
+	c         *client.Client
+	stall     *stallWatch // tells when the download stalls, if set
+	mu        sync.Mutex
+	running   bool    // while mpv is followed through its IPC
+	watchID   int     // history entry of the file played
+	timePos   float64 // seconds
+	duration  float64 // seconds, 0 until known
+	paused    bool
+	buffering bool
+	seeked    time.Time
+	// download speed of the file
+	completed int64
+	sampled   time.Time
+	speed     float64
+}
+
+func newMpvSession(c *client.Client, watchID int) *mpvSession {
+	return &mpvSession{c: c, watchID: watchID}
+}
+
+// setWatch sets the history entry of the file played.
+func (s *mpvSession) setWatch(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchID = id
+}
+
+// result returns the history entry of the file played last, and where its playback stopped if mpv reported it.
+func (s *mpvSession) result() (int, player.Position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.watchID, s.position()
+}
+
+func (s *mpvSession) position() player.Position {
+	if s.timePos <= 0 || s.duration <= 0 {
+		return player.Position{}
+	}
+	return player.Position{Seconds: s.timePos, Percent: s.timePos / s.duration * 100}
+}
+
+// report is the `player.Player.OnPosition` of the players launched without mpv (e.g. DLNA renderers).
+func (s *mpvSession) report(position player.Position) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timePos = position.Seconds
+	if position.Percent > 0 {
+		s.duration = position.Seconds * 100 / position.Percent
+	}
+}
+
+// run is the `player.Player.OnIPC` of mpv, it returns once mpv exits.
+func (s *mpvSession) run(ipc *player.MpvIPC) {
+	s.setRunning(true)
+	defer s.setRunning(false)
+	// mpv quits at the end of the file otherwise, before the next one can be loaded
+	if err := ipc.Set("idle", "yes"); err != nil {
+		logrus.Debugln(err)
+	}
+	for id, property := range map[int]string{
+		observeTimePos:   "time-pos",
+		observeDuration:  "duration",
+		observePause:     "pause",
+		observeBuffering: "paused-for-cache",
+	} {
+		if err := ipc.Observe(id, property); err != nil {
+			logrus.Debugln(err)
+		}
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-ipc.Events():
+			if !ok {
+				return
+			}
+			s.handle(ipc, event)
+		case <-ticker.C:
+			if err := s.stalled(); err != nil {
+				_ = ipc.ShowText(stallMessage(err, true), 1500*time.Millisecond)
+				if failoverPolicy == failoverAuto {
+					// startClient sees the stall once mpv exited, and fails over
+					infoPrint(stallMessage(err, true))
+					_ = ipc.Quit()
+					return
+				}
+				continue
+			}
+			if status, show := s.status(); show {
+				_ = ipc.ShowText(status, 1500*time.Millisecond)
+			}
+		}
+	}
+}
+
+func (s *mpvSession) setRunning(running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = running
+}
+
+// following reports whether mpv is followed through its IPC.
+func (s *mpvSession) following() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// stalled returns the error of the stall watch when the download stalled.
+func (s *mpvSession) stalled() error {
+	if s.stall == nil {
+		return nil
+	}
+	return s.stall.stalled()
+}
+
+func (s *mpvSession) handle(ipc *player.MpvIPC, event player.MpvEvent) {
+	switch event.Event {
+	case "property-change":
+		s.mu.Lock()
+		switch event.ID {
+		case observeTimePos:
+			var seconds float64
+			if json.Unmarshal(event.Data, &seconds) == nil {
+				s.timePos = seconds
+			}
+		case observeDuration:
+			_ = json.Unmarshal(event.Data, &s.duration)
+		case observePause:
+			_ = json.Unmarshal(event.Data, &s.paused)
+		case observeBuffering:
+			_ = json.Unmarshal(event.Data, &s.buffering)
+		}
+		s.mu.Unlock()
+
+	case "seek":
+		s.mu.Lock()
+		s.seeked = time.Now()
+		s.mu.Unlock()
+
+	case "end-file":
+		switch event.Reason {
+		case "eof":
+			s.next(ipc)
+		case "error":
+			// mpv would be left idle
+			_ = ipc.Quit()
+		}
+	}
+}
+
+// next plays the next file of the torrent, or quits mpv after the last one.
+func (s *mpvSession) next(ipc *player.MpvIPC) {
+	file := s.c.NextFile()
+	if file == nil {
+		_ = ipc.Quit()
+		return
+	}
+
+	s.mu.Lock()
+	finishWatch(s.watchID, s.c, s.position())
+	s.c.SetFile(file)
+	s.watchID = recordWatch(s.c, "mpv")
+	s.timePos, s.duration = 0, 0
+	s.completed, s.sampled, s.speed = 0, time.Time{}, 0
+	s.mu.Unlock()
+
+	infoPrint("Playing next file", file.DisplayPath())
+	_ = ipc.Set("force-media-title", file.DisplayPath())
+	if err := ipc.LoadFile(s.c.StreamURL()); err != nil {
+		errorPrint("Error loading the next file in mpv:", err)
+		_ = ipc.Quit()
+	}
+}
+
+// status returns the download status of the file, and whether it should be shown on the OSD:
+// while paused or buffering, and for a moment after a seek.
+func (s *mpvSession) status() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file := s.c.LargestFile
+	if file == nil {
+		return "", false
+	}
+
+	// Speed is sampled every tick, so that it is right when the status appears
+	now := time.Now()
+	completed := file.BytesCompleted()
+	if !s.sampled.IsZero() {
+		s.speed = float64(completed-s.completed) / now.Sub(s.sampled).Seconds()
+	}
+	s.completed, s.sampled = completed, now
+	if !s.paused && !s.buffering && now.Sub(s.seeked) > osdAfterSeek {
+		return "", false
+	}
+
+	status := fmt.Sprintf("Downloaded %.1f%%  %s/s  %d peers",
+		float64(completed)/float64(file.Length())*100,
+		humanize.Bytes(uint64(max(s.speed, 0))),
+		s.c.Torrent.Stats().ActivePeers)
+	if s.duration > 0 {
+		// The byte offset of the playback is estimated from its time, assuming a constant bitrate
+		bytesPerSecond := float64(file.Length()) / s.duration
+		buffered := s.c.BufferedFrom(file, int64(s.timePos*bytesPerSecond))
+		status += fmt.Sprintf("\nBuffered %s → %s", clock(s.timePos), clock(s.timePos+float64(buffered)/bytesPerSecond))
+	}
+	if s.buffering {
+		status = "Buffering...\n" + status
+	}
+	return status, true
+}
+
+// clock formats seconds as h:mm:ss.
+func clock(seconds float64) string {
+	t := int(seconds)
+	return fmt.Sprintf("%d:%02d:%02d", t/3600, t/60%60, t%60)
+}
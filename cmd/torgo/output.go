@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/stl3/torgo/models"
+)
+
+// Output formats of the search results
+const (
+	formatTable   = "table"
+	formatJSON    = "json"
+	formatNDJSON  = "ndjson"
+	formatCSV     = "csv"
+	formatMagnets = "magnets"
+)
+
+// resultWriter writes search results in one of the output formats.
+// Write may be called several times (once per provider for the streaming formats), Close must be called at the end.
+type resultWriter interface {
+	Write(results []models.Source) error
+	Close() error
+}
+
+// newResultWriter returns the writer of the format, and whether the format can be written as the results come in.
+func newResultWriter(format string, w io.Writer) (resultWriter, bool, error) {
+	switch format {
+	case formatTable:
+		return &tableWriter{}, false, nil
+	case formatJSON:
+		return &jsonWriter{w: w}, false, nil
+	case formatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, true, nil
+	case formatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, true, nil
+	case formatMagnets:
+		return &magnetsWriter{w: w}, true, nil
+	}
+	return nil, false, fmt.Errorf("invalid format %q (table, json, ndjson, csv, magnets)", format)
+}
+
+// tableWriter prints the results in a table once they are all collected.
+type tableWriter struct {
+	results []models.Source
+}
+
+func (tw *tableWriter) Write(results []models.Source) error {
+	tw.results = append(tw.results, results...)
+	return nil
+}
+
+func (tw *tableWriter) Close() error {
+	printResults(tw.results)
+	return nil
+}
+
+// jsonWriter prints the results as a single JSON array once they are all collected.
+type jsonWriter struct {
+	w       io.Writer
+	results []models.Source
+}
+
+func (jw *jsonWriter) Write(results []models.Source) error {
+	jw.results = append(jw.results, results...)
+	return nil
+}
+
+func (jw *jsonWriter) Close() error {
+	if jw.results == nil {
+		jw.results = []models.Source{} // `[]` rather than `null`
+	}
+	enc := json.NewEncoder(jw.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jw.results)
+}
+
+// ndjsonWriter prints one JSON object per line, as soon as the results come in.
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(results []models.Source) error {
+	for _, result := range results {
+		if err := nw.enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+// csvWriter prints the results as CSV rows with a header, as soon as they come in.
+// The files of a result, when the provider lists them, are a JSON array in the last column.
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (cw *csvWriter) Write(results []models.Source) error {
+	if !cw.headerWritten {
+		cw.headerWritten = true
+		if err := cw.w.Write([]string{"from", "title", "url", "seeders", "leechers", "size", "magnet", "files"}); err != nil {
+			return err
+		}
+	}
+	for _, result := range results {
+		files := ""
+		if len(result.Files) > 0 {
+			data, err := json.Marshal(result.Files)
+			if err != nil {
+				return err
+			}
+			files = string(data)
+		}
+		err := cw.w.Write([]string{
+			result.From,
+			result.Title,
+			result.URL,
+			strconv.Itoa(result.Seeders),
+			strconv.Itoa(result.Leechers),
+			strconv.FormatInt(result.FileSize, 10),
+			result.Magnet,
+			files,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// magnetsWriter prints one magnet uri per line, as soon as the results come in.
+type magnetsWriter struct {
+	w io.Writer
+}
+
+func (mw *magnetsWriter) Write(results []models.Source) error {
+	for _, result := range results {
+		if result.Magnet == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(mw.w, result.Magnet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mw *magnetsWriter) Close() error {
+	return nil
+}
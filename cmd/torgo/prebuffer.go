@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo/client"
+)
+
+// Defaults of the pre-buffering, when the config does not say
+const (
+	defaultPrebufferSeconds = 10
+	defaultPrebufferTimeout = 2 * time.Minute
+)
+
+// probeTimeout is how long ffprobe may take to read the duration of the file.
+const probeTimeout = 30 * time.Second
+
+// rateSamples is how many seconds the download rate is averaged over.
+const rateSamples = 5
+
+// prebuffer is cleared by `stream -prebuffer=false` to start the player right away.
+var prebuffer = true
+
+// prebuffering is set while the stream is buffered before the player starts: Ctrl+C starts the player then.
+var prebuffering atomic.Bool
+
+// episodePattern matches the episodes of a series in a file name.
+var episodePattern = regexp.MustCompile(`(?i)\bS\d{1,2}E\d{1,3}\b|\b\d{1,2}x\d{2}\b`)
+
+var audioExtensions = map[string]bool{".mp3": true, ".m4a": true, ".m4b": true, ".flac": true, ".ogg": true, ".opus": true, ".wav": true}
+
+// guessBitrate estimates the bitrate of a file in bytes per second from its size and a typical duration:
+// 45 minutes for an episode, 110 minutes for a movie. Audio files are assumed to be 128 kbit/s.
+func guessBitrate(file *torrent.File) float64 {
+	name := filepath.Base(file.DisplayPath())
+	if audioExtensions[strings.ToLower(filepath.Ext(name))] {
+		return 128000 / 8
+	}
+	duration := 110 * time.Minute
+	if episodePattern.MatchString(name) {
+		duration = 45 * time.Minute
+	}
+	return float64(file.Length()) / duration.Seconds()
+}
+
+// probeBitrate returns the bitrate of the stream at {url} in bytes per second, from its duration read by {ffprobe}.
+func probeBitrate(ctx context.Context, ffprobe, url string, size int64) (float64, error) {
+	out, err := exec.CommandContext(ctx, ffprobe, "-v", "error", "-show_entries", "format=duration,bit_rate", "-of", "json", url).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	if duration, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil && duration > 0 {
+		return float64(size) / duration, nil
+	}
+	if bitrate, err := strconv.ParseFloat(probe.Format.BitRate, 64); err == nil && bitrate > 0 {
+		return bitrate / 8, nil
+	}
+	return 0, fmt.Errorf("ffprobe: no duration for %s", url)
+}
+
+// verdict tells whether a stream can be played without stalling.
+type verdict struct {
+	wait          time.Duration // how long to buffer before playing, 0 when streamable now
+	downloadFirst bool          // buffering would take longer than the playback
+}
+
+// streamVerdict compares the {bitrate} of the file with the download {rate} (both in bytes per second),
+// for {remaining} bytes to play from a playhead with {buffered} bytes already downloaded after it.
+// The playback does not stall if what is buffered covers what the download lags behind the playback by its end.
+func streamVerdict(bitrate, rate float64, buffered, remaining int64) verdict {
+	if bitrate <= 0 || buffered >= remaining {
+		return verdict{}
+	}
+	playback := float64(remaining) / bitrate // seconds
+	needed := (bitrate - rate) * playback
+	if float64(buffered) >= needed {
+		return verdict{}
+	}
+	if rate <= 0 {
+		return verdict{downloadFirst: true}
+	}
+	wait := (needed - float64(buffered)) / rate
+	return verdict{wait: time.Duration(wait) * time.Second, downloadFirst: wait > playback}
+}
+
+func (v verdict) String() string {
+	switch {
+	case v.downloadFirst:
+		return "download first"
+	case v.wait > 0:
+		return fmt.Sprintf("wait ~%s", v.wait.Round(time.Second))
+	default:
+		return "streamable now"
+	}
+}
+
+// prebufferStream buffers the file of the client from {offset} before the player starts: the first seconds of video
+// (the bitrate is read by ffprobe, or estimated), and both ends of container files. It then waits as long as
+// the download rate requires, within the timeout of the config, and reports whether the file is streamable.
+// The error of {stall} is returned when the download stalls meanwhile.
+func prebufferStream(c *client.Client, offset int64, stall *stallWatch) error {
+	if !prebuffer {
+		return nil
+	}
+	file := c.LargestFile
+	remaining := file.Length() - offset
+	seconds := configurations.PrebufferSeconds
+	if seconds <= 0 {
+		seconds = defaultPrebufferSeconds
+	}
+	timeout := time.Duration(configurations.PrebufferTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultPrebufferTimeout
+	}
+
+	bitrate, source := guessBitrate(file), "estimated"
+	probed := make(chan float64, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	go func() {
+		// The reads of ffprobe are not the playback, they are left out of the history and the resume position
+		rate, err := probeBitrate(ctx, c.Transcoder.FFprobe(), c.ProbeURL(), file.Length())
+		if err != nil {
+			logrus.Debugln(err)
+			return
+		}
+		probed <- rate
+	}()
+
+	prebuffering.Store(true)
+	defer prebuffering.Store(false)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	infoPrint("Buffering before starting the player, press Ctrl+C to start now...")
+	started := time.Now()
+	var samples []int64 // bytes downloaded, every second
+	var rate float64
+	var v verdict
+	for {
+		select {
+		case <-stop:
+			fmt.Print("\n")
+			return nil
+		case bitrate = <-probed:
+			source = "ffprobe"
+			continue
+		case <-ticker.C:
+		}
+		samples = append(samples, c.Transfer().Downloaded)
+		if len(samples) > rateSamples+1 {
+			samples = samples[1:]
+		}
+		if len(samples) > 1 {
+			rate = float64(samples[len(samples)-1]-samples[0]) / float64(len(samples)-1)
+		}
+		need := min(max(int64(bitrate*float64(seconds)), int64(configurations.PrebufferMB)<<20), remaining)
+		buffered := c.BufferedFrom(file, offset)
+		v = streamVerdict(bitrate, rate, buffered, remaining)
+		fmt.Printf("\rBuffered: %s / %s  Download Speed: %s/s  Bitrate: %s/s (%s)  %s\033[K",
+			color.GreenString(humanize.Bytes(uint64(buffered))),
+			color.BlueString(humanize.Bytes(uint64(need))),
+			color.CyanString(humanize.Bytes(uint64(rate))),
+			humanize.Bytes(uint64(bitrate)), source,
+			color.YellowString(v.String()))
+
+		if err := stall.stalled(); err != nil {
+			fmt.Print("\n")
+			return err
+		}
+		left := timeout - time.Since(started)
+		if buffered >= need && c.Preloaded(file) && len(samples) > 2 && (v.wait == 0 || v.downloadFirst || v.wait > left) {
+			break
+		}
+		if left <= 0 {
+			break
+		}
+	}
+	fmt.Print("\n")
+
+	speeds := fmt.Sprintf("download %s/s, video %s/s", humanize.Bytes(uint64(rate)), humanize.Bytes(uint64(bitrate)))
+	switch {
+	case v.downloadFirst:
+		infoPrint(fmt.Sprintf("Download first: the download is too slow for the video (%s), see `torgo download` and `stream -keep`", speeds))
+	case v.wait > 0:
+		infoPrint(fmt.Sprintf("Wait ~%s: the playback may stall until then, pause it to buffer (%s)", v.wait.Round(time.Second), speeds))
+	default:
+		infoPrint(fmt.Sprintf("Streamable now (%s)", speeds))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/stl3/torgo"
+	"github.com/stl3/torgo/health"
+	"github.com/stl3/torgo/models"
+)
+
+// providersCheck runs the health checks of the given providers (all of them if none is given),
+// prints them as a table and saves them. It returns the exit code: 1 if any provider regressed,
+// or with {strict} if any provider failed.
+func providersCheck(names []string, strict bool) int {
+	var providers []models.ProviderInterface
+	for _, provider := range torgo.AllProviders {
+		if len(names) == 0 || containsFold(names, provider.GetName()) {
+			providers = append(providers, provider)
+		}
+	}
+	if len(providers) == 0 {
+		errorPrint("No such provider:", strings.Join(names, ", "))
+		return 2
+	}
+
+	store, err := health.Load()
+	if err != nil {
+		errorPrint("Error loading provider health:", err)
+		return 2
+	}
+
+	s := spinner.New(spinner.CharSets[36], 100*time.Millisecond)
+	s.Suffix = color.HiYellowString(" Checking %d providers ...", len(providers))
+	s.Start()
+	results := health.CheckAll(providers)
+	s.Stop()
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Provider", "Mirrors", "Canary", "Rows", "Valid", "Time", "Status"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.BgHiYellowColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiCyanColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.BgHiGreenColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiGreenColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiBlueColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.Bold},
+	)
+
+	regressions, failures := 0, 0
+	for _, result := range results {
+		var mirrors []string
+		for _, mirror := range result.Mirrors {
+			host := strings.TrimPrefix(strings.TrimPrefix(mirror.URL, "https://"), "http://")
+			if mirror.Reachable() {
+				mirrors = append(mirrors, color.HiGreenString("%s %d %dms", host, mirror.Status, mirror.Latency.Milliseconds()))
+			} else {
+				mirrors = append(mirrors, color.HiRedString("%s down", host))
+			}
+		}
+
+		status := color.HiGreenString("OK")
+		if !result.OK() {
+			failures++
+			reason := shorten(result.Err, 80)
+			if store.Regressed(result) {
+				regressions++
+				status = color.HiRedString("REGRESSED: %s", reason)
+			} else {
+				status = color.RedString("FAIL: %s", reason)
+			}
+		}
+
+		table.Append([]string{
+			result.Provider,
+			strings.Join(mirrors, "\n"),
+			result.Query,
+			fmt.Sprint(result.Rows),
+			fmt.Sprintf("%d/%d", result.ValidRows, result.Sampled),
+			result.Duration.Round(100 * time.Millisecond).String(),
+			status,
+		})
+	}
+	table.SetRowLine(true)
+	table.Render()
+
+	store.Record(results...)
+	if err := store.Save(); err != nil {
+		errorPrint("Error saving provider health:", err)
+	}
+	if regressions > 0 {
+		errorPrint(fmt.Sprintf("%d provider(s) regressed", regressions))
+		return 1
+	}
+	if strict && failures > 0 {
+		errorPrint(fmt.Sprintf("%d provider(s) failed", failures))
+		return 1
+	}
+	return 0
+}
+
+// providerLabels returns the labels shown in the providers prompt, with the providers that failed
+// their last health check greyed out, and a map to get the provider name back from its label.
+func providerLabels(names []string) ([]string, map[string]string) {
+	store, err := health.Load()
+	if err != nil {
+		store = nil
+	}
+	labels := make([]string, 0, len(names))
+	byLabel := make(map[string]string, len(names))
+	for _, name := range names {
+		label := name
+		if store != nil && store.Broken(name) {
+			label = color.HiBlackString("%s (broken)", name)
+		}
+		labels = append(labels, label)
+		byLabel[label] = name
+	}
+	return labels, byLabel
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
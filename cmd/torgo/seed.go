@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+
+	"github.com/stl3/torgo/client"
+)
+
+// seedTorrent seeds the torrent of the client once the stream ended, until a limit of its seeding policy
+// is reached or Ctrl+C is pressed. Nothing is done if the policy does not seed.
+func seedTorrent(c *client.Client) {
+	policy := c.Seeding
+	if !policy.Seeds() {
+		return
+	}
+	var limits string
+	if policy.Ratio > 0 {
+		limits = fmt.Sprintf(" until a ratio of %.2f", policy.Ratio)
+	}
+	if policy.Time > 0 {
+		if limits != "" {
+			limits += " or"
+		}
+		limits += fmt.Sprintf(" for %s", policy.Time)
+	}
+	infoPrint(fmt.Sprintf("Seeding%s, press Ctrl+C to stop...", limits))
+
+	c.StartSeeding()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	ticker := time.NewTicker(1500 * time.Millisecond)
+	defer ticker.Stop()
+
+	started := time.Now()
+	last, lastTime := c.Transfer().Uploaded, started
+	for {
+		select {
+		case <-stop:
+			fmt.Print("\n")
+			return
+		case <-ticker.C:
+		}
+		transfer := c.Transfer()
+		speed := float64(transfer.Uploaded-last) / time.Since(lastTime).Seconds()
+		last, lastTime = transfer.Uploaded, time.Now()
+		fmt.Printf("\rUploaded: %s  Ratio: %s  Upload Speed: %s/s  Peers: %d  %s\033[K",
+			color.GreenString(humanize.Bytes(uint64(transfer.Uploaded))),
+			color.YellowString("%.2f", transfer.Ratio()),
+			color.CyanString(humanize.Bytes(uint64(speed))),
+			c.Torrent.Stats().ActivePeers,
+			time.Since(started).Round(time.Second))
+		if policy.Done(transfer, time.Since(started)) {
+			fmt.Print("\n")
+			return
+		}
+	}
+}
+
+// printTransfer prints what the torrent of the client downloaded and uploaded during the session.
+func printTransfer(c *client.Client) {
+	transfer := c.Transfer()
+	infoPrint(fmt.Sprintf("Downloaded %s, uploaded %s (ratio %.2f)",
+		humanize.Bytes(uint64(transfer.Downloaded)), humanize.Bytes(uint64(transfer.Uploaded)), transfer.Ratio()))
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo"
+	"github.com/stl3/torgo/models"
+	"github.com/stl3/torgo/player"
+	"github.com/stl3/torgo/tui"
+)
+
+// errBack is returned by the wizard prompts when the user chooses to go back to the previous step.
+var errBack = errors.New("back")
+
+// backOption is the option added to the wizard prompts to go back to the previous step.
+const backOption = "« Back"
+
+// Options of the menu shown once a stream is over
+const (
+	menuResults   = "Back to the results"
+	menuNewSearch = "New search"
+	menuNewFilter = "New search (other category or providers)"
+	menuQuit      = "Quit"
+)
+
+// step is a step of the interactive wizard.
+type step int
+
+const (
+	stepCategory step = iota
+	stepProviders
+	stepQuery
+	stepSort
+	stepResults
+	stepPlay
+	stepMenu
+)
+
+// session holds the choices made in the wizard, so that the user can go back to any of them
+// (or to the last results) instead of starting over after a stream.
+type session struct {
+	category  torgo.Category
+	options   []string // names of the providers supporting the category
+	providers []interface{}
+	query     string
+	sortBy    torgo.SortBy
+	results   *resultList    // results of the last search, nil before the first one
+	source    *models.Source // result to stream
+	streamed  bool           // a stream was started in this session
+}
+
+// runSession runs the interactive wizard until the user quits.
+// A session started with a source goes straight to the player prompt.
+func runSession(sess *session) {
+	// The players installed and the devices of the network are searched while the user picks the torrent
+	go player.Detect()
+	discoverNetworkPlayers()
+	current := stepCategory
+	if sess.source != nil {
+		current = stepPlay
+	}
+
+	for {
+		var err error
+		switch current {
+		case stepCategory:
+			back := backOption
+			if !sess.streamed {
+				back = "« Quit" // nothing before the first step
+			}
+			var category string
+			if category, err = pickCategory(back); err == nil {
+				sess.category = torgo.Category(strings.ToUpper(category))
+				sess.options = nil
+				// check for availibility of each category for each provider
+				for _, provider := range torgo.AllProviders {
+					if torgo.GetCategoryURL(sess.category, provider.GetCategories()) != "" {
+						sess.options = append(sess.options, provider.GetName())
+					}
+				}
+				current = stepProviders
+			} else if errors.Is(err, errBack) && sess.streamed {
+				current, err = stepMenu, nil
+			}
+
+		case stepProviders:
+			if sess.providers, err = pickProviders(sess.options); err == nil {
+				current = stepQuery
+			} else if errors.Is(err, errBack) {
+				current, err = stepCategory, nil
+			}
+
+		case stepQuery:
+			if sess.query, err = inputQuery(); err == nil {
+				current = stepSort
+			} else if errors.Is(err, errBack) {
+				current, err = stepProviders, nil
+			}
+
+		case stepSort:
+			var sortBy string
+			if sortBy, err = pickSortBy(); err == nil {
+				sess.sortBy = torgo.SortBy(strings.ToLower(sortBy))
+				sess.results = nil // a new search
+				current = stepResults
+			} else if errors.Is(err, errBack) {
+				current, err = stepQuery, nil
+			}
+
+		case stepResults:
+			current = sess.browse()
+
+		case stepPlay:
+			current = sess.play()
+
+		case stepMenu:
+			current, err = sess.menu()
+		}
+
+		if err != nil {
+			if !errors.Is(err, errBack) {
+				errorPrint("Operation aborted")
+			}
+			return
+		}
+	}
+}
+
+// browse lets the user pick results, from a new search or from the last one. It returns the next step.
+func (sess *session) browse() step {
+	back := stepSort
+	if sess.streamed && sess.results != nil {
+		back = stepMenu
+	}
+
+	var picked []models.Source
+	var err error
+	if sess.results == nil {
+		sess.results = &resultList{}
+		picked, err = sess.results.search(sess.providers, sess.query, configurations.ResultsLimit, sess.category, sess.sortBy)
+	} else {
+		picked, err = browseResults(sess.query, sess.results.Sources(), sess.sortBy)
+	}
+	if err != nil {
+		if !errors.Is(err, errBack) {
+			errorPrint(err)
+		}
+		return back
+	}
+
+	// Some providers only give us the magnet once a result is picked
+	models.ResolveMagnets(picked, 0)
+	if len(picked) > 1 {
+		// Several results are not streamed, their magnets are printed for another client
+		fmt.Print("\033c") // reset screen
+		for _, source := range picked {
+			printSource(source, 0)
+			fmt.Println()
+		}
+		return stepMenu
+	}
+	if picked[0].Magnet == "" {
+		errorPrint("No magnet found for", picked[0].Title)
+		return stepResults
+	}
+	sess.source = &picked[0]
+	return stepPlay
+}
+
+// play asks for the player and the subtitles, and streams the chosen source. It returns the next step.
+func (sess *session) play() step {
+	back := stepResults
+	if sess.results == nil {
+		back = stepMenu // a magnet given on the command line
+	}
+	source := *sess.source
+
+	// Print source information
+	fmt.Print("\033c")      // reset screen
+	printSource(source, 60) // Adjust the length as needed
+
+	// Player
+	playerChoice, err := pickPlayer()
+	if err != nil {
+		if !errors.Is(err, errBack) {
+			errorPrint("Operation aborted")
+		}
+		return back
+	}
+	var p *player.Player
+	var subtitlePath string
+	if playerChoice == "None" {
+		p = nil
+		// Asks for subtitles when using no player
+		// subtitlePath = getSubtitles(source.Title)
+	} else {
+		// Get subtitles
+		subtitlePath = getSubtitles(source.Title)
+		p = lookupPlayer(playerChoice)
+	}
+
+	// Start playing video, or one of the other results if its swarm is dead
+	var results []models.Source
+	if sess.results != nil {
+		results = sess.results.Sources()
+	}
+	sess.streamed = true
+	if err := streamFailover(p, source, subtitlePath, results); err != nil {
+		errorPrint(err)
+	}
+	return stepMenu
+}
+
+// menu asks what to do once a stream is over.
+func (sess *session) menu() (step, error) {
+	var options []string
+	if sess.results != nil {
+		options = append(options, menuResults, menuNewSearch)
+	}
+	options = append(options, menuNewFilter, menuQuit)
+
+	fmt.Println()
+	choice := ""
+	prompt := &survey.Select{
+		Message: "What next?",
+		Options: options,
+	}
+	if err := survey.AskOne(prompt, &choice, nil); err != nil {
+		return stepMenu, err
+	}
+	switch choice {
+	case menuResults:
+		return stepResults, nil
+	case menuNewSearch:
+		return stepQuery, nil
+	case menuNewFilter:
+		return stepCategory, nil
+	}
+	return stepMenu, errBack
+}
+
+// resultList keeps the results of a search as they come in, so they can be browsed again after a stream.
+type resultList struct {
+	mu      sync.Mutex
+	sources []models.Source
+}
+
+func (list *resultList) add(sources []models.Source) {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	list.sources = append(list.sources, sources...)
+}
+
+// Sources returns a copy of the results received so far.
+func (list *resultList) Sources() []models.Source {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	return append([]models.Source(nil), list.sources...)
+}
+
+// search queries the providers, keeps the results in the list and lets the user pick some of them.
+func (list *resultList) search(providers []interface{}, query string, limit int, cat torgo.Category, sb torgo.SortBy) ([]models.Source, error) {
+	if !tui.Available() {
+		results := torgo.ListResults(providers, query, limit, cat, sb)
+		list.add(results)
+		return browseResults(query, results, sb)
+	}
+
+	stream := make(chan []models.Source)
+	go func() {
+		torgo.StreamResults(providers, query, limit, cat, sb, func(results []models.Source) {
+			list.add(results)
+			stream <- results
+		})
+		close(stream)
+	}()
+	return browseStream(query, stream, sb)
+}
+
+// browseResults lets the user pick one or several of the results in the full-screen browser,
+// or one result in a table when the terminal can not run the browser.
+// It returns `errBack` if nothing was picked.
+func browseResults(query string, results []models.Source, sb torgo.SortBy) ([]models.Source, error) {
+	if !tui.Available() {
+		if len(results) == 0 {
+			return nil, errors.New("no torrents found")
+		}
+		fmt.Print("\033c") // reset screen
+		choice := chooseResults(results)
+		if choice == "" {
+			return nil, errBack
+		}
+		index, _ := strconv.Atoi(choice)
+		return results[index-1 : index], nil
+	}
+
+	stream := make(chan []models.Source, 1)
+	stream <- results
+	close(stream)
+	return browseStream(query, stream, sb)
+}
+
+// browseStream runs the full-screen browser on results that are still coming in.
+func browseStream(query string, stream <-chan []models.Source, sb torgo.SortBy) ([]models.Source, error) {
+	// Logs would be drawn over the browser, they are printed once it is closed
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	picked, err := tui.Browse(query, stream, sb)
+	logrus.SetOutput(os.Stdout)
+	_, _ = os.Stdout.Write(logs.Bytes())
+	if errors.Is(err, tui.ErrAborted) {
+		return nil, errBack
+	}
+	return picked, err
+}
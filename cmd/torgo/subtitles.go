@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/stl3/torgo/subtitles"
+)
+
+// subtitlesTimeout is how long the search and the download of subtitles may take.
+const subtitlesTimeout = 2 * time.Minute
+
+// subtitlesClient returns an OpenSubtitles client with the API key and the account of the configuration.
+func subtitlesClient() (*subtitles.Client, error) {
+	if configurations.OpenSubtitlesAPIKey == "" {
+		return nil, fmt.Errorf("%w, then set OpenSubtitlesAPIKey in %s", subtitles.ErrNoAPIKey, configFile)
+	}
+	return subtitles.New(configurations.OpenSubtitlesAPIKey, configurations.OpenSubtitlesUsername,
+		configurations.OpenSubtitlesPassword, "torgo v"+version), nil
+}
+
+// subtitlesQuery returns the search of the subtitles of a release in the languages {langs},
+// by its name, year, season and episode read from its title.
+func subtitlesQuery(title string, langs []string) subtitles.Query {
+	r := parseRelease(title)
+	query := subtitles.Query{Query: r.name, Languages: langs}
+	if query.Query == "" {
+		query.Query = title
+	}
+	query.Year, _ = strconv.Atoi(r.year)
+	if r.episode != "" {
+		fmt.Sscanf(r.episode, "s%de%d", &query.Season, &query.Episode)
+	}
+	return query
+}
+
+func pickLangs() []string {
+	languagesMap := map[string]string{
+		"English":               "eng",
+		"Chinese (traditional)": "zht",
+		"Chinese (simplified)":  "chi",
+		"Arabic":                "ara",
+		"Hindi":                 "hin",
+		"Dutch":                 "dut",
+		"French":                "fre",
+		"Portuguese":            "por",
+		"Russian":               "rus",
+	}
+	var languagesOpts []string
+	for k := range languagesMap {
+		languagesOpts = append(languagesOpts, k)
+	}
+
+	var chosen []string
+	prompt := &survey.MultiSelect{
+		Message: "Choose subtitles languages:",
+		Default: []string{"English"},
+		Options: languagesOpts,
+	}
+	_ = survey.AskOne(prompt, &chosen, nil)
+
+	var languages []string
+	for _, choice := range chosen {
+		languages = append(languages, languagesMap[choice])
+	}
+	return languages
+}
+
+// chooseSubtitles lists the subtitles found and returns the index of the one chosen.
+func chooseSubtitles(found []subtitles.Subtitle) int {
+	// Create table
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"#", "Release", "Lang", "HI", "Downloads"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.BgHiYellowColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.BgHiCyanColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgHiBlueColor, tablewriter.FgBlackColor},
+		tablewriter.Colors{tablewriter.BgYellowColor, tablewriter.FgBlackColor},
+	)
+	table.SetColumnColor(
+		tablewriter.Colors{tablewriter.FgHiYellowColor},
+		tablewriter.Colors{}, // release
+		tablewriter.Colors{tablewriter.FgHiCyanColor},
+		tablewriter.Colors{}, // hi
+		tablewriter.Colors{tablewriter.FgYellowColor},
+	)
+	for i, sub := range found {
+		// hearing impaired
+		hiSymbol := color.HiRedString("N")
+		if sub.HearingImpaired {
+			hiSymbol = color.HiGreenString("Y")
+		}
+		// release, marked when timed for the very file
+		name := strings.TrimSpace(sub.Release)
+		if name == "" {
+			name = sub.FileName
+		}
+		if len(name) > 42 {
+			name = name[:39] + "..."
+		}
+		if sub.MovieHashMatch {
+			name = color.HiGreenString("* ") + name
+		}
+
+		table.Append([]string{strconv.Itoa(i + 1), name, sub.Language, hiSymbol, strconv.Itoa(sub.Downloads)})
+	}
+	table.Render()
+
+	// Prompt choice
+	choice := ""
+	question := &survey.Question{
+		Prompt: &survey.Input{Message: "Choice(#):"},
+		Validate: func(val interface{}) error {
+			index, err := strconv.Atoi(val.(string))
+			if err != nil {
+				return fmt.Errorf("input must be numbers")
+			} else if index < 1 || index > len(found) {
+				return fmt.Errorf("input range exceeded (1-%d)", len(found))
+			}
+			return nil
+		},
+	}
+	_ = survey.Ask([]*survey.Question{question}, &choice)
+	index, _ := strconv.Atoi(choice)
+	return index - 1
+}
+
+func getSubtitles(title string) (subtitlePath string) {
+	// yes or no
+	need := false
+	prompt := &survey.Confirm{
+		Message: "Need subtitles?",
+	}
+	_ = survey.AskOne(prompt, &need, nil)
+	if !need {
+		return
+	}
+
+	// pick subtitle languages
+	langs := pickLangs()
+	for {
+		subtitlePath, err := fetchSubtitles(subtitlesQuery(title, langs), subtitlesDir, chooseSubtitles)
+		if err == nil {
+			return subtitlePath
+		}
+		errorPrint(err)
+		var quotaErr *subtitles.QuotaError
+		if errors.Is(err, subtitles.ErrNoAPIKey) || errors.As(err, &quotaErr) {
+			return ""
+		}
+		// Ask the user if they want to try again
+		tryAgain := false
+		prompt := &survey.Confirm{
+			Message: "Do you want to try again?",
+		}
+		_ = survey.AskOne(prompt, &tryAgain, nil)
+		if !tryAgain {
+			return ""
+		}
+	}
+}
+
+// fetchSubtitles searches the subtitles of the query on OpenSubtitles, lets {choose} pick one of them (index)
+// and downloads it into {dir}. It returns "" without error when none is found.
+func fetchSubtitles(query subtitles.Query, dir string, choose func([]subtitles.Subtitle) int) (string, error) {
+	c, err := subtitlesClient()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), subtitlesTimeout)
+	defer cancel()
+	if err := c.Login(ctx); err != nil {
+		// The downloads without login are fewer, but still allowed
+		errorPrint("OpenSubtitles login failed, downloading anonymously:", err)
+	}
+	defer func() { _ = c.Logout(context.Background()) }()
+
+	found, err := c.Search(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	if len(found) == 0 {
+		errorPrint("No subtitles found")
+		return "", nil
+	}
+	index := choose(found)
+	if index < 0 || index >= len(found) {
+		return "", nil
+	}
+
+	fmt.Println(color.HiYellowString("[i] Downloading subtitle to"), dir)
+	subtitlePath, quota, err := c.Download(ctx, found[index].FileID, dir)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(color.HiYellowString("[i] SubtitlePath: "), subtitlePath)
+	infoPrint(fmt.Sprintf("%d subtitle downloads left today", quota.Remaining))
+	return subtitlePath, nil
+}
+
+// subtitlesCommand downloads the subtitles of a title, or of a video file found by its hash first.
+func subtitlesCommand(args []string) int {
+	fs := flag.NewFlagSet("subtitles", flag.ExitOnError)
+	lang := fs.String("lang", "eng", "comma separated subtitle languages (e.g. eng,fre or en,fr)")
+	imdb := fs.String("imdb", "", "IMDb ID of the movie or of the episode (e.g. tt0111161)")
+	season := fs.Int("season", 0, "season of the episode (read from the title when 0)")
+	episode := fs.Int("episode", 0, "episode number (read from the title when 0)")
+	dir := fs.String("dir", ".", "where the subtitles are downloaded")
+	first := fs.Bool("first", false, "download the first subtitle found without asking")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 && *imdb == "" {
+		errorPrint("Usage: torgo " + commands["subtitles"].usage)
+		return 2
+	}
+
+	title := strings.Join(fs.Args(), " ")
+	// A video file is found by its hash, and by its name when no subtitle matches the hash
+	var hash string
+	if file, err := os.Open(title); err == nil {
+		info, err := file.Stat()
+		if err == nil && !info.IsDir() {
+			hash, err = subtitles.Hash(file, info.Size())
+			title = strings.TrimSuffix(filepath.Base(title), filepath.Ext(title))
+		}
+		file.Close()
+		if err != nil {
+			errorPrint(err)
+		}
+	}
+	query := subtitlesQuery(title, strings.Split(*lang, ","))
+	query.IMDbID, query.MovieHash = *imdb, hash
+	if *imdb != "" && fs.NArg() == 0 {
+		query.Query = ""
+	}
+	if *season > 0 {
+		query.Season = *season
+	}
+	if *episode > 0 {
+		query.Episode = *episode
+	}
+
+	choose := chooseSubtitles
+	if *first {
+		choose = func([]subtitles.Subtitle) int { return 0 }
+	}
+	subtitlePath, err := fetchSubtitles(query, *dir, choose)
+	if err != nil {
+		errorPrint(err)
+		return 1
+	}
+	if subtitlePath == "" {
+		return 1
+	}
+	fmt.Println(subtitlePath)
+	return 0
+}
@@ -20,6 +20,55 @@ type TorgoConfig struct {
 	HOCPT        int    `json:"HalfOpenConnsPerTorrent"`
 	THOC         int    `json:"TotalHalfOpenConns"`
 	Debug        bool   `json:"Debug"`
+	DaemonAddr   string `json:"DaemonAddr"` // address of `torgo daemon`
+	// KeepDownloads keeps the files of the streams and finishes their download after the player closes
+	KeepDownloads bool   `json:"KeepDownloads"`
+	LibraryDir    string `json:"LibraryDir"` // where the kept files are moved, empty to leave them in DataDir
+	// Seeding: upload while streaming, then seed until SeedRatio (uploaded / downloaded) or for SeedTime (e.g. "30m")
+	Upload      bool    `json:"Upload"`
+	SeedRatio   float64 `json:"SeedRatio"`
+	SeedTime    string  `json:"SeedTime"`
+	UploadSlots int     `json:"UploadSlots"` // peers kept while seeding, 0 for EstablishedConnsPerTorrent
+	// Rate limits per second (e.g. "2MB", empty for no limit), the alternative ones apply during AltSchedule (e.g. "08:00-18:00")
+	DownloadLimit    string `json:"DownloadLimit"`
+	UploadLimit      string `json:"UploadLimit"`
+	AltDownloadLimit string `json:"AltDownloadLimit"`
+	AltUploadLimit   string `json:"AltUploadLimit"`
+	AltSchedule      string `json:"AltSchedule"`
+	// Buffered before the player starts: PrebufferSeconds of video (10 when 0) and at least PrebufferMB,
+	// waiting at most PrebufferTimeout seconds (120 when 0)
+	PrebufferSeconds int `json:"PrebufferSeconds"`
+	PrebufferMB      int `json:"PrebufferMB"`
+	PrebufferTimeout int `json:"PrebufferTimeout"`
+	// Failover to another result of the search when the metadata does not arrive within MetadataTimeout seconds,
+	// or nothing is downloaded for StallTimeout seconds (60 when 0): "ask" (the default), "auto" or "off"
+	MetadataTimeout int    `json:"MetadataTimeout"`
+	StallTimeout    int    `json:"StallTimeout"`
+	Failover        string `json:"Failover"`
+	// FFmpeg transcodes the files for the devices which cannot play them, ffprobe is looked for next to it
+	// (empty: both from the PATH)
+	FFmpeg string `json:"FFmpeg"`
+	// Players defined by the user, added to the built-in ones or replacing the one of the same name
+	Players []PlayerConfig `json:"Players"`
+	// DefaultPlayer is preselected in the player prompt (the last player used when empty), and played by `torgo stream`
+	DefaultPlayer string `json:"DefaultPlayer"`
+	// OpenSubtitles.com API key of the subtitles (https://www.opensubtitles.com/en/consumers), and the optional
+	// account raising the downloads allowed per day
+	OpenSubtitlesAPIKey   string `json:"OpenSubtitlesAPIKey"`
+	OpenSubtitlesUsername string `json:"OpenSubtitlesUsername"`
+	OpenSubtitlesPassword string `json:"OpenSubtitlesPassword"`
+}
+
+// PlayerConfig is a player defined as a command template, per OS. The arguments may hold the placeholders
+// {url}, {title}, {subtitle}, {start} (seconds), {startms} (milliseconds) and {percent}: an argument whose placeholder has no value is left out
+// (e.g. "--sub-file={subtitle}" without subtitles), and the URL is added last when no argument holds {url}.
+type PlayerConfig struct {
+	Name    string   `json:"Name"`
+	Command []string `json:"Command"` // on the OSes without a command of their own
+	Windows []string `json:"Windows"`
+	Linux   []string `json:"Linux"`
+	Darwin  []string `json:"Darwin"`
+	Android []string `json:"Android"`
 }
 
 // This function is for debug purposes
@@ -60,6 +109,7 @@ func InitConfig(path string) error {
 		ECPT:        45,
 		HOCPT:       25,
 		THOC:        50,
+		DaemonAddr:  "127.0.0.1:8790",
 	}
 	data, _ := json.MarshalIndent(config, "", "\t")
 	err := os.WriteFile(path, data, 0644)
@@ -76,6 +126,17 @@ func LoadConfig(path string) (TorgoConfig, error) {
 	return config, err
 }
 
+// Dir returns the directory where torgo keeps its own state (provider health, history...).
+// It is `torgo` inside the user config directory of the OS, and it is created if missing.
+func Dir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(configDir, "torgo")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
 func getTempDir() string {
 	tempDir := os.TempDir()
 	return filepath.Join(tempDir, "torgo")
@@ -0,0 +1,309 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo/client"
+	"github.com/stl3/torgo/dlna"
+	"github.com/stl3/torgo/ratelimit"
+	"github.com/stl3/torgo/transcode"
+)
+
+// maxTorrentFile is the largest .torrent file accepted.
+const maxTorrentFile = 10 * 1024 * 1024
+
+// Status describes a torrent of the daemon.
+type Status struct {
+	InfoHash   string       `json:"info_hash"`
+	Name       string       `json:"name"` // empty until the info of the torrent is known
+	Magnet     string       `json:"magnet"`
+	State      string       `json:"state"` // "metadata", "downloading", "complete" or "paused"
+	Size       int64        `json:"size"`  // of the selected files
+	Completed  int64        `json:"completed"`
+	Percent    float64      `json:"percent"`
+	Peers      int          `json:"peers"`
+	Seeders    int          `json:"seeders"`
+	Downloaded int64        `json:"downloaded"` // bytes received from the peers
+	Uploaded   int64        `json:"uploaded"`   // bytes sent to the peers
+	Added      time.Time    `json:"added"`
+	Files      []FileStatus `json:"files"`
+}
+
+// FileStatus describes a file of a torrent of the daemon.
+type FileStatus struct {
+	Index     int    `json:"index"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Completed int64  `json:"completed"`
+	Selected  bool   `json:"selected"`
+	StreamURL string `json:"stream_url"`
+}
+
+// status returns the status of the torrent. The stream URLs are paths on the daemon.
+func (e *entry) status() Status {
+	t := e.t
+	stats := t.Stats()
+	status := Status{
+		InfoHash:   t.InfoHash().HexString(),
+		Magnet:     e.Magnet,
+		State:      "metadata",
+		Peers:      stats.ActivePeers,
+		Seeders:    stats.ConnectedSeeders,
+		Downloaded: stats.BytesReadData.Int64(),
+		Uploaded:   stats.BytesWrittenData.Int64(),
+		Added:      e.Added,
+		Files:      []FileStatus{},
+	}
+	if status.Magnet == "" {
+		mi := t.Metainfo()
+		status.Magnet = mi.Magnet(nil, t.Info()).String()
+	}
+	if t.Info() != nil {
+		status.Name = t.Name()
+		for i, file := range t.Files() {
+			f := FileStatus{
+				Index:     i,
+				Path:      file.DisplayPath(),
+				Size:      file.Length(),
+				Completed: file.BytesCompleted(),
+				Selected:  e.selected(i),
+				StreamURL: streamPath(status.InfoHash, i, file.DisplayPath()),
+			}
+			if f.Selected {
+				status.Size += f.Size
+				status.Completed += f.Completed
+			}
+			status.Files = append(status.Files, f)
+		}
+		status.State = "downloading"
+		if status.Completed >= status.Size {
+			status.State = "complete"
+		}
+		if status.Size > 0 {
+			status.Percent = float64(status.Completed) / float64(status.Size) * 100
+		}
+	}
+	if e.Paused {
+		status.State = "paused"
+	}
+	return status
+}
+
+func streamPath(infoHash string, index int, name string) string {
+	return fmt.Sprintf("/stream/%s/%d/%s", infoHash, index, url.PathEscape(path.Base(name)))
+}
+
+// Handler returns the REST API of the daemon:
+//
+//	GET    /api/torrents                 list the torrents
+//	POST   /api/torrents                 add a torrent: {"magnet": "..."}, or a .torrent file (application/x-bittorrent)
+//	GET    /api/torrents/{hash}          status of a torrent
+//	DELETE /api/torrents/{hash}          remove a torrent, and its files with ?delete_data=true
+//	PUT    /api/torrents/{hash}/files    select the files to download: {"files": [0, 2]}, null for every file
+//	POST   /api/torrents/{hash}/pause    pause a torrent
+//	POST   /api/torrents/{hash}/resume   resume a torrent
+//	GET    /stream/{hash}/{index}/{name} stream a file of a torrent
+//	GET    /transcode/{hash}/{index}/... a file transcoded by ffmpeg, see `transcode.Transcoder.Serve`
+//	GET    /api/limits                   rate limits of the daemon
+//	PUT    /api/limits                   change the rate limits: {"download": 2000000, "upload": 0}, or {"reset": true}
+//
+// Errors are returned as {"error": "..."}. The requests changing something must be sent in JSON, see `SameOrigin`.
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/torrents", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, d.List(), nil)
+	})
+	mux.HandleFunc("POST /api/torrents", d.addHandler)
+	mux.HandleFunc("GET /api/torrents/{hash}", func(w http.ResponseWriter, r *http.Request) {
+		status, err := d.Get(r.PathValue("hash"))
+		writeJSON(w, r, http.StatusOK, status, err)
+	})
+	mux.HandleFunc("DELETE /api/torrents/{hash}", func(w http.ResponseWriter, r *http.Request) {
+		deleteData, _ := strconv.ParseBool(r.URL.Query().Get("delete_data"))
+		err := d.Remove(r.PathValue("hash"), deleteData)
+		writeJSON(w, r, http.StatusOK, map[string]bool{"removed": true}, err)
+	})
+	mux.HandleFunc("PUT /api/torrents/{hash}/files", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Files []int `json:"files"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		status, err := d.SelectFiles(r.PathValue("hash"), body.Files)
+		writeJSON(w, r, http.StatusOK, status, err)
+	})
+	mux.HandleFunc("POST /api/torrents/{hash}/pause", func(w http.ResponseWriter, r *http.Request) {
+		status, err := d.Pause(r.PathValue("hash"))
+		writeJSON(w, r, http.StatusOK, status, err)
+	})
+	mux.HandleFunc("POST /api/torrents/{hash}/resume", func(w http.ResponseWriter, r *http.Request) {
+		status, err := d.Resume(r.PathValue("hash"))
+		writeJSON(w, r, http.StatusOK, status, err)
+	})
+	mux.HandleFunc("GET /stream/{hash}/{index}/{name...}", d.streamHandler)
+	mux.HandleFunc("GET /transcode/{hash}/{index}/{name...}", d.transcodeHandler)
+	mux.Handle(ratelimit.Path, d.limiter.Handler())
+	return SameOrigin(mux)
+}
+
+// SameOrigin rejects the requests changing something (any method but GET, HEAD and OPTIONS) which a web page
+// of another site can send: a browser sends a POST in text/plain, or a form, to any address without asking,
+// including 127.0.0.1. The requests must be sent in JSON (or as a .torrent file), and not by another site
+// when the browser tells (Sec-Fetch-Site, Origin).
+func SameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+			writeError(w, http.StatusForbidden, errors.New("cross-site request"))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				writeError(w, http.StatusForbidden, fmt.Errorf("cross-origin request from %s", origin))
+				return
+			}
+		}
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" && mediaType != "application/x-bittorrent" {
+			writeError(w, http.StatusUnsupportedMediaType, errors.New("the Content-Type must be application/json"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *Daemon) addHandler(w http.ResponseWriter, r *http.Request) {
+	var status Status
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-bittorrent" {
+		var data []byte
+		if data, err = io.ReadAll(io.LimitReader(r.Body, maxTorrentFile)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		status, err = d.AddTorrentFile(data)
+	} else {
+		var body struct {
+			Magnet string `json:"magnet"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		status, err = d.AddMagnet(body.Magnet)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, status, nil)
+}
+
+// streamHandler streams a file of a torrent, whether it is selected or not.
+func (d *Daemon) streamHandler(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	file, err := d.File(r.PathValue("hash"), index)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	entry, err := client.NewFileReader(file)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer entry.Close()
+
+	contentType := mime.TypeByExtension(filepath.Ext(file.Path()))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	dlna.ContentFeatures(w, r)
+	http.ServeContent(w, r, file.DisplayPath(), time.Now(), entry)
+}
+
+// transcodeHandler serves a file of a torrent transcoded by ffmpeg, which reads it from its stream on the daemon.
+func (d *Daemon) transcodeHandler(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	file, err := d.File(r.PathValue("hash"), index)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	hash := file.Torrent().InfoHash().HexString()
+	in := transcode.Input{
+		ID:  fmt.Sprintf("%s/%d", hash, index),
+		URL: "http://" + r.Host + streamPath(hash, index, file.DisplayPath()),
+	}
+	d.transcoder.Serve(w, r, in, r.PathValue("name"))
+}
+
+func statusOf(err error) int {
+	if errors.Is(err, ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// writeJSON writes {value} with the stream paths made absolute, or the error if any.
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, value interface{}, err error) {
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	base := "http://" + r.Host
+	switch v := value.(type) {
+	case Status:
+		v.absolute(base)
+	case []Status:
+		for _, status := range v {
+			status.absolute(base)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logrus.Debugln("Error writing the response:", err)
+	}
+}
+
+// absolute prefixes the stream paths of the files with the base URL of the daemon.
+func (status Status) absolute(base string) {
+	for i := range status.Files {
+		status.Files[i].StreamURL = base + status.Files[i].StreamURL
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
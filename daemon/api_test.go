@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSameOrigin(t *testing.T) {
+	handler := SameOrigin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		headers     map[string]string
+		want        int
+	}{
+		{"get", http.MethodGet, "", nil, http.StatusNoContent},
+		{"get from another site", http.MethodGet, "", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusNoContent},
+		{"json", http.MethodPost, "application/json", nil, http.StatusNoContent},
+		{"json with charset", http.MethodPut, "application/json; charset=utf-8", nil, http.StatusNoContent},
+		{"torrent file", http.MethodPost, "application/x-bittorrent", nil, http.StatusNoContent},
+		{"same origin", http.MethodDelete, "application/json",
+			map[string]string{"Origin": "http://127.0.0.1:8790", "Sec-Fetch-Site": "same-origin"}, http.StatusNoContent},
+		{"typed in the browser", http.MethodPost, "application/json", map[string]string{"Sec-Fetch-Site": "none"}, http.StatusNoContent},
+		// What a web page sends without a CORS preflight
+		{"text/plain", http.MethodPost, "text/plain", nil, http.StatusUnsupportedMediaType},
+		{"form", http.MethodPost, "application/x-www-form-urlencoded", nil, http.StatusUnsupportedMediaType},
+		{"no content type", http.MethodPost, "", nil, http.StatusUnsupportedMediaType},
+		{"other site", http.MethodPost, "application/json",
+			map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"other origin", http.MethodPost, "application/json", map[string]string{"Origin": "http://localhost:3000"}, http.StatusForbidden},
+		{"same site", http.MethodPost, "application/json", map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"opaque origin", http.MethodPost, "application/json", map[string]string{"Origin": "null"}, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "http://127.0.0.1:8790/api/torrents", strings.NewReader(`{"magnet": "magnet:?xt=urn:btih:0"}`))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		for name, value := range test.headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("%s: status %d, want %d (%s)", test.name, w.Code, test.want, w.Body.String())
+		}
+	}
+}
+
+func TestHandlerRejectsCrossSite(t *testing.T) {
+	d := &Daemon{}
+	req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8790/api/torrents", strings.NewReader(`{"magnet": "magnet:?xt=urn:btih:0"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	d.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+}
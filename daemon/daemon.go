@@ -0,0 +1,417 @@
+/*
+Package daemon manages many torrents in a single long-running torrent client, and exposes them through a JSON REST API
+(see `Daemon.Handler`): torrents are added from magnets or .torrent files, their files are selected, paused, resumed,
+removed, and streamed over HTTP. Unlike a stream session, the daemon keeps running once a torrent is complete.
+The torrents are saved in the torgo config directory, so that they are added back when the daemon restarts.
+*/
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo/config"
+	"github.com/stl3/torgo/ratelimit"
+	"github.com/stl3/torgo/transcode"
+)
+
+const stateFile = "daemon.json"
+
+// transcodeDir is the directory of the data directory where the transcoded segments are cached.
+const transcodeDir = ".transcode"
+
+// ErrNotFound is returned for an info hash the daemon does not have.
+var ErrNotFound = errors.New("torrent not found")
+
+// Config is the configuration of the daemon.
+type Config struct {
+	DataDir     string // where the torrents are downloaded
+	TorrentPort int    // listen port of the torrent client
+	Proxy       string // HTTP proxy for the trackers, if any
+	// Connection limits, the defaults of the torrent client are kept when 0
+	EstablishedConnsPerTorrent int
+	HalfOpenConnsPerTorrent    int
+	TotalHalfOpenConns         int
+	// Limiter sets the rate limits of the torrent client, no limit when nil
+	Limiter *ratelimit.Limiter
+	FFmpeg  string // ffmpeg transcoding the streams, from the PATH when empty
+}
+
+// saved is a torrent as saved in the state of the daemon.
+type saved struct {
+	Magnet   string    `json:"magnet,omitempty"`
+	Torrent  []byte    `json:"torrent,omitempty"` // .torrent file, when it was added from one
+	Added    time.Time `json:"added"`
+	Paused   bool      `json:"paused"`
+	Selected []int     `json:"selected"` // indexes of the files to download, nil for every file
+}
+
+// entry is a torrent managed by the daemon.
+type entry struct {
+	saved
+	t *torrent.Torrent
+}
+
+// Daemon manages the torrents of a torrent client.
+type Daemon struct {
+	client  *torrent.Client
+	dataDir string
+	limiter *ratelimit.Limiter
+	// transcoder caches the transcoded segments in the data directory, until their torrent is removed
+	transcoder *transcode.Transcoder
+	mu         sync.Mutex
+	// every field below is guarded by mu
+	torrents map[metainfo.Hash]*entry
+	state    string // path of the state file, "" to not save it
+}
+
+// New starts the torrent client of the daemon and adds back the torrents it had.
+func New(cfg Config) (*Daemon, error) {
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		return nil, err
+	}
+	clientConfig := torrent.NewDefaultClientConfig()
+	clientConfig.DataDir = cfg.DataDir
+	clientConfig.ListenPort = cfg.TorrentPort
+	clientConfig.Seed = true
+	if cfg.EstablishedConnsPerTorrent > 0 {
+		clientConfig.EstablishedConnsPerTorrent = cfg.EstablishedConnsPerTorrent
+	}
+	if cfg.HalfOpenConnsPerTorrent > 0 {
+		clientConfig.HalfOpenConnsPerTorrent = cfg.HalfOpenConnsPerTorrent
+	}
+	if cfg.TotalHalfOpenConns > 0 {
+		clientConfig.TotalHalfOpenConns = cfg.TotalHalfOpenConns
+	}
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		clientConfig.HTTPProxy = http.ProxyURL(proxyURL)
+	}
+	limiter := cfg.Limiter
+	if limiter == nil {
+		limiter = ratelimit.New(ratelimit.Limits{}, ratelimit.Limits{}, ratelimit.Schedule{})
+	}
+	limiter.Configure(clientConfig)
+	c, err := torrent.NewClient(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	go limiter.Run(c.Closed())
+
+	d := &Daemon{
+		client:     c,
+		dataDir:    cfg.DataDir,
+		limiter:    limiter,
+		transcoder: transcode.New(cfg.FFmpeg, filepath.Join(cfg.DataDir, transcodeDir)),
+		torrents:   map[metainfo.Hash]*entry{},
+	}
+	if dir, err := config.Dir(); err != nil {
+		logrus.Warnln("The torrents of the daemon will not be saved:", err)
+	} else {
+		d.state = filepath.Join(dir, stateFile)
+		d.load()
+	}
+	return d, nil
+}
+
+// load adds back the torrents saved in the state file.
+func (d *Daemon) load() {
+	data, err := os.ReadFile(d.state)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		logrus.Warnln("Error loading the torrents of the daemon:", err)
+		return
+	}
+	var torrents []saved
+	if err := json.Unmarshal(data, &torrents); err != nil {
+		logrus.Warnln("Error loading the torrents of the daemon:", err)
+		return
+	}
+	for _, s := range torrents {
+		if _, err := d.add(s); err != nil {
+			logrus.Warnln("Error adding back a torrent:", err)
+		}
+	}
+}
+
+// save writes the torrents to the state file. mu must be held.
+func (d *Daemon) save() {
+	if d.state == "" {
+		return
+	}
+	torrents := []saved{}
+	for _, e := range d.torrents {
+		torrents = append(torrents, e.saved)
+	}
+	sort.Slice(torrents, func(i, j int) bool { return torrents[i].Added.Before(torrents[j].Added) })
+	data, err := json.MarshalIndent(torrents, "", "\t")
+	if err == nil {
+		err = os.WriteFile(d.state, data, 0644)
+	}
+	if err != nil {
+		logrus.Warnln("Error saving the torrents of the daemon:", err)
+	}
+}
+
+// Close stops the torrent client and the transcoding. The torrents are kept in the state file.
+func (d *Daemon) Close() {
+	d.transcoder.Close()
+	d.client.Close()
+}
+
+// AddMagnet adds a torrent from a magnet link, or returns the torrent if it was already added.
+func (d *Daemon) AddMagnet(magnet string) (Status, error) {
+	if !strings.HasPrefix(magnet, "magnet:") {
+		return Status{}, errors.New("invalid magnet link")
+	}
+	return d.addSaved(saved{Magnet: magnet, Added: time.Now()})
+}
+
+// AddTorrentFile adds a torrent from the content of a .torrent file, or returns the torrent if it was already added.
+func (d *Daemon) AddTorrentFile(data []byte) (Status, error) {
+	return d.addSaved(saved{Torrent: data, Added: time.Now()})
+}
+
+func (d *Daemon) addSaved(s saved) (Status, error) {
+	e, err := d.add(s)
+	if err != nil {
+		return Status{}, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.save()
+	return e.status(), nil
+}
+
+// add adds a torrent to the client and starts downloading it (unless it is paused).
+func (d *Daemon) add(s saved) (*entry, error) {
+	var t *torrent.Torrent
+	var err error
+	if len(s.Torrent) > 0 {
+		var mi *metainfo.MetaInfo
+		if mi, err = metainfo.Load(bytes.NewReader(s.Torrent)); err != nil {
+			return nil, fmt.Errorf("invalid torrent file: %w", err)
+		}
+		t, err = d.client.AddTorrent(mi)
+	} else {
+		t, err = d.client.AddMagnet(s.Magnet)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.torrents[t.InfoHash()]; ok {
+		return e, nil
+	}
+	e := &entry{saved: s, t: t}
+	d.torrents[t.InfoHash()] = e
+	if e.Paused {
+		t.DisallowDataDownload()
+		t.DisallowDataUpload()
+	}
+	go func() {
+		select {
+		case <-t.GotInfo():
+		case <-t.Closed():
+			return
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		e.applySelection()
+	}()
+	return e, nil
+}
+
+// applySelection downloads the selected files and only them. The info of the torrent must be known.
+func (e *entry) applySelection() {
+	if e.t.Info() == nil {
+		return
+	}
+	for i, file := range e.t.Files() {
+		if e.selected(i) {
+			file.Download()
+		} else {
+			file.SetPriority(torrent.PiecePriorityNone)
+		}
+	}
+}
+
+func (e *entry) selected(index int) bool {
+	if e.Selected == nil {
+		return true
+	}
+	for _, i := range e.Selected {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the torrent with the given info hash. mu must be held.
+func (d *Daemon) get(infoHash string) (*entry, error) {
+	var hash metainfo.Hash
+	if err := hash.FromHexString(infoHash); err != nil {
+		return nil, ErrNotFound
+	}
+	e, ok := d.torrents[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return e, nil
+}
+
+// List returns the status of every torrent, oldest first.
+func (d *Daemon) List() []Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	statuses := []Status{}
+	for _, e := range d.torrents {
+		statuses = append(statuses, e.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Added.Before(statuses[j].Added) })
+	return statuses
+}
+
+// Get returns the status of a torrent.
+func (d *Daemon) Get(infoHash string) (Status, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, err := d.get(infoHash)
+	if err != nil {
+		return Status{}, err
+	}
+	return e.status(), nil
+}
+
+// SelectFiles sets the files of a torrent to download, by index. nil selects every file.
+func (d *Daemon) SelectFiles(infoHash string, files []int) (Status, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, err := d.get(infoHash)
+	if err != nil {
+		return Status{}, err
+	}
+	if info := e.t.Info(); info != nil {
+		for _, i := range files {
+			if i < 0 || i >= len(e.t.Files()) {
+				return Status{}, fmt.Errorf("no file %d in the torrent", i)
+			}
+		}
+	}
+	e.Selected = files
+	e.applySelection()
+	d.save()
+	return e.status(), nil
+}
+
+// Pause stops the transfers of a torrent, its peers are kept.
+func (d *Daemon) Pause(infoHash string) (Status, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, err := d.get(infoHash)
+	if err != nil {
+		return Status{}, err
+	}
+	e.t.DisallowDataDownload()
+	e.t.DisallowDataUpload()
+	e.Paused = true
+	d.save()
+	return e.status(), nil
+}
+
+// Resume restarts the transfers of a paused torrent.
+func (d *Daemon) Resume(infoHash string) (Status, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, err := d.get(infoHash)
+	if err != nil {
+		return Status{}, err
+	}
+	e.t.AllowDataDownload()
+	e.t.AllowDataUpload()
+	e.Paused = false
+	d.save()
+	return e.status(), nil
+}
+
+// Remove drops a torrent, and deletes its downloaded files if {deleteData}.
+func (d *Daemon) Remove(infoHash string, deleteData bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, err := d.get(infoHash)
+	if err != nil {
+		return err
+	}
+	name := ""
+	if e.t.Info() != nil {
+		name = e.t.Name()
+	}
+	e.t.Drop()
+	delete(d.torrents, e.t.InfoHash())
+	d.save()
+	if err := d.transcoder.Remove(e.t.InfoHash().HexString()); err != nil {
+		logrus.Debugln("Error deleting the transcodes:", err)
+	}
+	if deleteData && name != "" {
+		// The name comes from the metadata of the torrent, it must not point outside of the data directory
+		path, ok := insideDir(d.dataDir, name)
+		if !ok {
+			return fmt.Errorf("the data of %q are not in %s, they are not deleted", name, d.dataDir)
+		}
+		return os.RemoveAll(path)
+	}
+	return nil
+}
+
+// insideDir returns the path of {name} in {dir}, and whether it is strictly inside {dir}.
+func insideDir(dir, name string) (string, bool) {
+	path := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path, false
+	}
+	return path, true
+}
+
+// File returns a file of a torrent, waiting for the info of the torrent if needed.
+func (d *Daemon) File(infoHash string, index int) (*torrent.File, error) {
+	d.mu.Lock()
+	e, err := d.get(infoHash)
+	d.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-e.t.GotInfo():
+	case <-e.t.Closed():
+		return nil, ErrNotFound
+	case <-time.After(time.Minute):
+		return nil, errors.New("timed out waiting for the torrent info")
+	}
+	files := e.t.Files()
+	if index < 0 || index >= len(files) {
+		return nil, fmt.Errorf("no file %d in the torrent", index)
+	}
+	return files[index], nil
+}
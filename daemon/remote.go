@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Remote is a client of the REST API of a running daemon.
+type Remote struct {
+	URL  string // e.g. http://localhost:8790
+	HTTP *http.Client
+}
+
+// NewRemote returns a client of the daemon listening on {address} (`host:port`, or `:port` for this machine).
+func NewRemote(address string) *Remote {
+	if !strings.Contains(address, "://") {
+		if strings.HasPrefix(address, ":") {
+			address = "localhost" + address
+		}
+		address = "http://" + address
+	}
+	return &Remote{URL: strings.TrimSuffix(address, "/"), HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// do sends a request to the daemon and decodes its JSON response into {out} (if not nil).
+func (r *Remote) do(method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, r.URL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := r.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("daemon unreachable (is `torgo daemon` running?): %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiError) == nil && apiError.Error != "" {
+			if resp.StatusCode == http.StatusNotFound {
+				return fmt.Errorf("%w: %s", ErrNotFound, apiError.Error)
+			}
+			return errors.New(apiError.Error)
+		}
+		return fmt.Errorf("daemon: %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (r *Remote) doJSON(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	return r.do(method, path, "application/json", body, out)
+}
+
+// List returns the status of every torrent of the daemon.
+func (r *Remote) List() ([]Status, error) {
+	var statuses []Status
+	return statuses, r.doJSON(http.MethodGet, "/api/torrents", nil, &statuses)
+}
+
+// Get returns the status of a torrent.
+func (r *Remote) Get(infoHash string) (Status, error) {
+	var status Status
+	return status, r.doJSON(http.MethodGet, "/api/torrents/"+url.PathEscape(infoHash), nil, &status)
+}
+
+// AddMagnet adds a torrent from a magnet link.
+func (r *Remote) AddMagnet(magnet string) (Status, error) {
+	var status Status
+	return status, r.doJSON(http.MethodPost, "/api/torrents", map[string]string{"magnet": magnet}, &status)
+}
+
+// AddTorrentFile adds a torrent from the content of a .torrent file.
+func (r *Remote) AddTorrentFile(data []byte) (Status, error) {
+	var status Status
+	return status, r.do(http.MethodPost, "/api/torrents", "application/x-bittorrent", bytes.NewReader(data), &status)
+}
+
+// SelectFiles sets the files of a torrent to download, by index. nil selects every file.
+func (r *Remote) SelectFiles(infoHash string, files []int) (Status, error) {
+	var status Status
+	body := map[string][]int{"files": files}
+	return status, r.doJSON(http.MethodPut, "/api/torrents/"+url.PathEscape(infoHash)+"/files", body, &status)
+}
+
+// Pause stops the transfers of a torrent.
+func (r *Remote) Pause(infoHash string) (Status, error) {
+	var status Status
+	return status, r.doJSON(http.MethodPost, "/api/torrents/"+url.PathEscape(infoHash)+"/pause", nil, &status)
+}
+
+// Resume restarts the transfers of a paused torrent.
+func (r *Remote) Resume(infoHash string) (Status, error) {
+	var status Status
+	return status, r.doJSON(http.MethodPost, "/api/torrents/"+url.PathEscape(infoHash)+"/resume", nil, &status)
+}
+
+// Remove drops a torrent, and deletes its downloaded files if {deleteData}.
+func (r *Remote) Remove(infoHash string, deleteData bool) error {
+	path := fmt.Sprintf("/api/torrents/%s?delete_data=%t", url.PathEscape(infoHash), deleteData)
+	return r.doJSON(http.MethodDelete, path, nil, nil)
+}
@@ -0,0 +1,226 @@
+package dlna
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Following a cast
+const (
+	pollInterval = 2 * time.Second
+	startTimeout = time.Minute // for the renderer to start playing
+	maxFailures  = 5           // renderer requests failing in a row before the renderer is considered gone
+)
+
+// protocolFlags tell the renderer it can seek in the stream by bytes (range requests).
+const protocolFlags = "DLNA.ORG_OP=01;DLNA.ORG_CI=0;DLNA.ORG_FLAGS=01700000000000000000000000000000"
+
+// Media is a stream played on a renderer.
+type Media struct {
+	URL          string
+	Title        string
+	SubtitlePath string // .srt file, served to the renderer while it plays
+	// Where the playback starts: Start, or StartPercent of the duration when Start is 0
+	Start        time.Duration
+	StartPercent float64
+	// OnPosition is called with the position of the playback while the renderer plays, if not nil
+	OnPosition func(position, duration time.Duration)
+}
+
+// mimeType returns the MIME type of a stream from its extension, video/mp4 when unknown.
+func mimeType(name string) string {
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".mkv":
+		return "video/x-matroska"
+	case ".avi":
+		return "video/x-msvideo"
+	default:
+		if contentType := mime.TypeByExtension(ext); contentType != "" {
+			contentType, _, _ = strings.Cut(contentType, ";")
+			return contentType
+		}
+	}
+	return "video/mp4"
+}
+
+// DIDL returns the DIDL-Lite metadata of the media at {mediaURL}, with the subtitles at {subtitleURL} if not empty.
+func (m Media) DIDL(mediaURL, subtitleURL string) string {
+	name := mediaURL
+	if u, err := url.Parse(mediaURL); err == nil {
+		name = u.Path // without the query
+	}
+	contentType := mimeType(name)
+	class := "object.item.videoItem"
+	if strings.HasPrefix(contentType, "audio/") {
+		class = "object.item.audioItem.musicTrack"
+	}
+	escape := func(s string) string {
+		var b bytes.Buffer
+		_ = xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	var b strings.Builder
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/"`)
+	b.WriteString(` xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" xmlns:sec="http://www.sec.co.kr/">`)
+	b.WriteString(`<item id="0" parentID="-1" restricted="1">`)
+	fmt.Fprintf(&b, `<dc:title>%s</dc:title><upnp:class>%s</upnp:class>`, escape(m.Title), class)
+	fmt.Fprintf(&b, `<res protocolInfo="http-get:*:%s:%s">%s</res>`, contentType, protocolFlags, escape(mediaURL))
+	if subtitleURL != "" {
+		// Subtitles as understood by most renderers, and by Samsung TVs
+		fmt.Fprintf(&b, `<res protocolInfo="http-get:*:text/srt:*">%s</res>`, escape(subtitleURL))
+		fmt.Fprintf(&b, `<sec:CaptionInfoEx sec:type="srt">%s</sec:CaptionInfoEx>`, escape(subtitleURL))
+	}
+	b.WriteString(`</item></DIDL-Lite>`)
+	return b.String()
+}
+
+// LocalURL returns {rawURL} reachable from the network when it is served on the loopback: with the address {ip} instead.
+func LocalURL(rawURL string, ip net.IP) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || ip == nil {
+		return rawURL
+	}
+	host := u.Hostname()
+	if host == "" || host == "localhost" || net.ParseIP(host).IsLoopback() || net.ParseIP(host).IsUnspecified() {
+		u.Host = net.JoinHostPort(ip.String(), u.Port())
+	}
+	return u.String()
+}
+
+// serveFile serves the file at {filePath} on {ip} until it is closed, and returns its URL.
+func serveFile(filePath string, ip net.IP) (string, func(), error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return "", nil, err
+	}
+	name := filepath.Base(filePath)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if strings.EqualFold(filepath.Ext(name), ".srt") {
+			w.Header().Set("Content-Type", "text/srt")
+		}
+		http.ServeFile(w, r, filePath)
+	})}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	fileURL := fmt.Sprintf("http://%s/%s", listener.Addr(), url.PathEscape(name))
+	return fileURL, func() { _ = server.Close() }, nil
+}
+
+// ContentFeatures sets the DLNA headers of a stream requested by a renderer, which tell it can seek in the stream.
+func ContentFeatures(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("getcontentFeatures.dlna.org") == "1" {
+		w.Header().Set("contentFeatures.dlna.org", protocolFlags)
+	}
+	if r.Header.Get("transferMode.dlna.org") != "" {
+		w.Header().Set("transferMode.dlna.org", "Streaming")
+	}
+}
+
+// Cast plays the media on the renderer and returns once the renderer stopped playing it,
+// or once {stop} is closed: the renderer is stopped then.
+func (r *Renderer) Cast(m Media, stop <-chan struct{}) error {
+	ip, err := r.LocalIP()
+	if err != nil {
+		return fmt.Errorf("%s: no route to the renderer: %w", r.Name, err)
+	}
+	mediaURL := LocalURL(m.URL, ip)
+	subtitleURL := ""
+	if m.SubtitlePath != "" {
+		fileURL, closeFile, err := serveFile(m.SubtitlePath, ip)
+		if err != nil {
+			logrus.Warnln("The subtitles are not sent to the renderer:", err)
+		} else {
+			defer closeFile()
+			subtitleURL = fileURL
+		}
+	}
+	logrus.Debugf("DLNA: casting %s to %s", mediaURL, r.Name)
+	if err := r.SetURI(mediaURL, m.DIDL(mediaURL, subtitleURL)); err != nil {
+		return err
+	}
+	if err := r.Play(); err != nil {
+		return err
+	}
+	return r.follow(m, stop)
+}
+
+// follow polls the state of the renderer until it stopped playing the media, or until {stop} is closed.
+func (r *Renderer) follow(m Media, stop <-chan struct{}) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	started := time.Now()
+	playing := false
+	sought := m.Start <= 0 && m.StartPercent <= 0
+	failures := 0
+	for {
+		select {
+		case <-stop:
+			if err := r.Stop(); err != nil {
+				logrus.Debugln(err)
+			}
+			return nil
+		case <-ticker.C:
+		}
+		state, err := r.State()
+		if err != nil {
+			if failures++; failures >= maxFailures {
+				return fmt.Errorf("lost the renderer: %w", err)
+			}
+			continue
+		}
+		failures = 0
+		switch state {
+		case StatePlaying, StatePaused:
+			playing = true
+			position, duration, err := r.Position()
+			if err != nil {
+				logrus.Debugln(err)
+				continue
+			}
+			if !sought {
+				sought = r.seekStart(m, duration) || time.Since(started) > startTimeout
+				continue
+			}
+			if m.OnPosition != nil && position > 0 {
+				m.OnPosition(position, duration)
+			}
+		case StateStopped, StateNoMedia:
+			if playing {
+				return nil
+			}
+			if time.Since(started) > startTimeout {
+				return errors.New(r.Name + " did not play the stream, it may not support its format")
+			}
+		}
+	}
+}
+
+// seekStart seeks to the start of the media, and reports whether it is done:
+// the duration is needed to seek to a percentage, renderers only know it after a while.
+func (r *Renderer) seekStart(m Media, duration time.Duration) bool {
+	start := m.Start
+	if start <= 0 {
+		if duration <= 0 {
+			return false
+		}
+		start = time.Duration(m.StartPercent / 100 * float64(duration))
+	}
+	if err := r.Seek(start); err != nil {
+		logrus.Warnln("Error seeking to the start position:", err)
+	}
+	return true
+}
@@ -0,0 +1,283 @@
+package dlna
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// avTransport is the service type of AVTransport, without its version.
+const avTransport = "urn:schemas-upnp-org:service:AVTransport:"
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Renderer is a MediaRenderer, controlled through its AVTransport service.
+type Renderer struct {
+	Name        string // friendly name of the device
+	UDN         string // unique device name
+	Location    string // URL of the description of the device
+	serviceType string // AVTransport version of the device
+	controlURL  string
+}
+
+func (r *Renderer) String() string {
+	return r.Name
+}
+
+// Host returns the host of the renderer, without its port.
+func (r *Renderer) Host() string {
+	u, err := url.Parse(r.Location)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// device is a device in a UPnP description, a renderer may be embedded in another device.
+type device struct {
+	DeviceType   string    `xml:"deviceType"`
+	FriendlyName string    `xml:"friendlyName"`
+	UDN          string    `xml:"UDN"`
+	Services     []service `xml:"serviceList>service"`
+	Devices      []device  `xml:"deviceList>device"`
+}
+
+type service struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+// renderer returns the device with an AVTransport service among the device and its embedded devices.
+func (d device) renderer() (device, service, bool) {
+	for _, s := range d.Services {
+		if strings.HasPrefix(s.ServiceType, avTransport) {
+			return d, s, true
+		}
+	}
+	for _, embedded := range d.Devices {
+		if found, s, ok := embedded.renderer(); ok {
+			return found, s, true
+		}
+	}
+	return device{}, service{}, false
+}
+
+// NewRenderer returns the renderer described at {location}.
+func NewRenderer(ctx context.Context, location string) (*Renderer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", location, resp.Status)
+	}
+	var description struct {
+		URLBase string `xml:"URLBase"`
+		Device  device `xml:"device"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&description); err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	d, s, ok := description.Device.renderer()
+	if !ok {
+		return nil, fmt.Errorf("%s: no AVTransport service", location)
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if description.URLBase != "" {
+		if u, err := url.Parse(description.URLBase); err == nil {
+			base = u
+		}
+	}
+	control, err := base.Parse(s.ControlURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	name := strings.TrimSpace(d.FriendlyName)
+	if name == "" {
+		name = base.Host
+	}
+	udn := d.UDN
+	if udn == "" {
+		udn = location
+	}
+	return &Renderer{
+		Name:        name,
+		UDN:         udn,
+		Location:    location,
+		serviceType: s.ServiceType,
+		controlURL:  control.String(),
+	}, nil
+}
+
+// action calls an action of the AVTransport service with the arguments {args} (name and value pairs),
+// and returns its output arguments.
+func (r *Renderer) action(name string, args ...string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	body.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s"><InstanceID>0</InstanceID>`, name, r.serviceType)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&body, "<%s>", args[i])
+		_ = xml.EscapeText(&body, []byte(args[i+1]))
+		fmt.Fprintf(&body, "</%s>", args[i])
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, name)
+
+	req, err := http.NewRequest(http.MethodPost, r.controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, r.serviceType, name))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope struct {
+		Body struct {
+			Response struct {
+				Arguments []struct {
+					XMLName xml.Name
+					Value   string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:",any"`
+			Fault struct {
+				Code        int    `xml:"detail>UPnPError>errorCode"`
+				Description string `xml:"detail>UPnPError>errorDescription"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("%s: %s: %w", r.Name, name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		fault := envelope.Body.Fault
+		if fault.Code != 0 {
+			return nil, fmt.Errorf("%s: %s: UPnP error %d %s", r.Name, name, fault.Code, fault.Description)
+		}
+		return nil, fmt.Errorf("%s: %s: %s", r.Name, name, resp.Status)
+	}
+	out := map[string]string{}
+	for _, arg := range envelope.Body.Response.Arguments {
+		out[arg.XMLName.Local] = arg.Value
+	}
+	return out, nil
+}
+
+// SetURI sets the media played by the renderer: {uri} with its DIDL-Lite {metadata} (see `Media.DIDL`).
+func (r *Renderer) SetURI(uri, metadata string) error {
+	_, err := r.action("SetAVTransportURI", "CurrentURI", uri, "CurrentURIMetaData", metadata)
+	return err
+}
+
+// Play plays the media of the renderer, or resumes it.
+func (r *Renderer) Play() error {
+	_, err := r.action("Play", "Speed", "1")
+	return err
+}
+
+// Pause pauses the playback.
+func (r *Renderer) Pause() error {
+	_, err := r.action("Pause")
+	return err
+}
+
+// Stop stops the playback.
+func (r *Renderer) Stop() error {
+	_, err := r.action("Stop")
+	return err
+}
+
+// Seek seeks to {position} from the start of the media.
+func (r *Renderer) Seek(position time.Duration) error {
+	_, err := r.action("Seek", "Unit", "REL_TIME", "Target", formatTime(position))
+	return err
+}
+
+// Transport states of a renderer
+const (
+	StatePlaying       = "PLAYING"
+	StatePaused        = "PAUSED_PLAYBACK"
+	StateStopped       = "STOPPED"
+	StateTransitioning = "TRANSITIONING"
+	StateNoMedia       = "NO_MEDIA_PRESENT"
+)
+
+// State returns the transport state of the renderer, e.g. StatePlaying.
+func (r *Renderer) State() (string, error) {
+	out, err := r.action("GetTransportInfo")
+	if err != nil {
+		return "", err
+	}
+	return out["CurrentTransportState"], nil
+}
+
+// Position returns the position of the playback and the duration of the media, 0 when the renderer does not know.
+func (r *Renderer) Position() (position, duration time.Duration, err error) {
+	out, err := r.action("GetPositionInfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseTime(out["RelTime"]), parseTime(out["TrackDuration"]), nil
+}
+
+// formatTime returns a duration as H:MM:SS.
+func formatTime(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// parseTime parses a duration written H:MM:SS(.F), 0 when it is invalid or unknown (e.g. NOT_IMPLEMENTED).
+func parseTime(s string) time.Duration {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		value, err := strconv.ParseFloat(parts[i], 64)
+		if err != nil {
+			return 0
+		}
+		d += time.Duration(value * float64(unit))
+	}
+	return d
+}
+
+// LocalIP returns the address of this machine on the network of the renderer.
+func (r *Renderer) LocalIP() (net.IP, error) {
+	host := r.Host()
+	if host == "" {
+		return nil, errors.New("invalid renderer location")
+	}
+	// Nothing is sent, the route to the renderer gives the address
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "1900"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
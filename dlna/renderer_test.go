@@ -0,0 +1,246 @@
+package dlna
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testServiceType = avTransport + "1"
+
+// testDescription is a renderer embedded in a root device, as many TVs describe themselves.
+const testDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<device>
+	<deviceType>urn:schemas-upnp-org:device:Basic:1</deviceType>
+	<friendlyName>Root</friendlyName>
+	<deviceList><device>
+		<deviceType>urn:schemas-upnp-org:device:MediaRenderer:1</deviceType>
+		<friendlyName> Living Room TV </friendlyName>
+		<UDN>uuid:renderer</UDN>
+		<serviceList><service>
+			<serviceType>` + testServiceType + `</serviceType>
+			<controlURL>/upnp/control/AVTransport1</controlURL>
+		</service></serviceList>
+	</device></deviceList>
+</device>
+</root>`
+
+// soapCall is an action received by the fake AVTransport endpoint.
+type soapCall struct {
+	soapAction string
+	body       string // raw envelope
+	name       string
+	args       map[string]string
+}
+
+// fakeRenderer serves the description of a renderer and answers its AVTransport actions.
+type fakeRenderer struct {
+	mu    sync.Mutex
+	calls []soapCall
+	// answer returns the status and the output arguments of an action, 200 and none when not set
+	answer func(call soapCall) (int, map[string]string)
+}
+
+func newFakeRenderer(t *testing.T) (*fakeRenderer, *Renderer) {
+	t.Helper()
+	fake := &fakeRenderer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /description.xml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, testDescription)
+	})
+	mux.HandleFunc("POST /upnp/control/AVTransport1", fake.control)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := NewRenderer(ctx, srv.URL+"/description.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, r
+}
+
+func (fake *fakeRenderer) control(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	var envelope struct {
+		Body struct {
+			Action struct {
+				XMLName   xml.Name
+				Arguments []struct {
+					XMLName xml.Name
+					Value   string `xml:",chardata"`
+				} `xml:",any"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	call := soapCall{
+		soapAction: r.Header.Get("SOAPAction"),
+		body:       string(data),
+		name:       envelope.Body.Action.XMLName.Local,
+		args:       map[string]string{},
+	}
+	for _, arg := range envelope.Body.Action.Arguments {
+		call.args[arg.XMLName.Local] = arg.Value
+	}
+	fake.mu.Lock()
+	fake.calls = append(fake.calls, call)
+	answer := fake.answer
+	fake.mu.Unlock()
+
+	status, out := http.StatusOK, map[string]string(nil)
+	if answer != nil {
+		status, out = answer(call)
+	}
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(status)
+	if status != http.StatusOK {
+		fmt.Fprint(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault>`+
+			`<detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>701</errorCode>`+
+			`<errorDescription>Transition not available</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+		return
+	}
+	fmt.Fprintf(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><u:%sResponse xmlns:u="%s">`, call.name, testServiceType)
+	for name, value := range out {
+		fmt.Fprintf(w, "<%s>%s</%s>", name, value, name)
+	}
+	fmt.Fprintf(w, `</u:%sResponse></s:Body></s:Envelope>`, call.name)
+}
+
+func (fake *fakeRenderer) lastCall(t *testing.T) soapCall {
+	t.Helper()
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.calls) == 0 {
+		t.Fatal("no action received")
+	}
+	return fake.calls[len(fake.calls)-1]
+}
+
+func TestNewRenderer(t *testing.T) {
+	_, r := newFakeRenderer(t)
+	if r.Name != "Living Room TV" || r.UDN != "uuid:renderer" || r.serviceType != testServiceType {
+		t.Errorf("renderer = %q %q %q", r.Name, r.UDN, r.serviceType)
+	}
+	if !strings.HasSuffix(r.controlURL, "/upnp/control/AVTransport1") {
+		t.Errorf("control URL = %q", r.controlURL)
+	}
+	if r.Host() != "127.0.0.1" {
+		t.Errorf("host = %q", r.Host())
+	}
+}
+
+func TestRendererActions(t *testing.T) {
+	fake, r := newFakeRenderer(t)
+	media := Media{Title: `Tom & Jerry <1940>`}
+	metadata := media.DIDL("http://192.168.1.2:8080/stream.mkv?a=1&b=2", "http://192.168.1.2:8080/subtitles.srt")
+
+	tests := []struct {
+		name string
+		call func() error
+		args map[string]string
+	}{
+		{"SetAVTransportURI", func() error { return r.SetURI("http://192.168.1.2:8080/stream.mkv?a=1&b=2", metadata) },
+			map[string]string{"InstanceID": "0", "CurrentURI": "http://192.168.1.2:8080/stream.mkv?a=1&b=2", "CurrentURIMetaData": metadata}},
+		{"Play", r.Play, map[string]string{"InstanceID": "0", "Speed": "1"}},
+		{"Pause", r.Pause, map[string]string{"InstanceID": "0"}},
+		{"Seek", func() error { return r.Seek(time.Hour + 2*time.Minute + 3*time.Second + 400*time.Millisecond) },
+			map[string]string{"InstanceID": "0", "Unit": "REL_TIME", "Target": "1:02:03"}},
+		{"Stop", r.Stop, map[string]string{"InstanceID": "0"}},
+	}
+	for _, test := range tests {
+		if err := test.call(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		call := fake.lastCall(t)
+		if call.name != test.name {
+			t.Errorf("action = %q, want %q", call.name, test.name)
+		}
+		if want := fmt.Sprintf(`"%s#%s"`, testServiceType, test.name); call.soapAction != want {
+			t.Errorf("%s: SOAPAction = %s, want %s", test.name, call.soapAction, want)
+		}
+		if !reflect.DeepEqual(call.args, test.args) {
+			t.Errorf("%s: arguments = %q, want %q", test.name, call.args, test.args)
+		}
+	}
+
+	// The metadata is sent as text: the DIDL-Lite is escaped, and so are the characters escaped within it
+	set := fake.calls[0]
+	if strings.Contains(set.body, "<DIDL-Lite") || !strings.Contains(set.body, "&lt;DIDL-Lite") {
+		t.Errorf("DIDL-Lite not escaped: %s", set.body)
+	}
+	if !strings.Contains(set.body, "Tom &amp;amp; Jerry &amp;lt;1940&amp;gt;") {
+		t.Errorf("title not escaped twice: %s", set.body)
+	}
+	for _, want := range []string{
+		`<dc:title>Tom &amp; Jerry &lt;1940&gt;</dc:title>`,
+		`protocolInfo="http-get:*:video/x-matroska:` + protocolFlags + `">http://192.168.1.2:8080/stream.mkv?a=1&amp;b=2</res>`,
+		`<sec:CaptionInfoEx sec:type="srt">http://192.168.1.2:8080/subtitles.srt</sec:CaptionInfoEx>`,
+	} {
+		if !strings.Contains(set.args["CurrentURIMetaData"], want) {
+			t.Errorf("metadata without %s: %s", want, set.args["CurrentURIMetaData"])
+		}
+	}
+}
+
+func TestRendererStateAndPosition(t *testing.T) {
+	fake, r := newFakeRenderer(t)
+	fake.answer = func(call soapCall) (int, map[string]string) {
+		switch call.name {
+		case "GetTransportInfo":
+			return http.StatusOK, map[string]string{"CurrentTransportState": StatePlaying, "CurrentSpeed": "1"}
+		case "GetPositionInfo":
+			return http.StatusOK, map[string]string{"RelTime": "0:01:30.500", "TrackDuration": "1:45:00"}
+		}
+		return http.StatusOK, nil
+	}
+	state, err := r.State()
+	if err != nil || state != StatePlaying {
+		t.Errorf("state = %q, %v", state, err)
+	}
+	position, duration, err := r.Position()
+	if err != nil || position != 90*time.Second+500*time.Millisecond || duration != time.Hour+45*time.Minute {
+		t.Errorf("position = %s, duration = %s, %v", position, duration, err)
+	}
+}
+
+func TestRendererFault(t *testing.T) {
+	fake, r := newFakeRenderer(t)
+	fake.answer = func(soapCall) (int, map[string]string) {
+		return http.StatusInternalServerError, nil
+	}
+	err := r.Pause()
+	if err == nil || !strings.Contains(err.Error(), "UPnP error 701 Transition not available") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"0:00:00":         0,
+		"1:02:03":         time.Hour + 2*time.Minute + 3*time.Second,
+		"00:00:05.250":    5*time.Second + 250*time.Millisecond,
+		"NOT_IMPLEMENTED": 0,
+		"":                0,
+	} {
+		if got := parseTime(s); got != want {
+			t.Errorf("parseTime(%q) = %s, want %s", s, got, want)
+		}
+	}
+	if got := formatTime(parseTime("2:03:04")); got != "2:03:04" {
+		t.Errorf("formatTime = %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Package dlna plays the streams on the DLNA/UPnP MediaRenderers of the local network (smart TVs, speakers, Kodi...).
+The renderers are found with SSDP (see `Discover`), and controlled through their AVTransport service:
+a stream is sent to a renderer with `SetAVTransportURI` and its DIDL-Lite metadata, then played, paused, sought or stopped.
+*/
+package dlna
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SSDPAddr is where the SSDP searches are sent, the multicast address of SSDP.
+var SSDPAddr = "239.255.255.250:1900"
+
+// MediaRenderer is the device type searched.
+const MediaRenderer = "urn:schemas-upnp-org:device:MediaRenderer:1"
+
+// Discover searches the MediaRenderers of the network for {timeout}, and returns them by name.
+func Discover(timeout time.Duration) ([]*Renderer, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	addr, err := net.ResolveUDPAddr("udp4", SSDPAddr)
+	if err != nil {
+		return nil, err
+	}
+	search := strings.Join([]string{
+		"M-SEARCH * HTTP/1.1",
+		"HOST: " + SSDPAddr,
+		`MAN: "ssdp:discover"`,
+		fmt.Sprintf("MX: %d", max(int(timeout/time.Second)-1, 1)),
+		"ST: " + MediaRenderer,
+		"", "",
+	}, "\r\n")
+	// UDP may lose a search, it is sent twice
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteTo([]byte(search), addr); err != nil {
+			return nil, fmt.Errorf("SSDP search: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*timeout)
+	defer cancel()
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		renderers []*Renderer
+		locations = map[string]bool{}
+	)
+	buf := make([]byte, 8192)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		location := resp.Header.Get("Location")
+		if location == "" || locations[location] {
+			continue
+		}
+		locations[location] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := NewRenderer(ctx, location)
+			if err != nil {
+				logrus.Debugln("DLNA:", err)
+				return
+			}
+			mu.Lock()
+			renderers = append(renderers, r)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return unique(renderers), nil
+}
+
+// unique returns the renderers sorted by name, once each: a device may answer on several interfaces.
+func unique(renderers []*Renderer) []*Renderer {
+	seen := map[string]bool{}
+	var found []*Renderer
+	for _, r := range renderers {
+		if !seen[r.UDN] {
+			seen[r.UDN] = true
+			found = append(found, r)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return strings.ToLower(found[i].Name) < strings.ToLower(found[j].Name)
+	})
+	return found
+}
@@ -0,0 +1,236 @@
+/*
+Package health diagnoses the providers: it checks that every mirror of a provider is reachable
+and runs a known canary query to make sure the extractor still understands the search pages.
+The outcome of every check is saved so the CLI can tell which providers are currently broken.
+*/
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo"
+	"github.com/stl3/torgo/config"
+	"github.com/stl3/torgo/models"
+	"github.com/stl3/torgo/request"
+)
+
+// Canary is a query which is known to always return results on a provider.
+type Canary struct {
+	Query    string
+	Category torgo.Category
+}
+
+// DefaultCanary is used for providers that are not listed in `Canaries`.
+var DefaultCanary = Canary{Query: "ubuntu", Category: torgo.CategoryAll}
+
+// Canaries holds the canary queries of the providers that can not search for `DefaultCanary`.
+var Canaries = map[string]Canary{
+	"YIFY":         {Query: "big buck bunny", Category: torgo.CategoryMovie},
+	"eztv":         {Query: "the simpsons", Category: torgo.CategoryTV},
+	"Audiobookbay": {Query: "harry potter", Category: torgo.CategoryAudiobook},
+	"Sukebei":      {Query: "1080p", Category: torgo.CategoryAll},
+}
+
+const (
+	canaryCount   = 20 // results asked from the provider
+	canarySamples = 5  // results whose magnet is resolved and validated
+	mirrorTimeout = 15 * time.Second
+	historyLength = 30             // checks kept per provider
+	brokenFor     = 24 * time.Hour // how long a failed check marks a provider as broken
+	fileName      = "health.json"
+)
+
+// MirrorResult is the reachability of one mirror of a provider.
+type MirrorResult struct {
+	URL     string        `json:"url"`
+	Status  int           `json:"status"`
+	Latency time.Duration `json:"latency"`
+	Err     string        `json:"error,omitempty"`
+}
+
+// Reachable reports whether the mirror answered at all (even an error page means the site is up).
+func (mirror MirrorResult) Reachable() bool {
+	return mirror.Err == "" && mirror.Status != 0
+}
+
+// Result is the outcome of checking a single provider.
+type Result struct {
+	Provider  string         `json:"provider"`
+	Checked   time.Time      `json:"checked"`
+	Mirrors   []MirrorResult `json:"mirrors"`
+	Query     string         `json:"query"`
+	Rows      int            `json:"rows"`       // results returned by the canary query
+	ValidRows int            `json:"valid_rows"` // sampled results with a title, a magnet and a size
+	Sampled   int            `json:"sampled"`    // results sampled for validation
+	Duration  time.Duration  `json:"duration"`   // time taken by the canary query
+	Err       string         `json:"error,omitempty"`
+}
+
+// OK reports whether the provider is healthy: the main site is reachable and the canary parsed fine.
+func (result Result) OK() bool {
+	return result.Err == "" && result.Sampled > 0 && result.ValidRows == result.Sampled
+}
+
+// Check runs every health check on the given provider.
+func Check(provider models.ProviderInterface) Result {
+	result := Result{Provider: provider.GetName(), Checked: time.Now()}
+	for _, mirror := range provider.GetMirrors() {
+		result.Mirrors = append(result.Mirrors, checkMirror(mirror))
+	}
+
+	canary, ok := Canaries[provider.GetName()]
+	if !ok {
+		canary = DefaultCanary
+	}
+	result.Query = canary.Query
+	caturl, err := torgo.LookupCategoryURL(canary.Category, provider.GetCategories())
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	sources, err := provider.Search(canary.Query, canaryCount, caturl)
+	result.Duration = time.Since(start)
+	result.Rows = len(sources)
+	if err != nil {
+		result.Err = err.Error()
+	}
+	if len(sources) == 0 {
+		if result.Err == "" {
+			result.Err = "canary query returned no rows"
+		}
+		return result
+	}
+
+	// Only a few rows are validated, resolving every magnet would hammer lazy providers
+	if len(sources) > canarySamples {
+		sources = sources[:canarySamples]
+	}
+	models.ResolveMagnets(sources, 0)
+	result.Sampled = len(sources)
+	for _, source := range sources {
+		if strings.TrimSpace(source.Title) != "" && source.Magnet != "" && source.FileSize > 0 {
+			result.ValidRows++
+		}
+	}
+	if result.Err == "" && result.ValidRows < result.Sampled {
+		result.Err = fmt.Sprintf("%d/%d rows are missing a title, magnet or size", result.Sampled-result.ValidRows, result.Sampled)
+	}
+	return result
+}
+
+// CheckAll checks all the given providers concurrently and returns the results in the same order.
+func CheckAll(providers []models.ProviderInterface) []Result {
+	results := make([]Result, len(providers))
+	wg := sync.WaitGroup{}
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider models.ProviderInterface) {
+			defer wg.Done()
+			logrus.Infof("%v: running health checks...", provider.GetName())
+			results[i] = Check(provider)
+		}(i, provider)
+	}
+	wg.Wait()
+	return results
+}
+
+func checkMirror(mirror string) MirrorResult {
+	result := MirrorResult{URL: mirror}
+	client := &http.Client{Timeout: mirrorTimeout}
+	start := time.Now()
+	_, res, _, err := request.Request(client, "GET", mirror, http.Header{})
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	_ = res.Body.Close()
+	result.Status = res.StatusCode
+	return result
+}
+
+// Store keeps the latest health checks of every provider on disk.
+type Store struct {
+	path    string
+	Results map[string][]Result `json:"results"` // provider name -> checks, oldest first
+}
+
+// Load reads the health store from the torgo config directory.
+// A missing store is not an error, an empty one is returned instead.
+func Load() (*Store, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{path: filepath.Join(dir, fileName), Results: map[string][]Result{}}
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, err
+	}
+	if store.Results == nil {
+		store.Results = map[string][]Result{}
+	}
+	return store, nil
+}
+
+// Save writes the health store back to disk.
+func (store *Store) Save() error {
+	data, err := json.MarshalIndent(store, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(store.path, data, 0644)
+}
+
+// Latest returns the most recent check of the provider.
+func (store *Store) Latest(name string) (Result, bool) {
+	results := store.Results[name]
+	if len(results) == 0 {
+		return Result{}, false
+	}
+	return results[len(results)-1], true
+}
+
+// Regressed reports whether the result is a failure while the previous check of the provider was fine
+// (or there was no previous check at all). It must be called before `Record`.
+func (store *Store) Regressed(result Result) bool {
+	if result.OK() {
+		return false
+	}
+	previous, ok := store.Latest(result.Provider)
+	return !ok || previous.OK()
+}
+
+// Record appends the results to the history of their providers.
+func (store *Store) Record(results ...Result) {
+	for _, result := range results {
+		history := append(store.Results[result.Provider], result)
+		if len(history) > historyLength {
+			history = history[len(history)-historyLength:]
+		}
+		store.Results[result.Provider] = history
+	}
+}
+
+// Broken reports whether the latest check of the provider failed recently.
+func (store *Store) Broken(name string) bool {
+	latest, ok := store.Latest(name)
+	return ok && !latest.OK() && time.Since(latest.Checked) < brokenFor
+}
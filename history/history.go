@@ -0,0 +1,287 @@
+/*
+Package history keeps track of what was streamed: the torrent (full magnet and info hash), where it was found,
+the file that was played, with which player, when, and how much of it was watched.
+*/
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stl3/torgo/config"
+)
+
+const (
+	fileName     = "history.json"
+	lockTimeout  = 10 * time.Second // waiting for the other torgo processes to save
+	staleLock    = time.Minute      // lock left by a torgo which crashed
+	maxEntries   = 1000             // oldest entries are dropped past this
+	maxPositions = 500              // oldest positions are dropped past this
+	// WatchedPercent is how far a file must have been played to be considered watched, its position is forgotten then.
+	WatchedPercent = 95
+)
+
+// Entry is a single stream of a torrent file.
+type Entry struct {
+	ID           int       `json:"id"`
+	InfoHash     string    `json:"info_hash"`
+	Magnet       string    `json:"magnet"`
+	Title        string    `json:"title"`    // title of the search result, or the torrent name
+	Provider     string    `json:"provider"` // provider the result came from
+	URL          string    `json:"url,omitempty"`
+	File         string    `json:"file"` // path of the file played, inside the torrent
+	FileSize     int64     `json:"file_size"`
+	Player       string    `json:"player"` // "none" when only the server was run
+	Started      time.Time `json:"started"`
+	Ended        time.Time `json:"ended"`         // zero while the stream is running (or if torgo was killed)
+	BytesWatched int64     `json:"bytes_watched"` // bytes of the file served to the player
+}
+
+// Duration returns how long the stream lasted, 0 if it never ended properly.
+func (entry Entry) Duration() time.Duration {
+	if entry.Ended.IsZero() {
+		return 0
+	}
+	return entry.Ended.Sub(entry.Started)
+}
+
+// Matches reports whether every word of the query is in the title, file, provider or info hash of the entry.
+func (entry Entry) Matches(query string) bool {
+	text := strings.ToLower(strings.Join([]string{entry.Title, entry.File, entry.Provider, entry.InfoHash}, " "))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Position is where the playback of a file of a torrent stopped.
+type Position struct {
+	InfoHash string    `json:"info_hash"`
+	File     string    `json:"file"`
+	Offset   int64     `json:"offset"`  // byte offset in the file
+	Seconds  float64   `json:"seconds"` // playback time, 0 if the player did not report it
+	Percent  float64   `json:"percent"` // of the file
+	Updated  time.Time `json:"updated"`
+}
+
+func positionKey(infoHash, file string) string {
+	return strings.ToLower(infoHash) + "/" + file
+}
+
+// Store is the watch history saved on disk.
+type Store struct {
+	path      string
+	NextID    int                 `json:"next_id"`
+	Entries   []Entry             `json:"entries"`   // oldest first
+	Positions map[string]Position `json:"positions"` // info hash/file -> where the playback stopped
+}
+
+// Load reads the history from the torgo config directory.
+// A missing history is not an error, an empty one is returned instead.
+func Load() (*Store, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{path: filepath.Join(dir, fileName), NextID: 1}
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Position returns where the playback of the file of the torrent stopped last time.
+func (store *Store) Position(infoHash, file string) (Position, bool) {
+	position, ok := store.Positions[positionKey(infoHash, file)]
+	return position, ok
+}
+
+// SetPosition saves where the playback of a file stopped.
+// The position is forgotten instead if the file was watched to the end (see `WatchedPercent`) or barely started.
+func (store *Store) SetPosition(position Position) {
+	key := positionKey(position.InfoHash, position.File)
+	if position.Percent >= WatchedPercent || (position.Offset <= 0 && position.Seconds <= 0) {
+		delete(store.Positions, key)
+		return
+	}
+	if store.Positions == nil {
+		store.Positions = map[string]Position{}
+	}
+	position.Updated = time.Now()
+	store.Positions[key] = position
+
+	// Drop the oldest positions
+	for len(store.Positions) > maxPositions {
+		oldest := ""
+		for key, position := range store.Positions {
+			if oldest == "" || position.Updated.Before(store.Positions[oldest].Updated) {
+				oldest = key
+			}
+		}
+		delete(store.Positions, oldest)
+	}
+}
+
+// Save writes the history back to disk, replacing the file at once so that it is never left half written.
+// The changes of other torgo processes since the history was loaded are lost, see `Change`.
+func (store *Store) Save() error {
+	data, err := json.MarshalIndent(store, "", "\t")
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(store.path), fileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), store.path)
+	}
+	if err != nil {
+		_ = os.Remove(temp.Name())
+	}
+	return err
+}
+
+// lock takes the lock of the history file shared by the torgo processes, and returns its release.
+// A lock older than `staleLock` is taken over.
+func lock(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleLock {
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the watch history is locked by another torgo (%s)", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Change applies {change} to the history on disk and saves it, under a lock:
+// the history is read again first, so that concurrent torgo instances do not overwrite each other.
+func Change(change func(store *Store)) error {
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+	unlock, err := lock(filepath.Join(dir, fileName))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	store, err := Load()
+	if err != nil {
+		return err
+	}
+	change(store)
+	return store.Save()
+}
+
+// Add appends the entry to the history and returns it with its ID set.
+func (store *Store) Add(entry Entry) Entry {
+	if store.NextID < 1 {
+		store.NextID = 1
+	}
+	entry.ID = store.NextID
+	store.NextID++
+	store.Entries = append(store.Entries, entry)
+	if len(store.Entries) > maxEntries {
+		store.Entries = store.Entries[len(store.Entries)-maxEntries:]
+	}
+	return entry
+}
+
+// Get returns the entry with the given ID.
+func (store *Store) Get(id int) (*Entry, bool) {
+	for i := range store.Entries {
+		if store.Entries[i].ID == id {
+			return &store.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// Delete removes the entries with the given IDs and returns how many were removed.
+func (store *Store) Delete(ids ...int) int {
+	removed := 0
+	entries := store.Entries[:0]
+	for _, entry := range store.Entries {
+		deleted := false
+		for _, id := range ids {
+			if entry.ID == id {
+				deleted = true
+				break
+			}
+		}
+		if deleted {
+			removed++
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+	store.Entries = entries
+	return removed
+}
+
+// Search returns the entries matching the query, most recent first.
+func (store *Store) Search(query string) []Entry {
+	var entries []Entry
+	for i := len(store.Entries) - 1; i >= 0; i-- {
+		if store.Entries[i].Matches(query) {
+			entries = append(entries, store.Entries[i])
+		}
+	}
+	return entries
+}
+
+// Record adds the entry to the history on disk and returns it with its ID set, see `Change`.
+func Record(entry Entry) (Entry, error) {
+	err := Change(func(store *Store) {
+		entry = store.Add(entry)
+	})
+	return entry, err
+}
+
+// RecordPosition saves where the playback of a file stopped in the history on disk, see `Store.SetPosition`.
+func RecordPosition(position Position) error {
+	return Change(func(store *Store) {
+		store.SetPosition(position)
+	})
+}
+
+// Update applies {update} to the entry with the given ID in the history on disk, see `Change`.
+// It is not an error if the entry was deleted meanwhile.
+func Update(id int, update func(entry *Entry)) error {
+	return Change(func(store *Store) {
+		if entry, ok := store.Get(id); ok {
+			update(entry)
+		}
+	})
+}
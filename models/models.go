@@ -7,9 +7,12 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -20,9 +23,10 @@ import (
 type ProviderInterface interface {
 	String() string
 	Search(string, int, CategoryURL) ([]Source, error) // search for torrents with a given (query, count, categoryURL) -> returns a slice of sources found
-	Query(string, CategoryURL, int, int, int, func(string, int, *[]Source, *sync.WaitGroup)) ([]Source, error)
+	Query(string, CategoryURL, int, int, int, Extractor) ([]Source, error)
 	GetName() string
 	GetSite() string
+	GetMirrors() []string
 	GetCategories() Categories
 }
 
@@ -30,6 +34,7 @@ type ProviderInterface interface {
 type Provider struct {
 	Name       string
 	Site       string
+	Mirrors    []string // alternative domains of Site, only used for health checks
 	Categories Categories
 }
 
@@ -52,13 +57,46 @@ func (provider *Provider) GetSite() string {
 	return provider.Site
 }
 
+// GetMirrors returns the URL of this provider followed by its known mirrors.
+func (provider *Provider) GetMirrors() []string {
+	return append([]string{provider.Site}, provider.Mirrors...)
+}
+
 // GetCategories returns the categories of this provider.
 func (provider *Provider) GetCategories() Categories {
 	return provider.Categories
 }
 
+// Extractor scrapes a single page of search results at the given URL and returns the sources found on it.
+// It is called concurrently for every page, so it must not share mutable state without locking.
+type Extractor func(surl string, page int) ([]Source, error)
+
+// PageTimeout is how long `Query` waits for each page to be extracted before giving up on it,
+// counted for every page from the call of its extractor.
+var PageTimeout = 45 * time.Second
+
+// ErrPageTimeout is reported for a page whose extractor did not return within `PageTimeout`.
+var ErrPageTimeout = errors.New("timed out")
+
+// PageError reports the failure of extracting one page of search results.
+type PageError struct {
+	Provider string
+	Page     int
+	Err      error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("%v: [%d] %v", e.Provider, e.Page, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
 // Query is a universal base function for querying webpages asynchronusly.
-func (provider *Provider) Query(query string, categoryURL CategoryURL, count int, perPage int, start int, extractor func(string, int, *[]Source, *sync.WaitGroup)) ([]Source, error) {
+// Results are kept in page order. Pages that fail or time out are skipped and reported
+// as `*PageError`s joined into the returned error, along with the results of the other pages.
+func (provider *Provider) Query(query string, categoryURL CategoryURL, count int, perPage int, start int, extractor Extractor) ([]Source, error) {
 	var results []Source
 	if count <= 0 {
 		return results, nil
@@ -71,22 +109,60 @@ func (provider *Provider) Query(query string, categoryURL CategoryURL, count int
 	logrus.Infof("%v: Getting search results in parallel...\n", provider.Name)
 	pages := utils.ComputePageCount(count, perPage)
 	logrus.Debugf("%v: pages=%d\n", provider.Name, pages)
+	if pages < start {
+		return results, nil
+	}
 
 	// asynchronize
-	wg := sync.WaitGroup{}
+	type pageResult struct {
+		page    int
+		sources []Source
+		err     error
+	}
+	done := make(chan pageResult, pages-start+1)
 	for page := start; page <= pages; page++ {
 		surl := fmt.Sprintf(string(categoryURL), query, page)
-		wg.Add(1)
-		go extractor(provider.Site+surl, page, &results, &wg)
+		go func(surl string, page int) {
+			// Every page has its own timeout: a slow page does not eat into the time of the others
+			extracted := make(chan pageResult, 1) // buffered so a late extractor never blocks
+			go func() {
+				sources, err := extractor(surl, page)
+				extracted <- pageResult{page: page, sources: sources, err: err}
+			}()
+			timeout := time.NewTimer(PageTimeout)
+			defer timeout.Stop()
+			select {
+			case r := <-extracted:
+				done <- r
+			case <-timeout.C:
+				done <- pageResult{page: page, err: ErrPageTimeout}
+			}
+		}(provider.Site+surl, page)
 	}
-	wg.Wait()
+
+	// Collect every page, in page order
+	pageSources := make([][]Source, pages-start+1)
+	var errs []error
+	for remaining := pages - start + 1; remaining > 0; remaining-- {
+		r := <-done
+		if r.err != nil {
+			errs = append(errs, &PageError{Provider: provider.Name, Page: r.page, Err: r.err})
+		}
+		pageSources[r.page-start] = r.sources
+	}
+	for _, sources := range pageSources {
+		results = append(results, sources...)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].(*PageError).Page < errs[j].(*PageError).Page
+	})
 
 	// Ending up
 	logrus.Infof("%v: Found %d results\n", provider.Name, len(results))
 	if len(results) < count {
 		count = len(results)
 	}
-	return results[:count], nil
+	return results[:count], errors.Join(errs...)
 }
 
 // Category is a custom type which represents a URL of a Category.
@@ -103,17 +179,75 @@ type Categories struct {
 	Documentaries CategoryURL
 }
 
+// MagnetResolver fetches the magnet uri of a source whose listing page does not expose one.
+type MagnetResolver func(source Source) (string, error)
+
+// MagnetResolveConcurrency is the maximum number of resolvers run at once by `ResolveMagnets`.
+var MagnetResolveConcurrency = 4
+
+// File is a file of a torrent, as listed by a provider.
+type File struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
 // Source provides informational fields for a torrent source.
 type Source struct {
-	From     string
-	Title    string
-	URL      string
-	Seeders  int
-	Leechers int
-	FileSize int64
-	Magnet   string
+	From     string `json:"from"`
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Seeders  int    `json:"seeders"`
+	Leechers int    `json:"leechers"`
+	FileSize int64  `json:"size"`
+	Magnet   string `json:"magnet"`
+	// Files is only filled by the providers whose search pages list the files of a torrent.
+	Files []File `json:"files,omitempty"`
+	// Resolver is set by providers that need an extra request (usually the detail page) to get the magnet.
+	// It is only called when the magnet is actually needed, see `Source.ResolveMagnet`.
+	Resolver MagnetResolver `json:"-"`
 }
 
 func (source Source) String() string {
 	return fmt.Sprintf("<Source(title=%v)>", source.Title)
 }
+
+// ResolveMagnet fills in the magnet uri of this source by calling its resolver, if the magnet is still unknown.
+func (source *Source) ResolveMagnet() error {
+	if source.Magnet != "" || source.Resolver == nil {
+		return nil
+	}
+	magnet, err := source.Resolver(*source)
+	if err != nil {
+		return fmt.Errorf("%v: resolving magnet of %q: %w", source.From, source.Title, err)
+	}
+	if magnet == "" {
+		return fmt.Errorf("%v: no magnet found for %q", source.From, source.Title)
+	}
+	source.Magnet = magnet
+	return nil
+}
+
+// ResolveMagnets resolves the magnets of the first {limit} sources (all of them if limit <= 0) in place.
+// At most `MagnetResolveConcurrency` resolvers run at the same time; failures are logged and skipped.
+func ResolveMagnets(sources []Source, limit int) {
+	if limit <= 0 || limit > len(sources) {
+		limit = len(sources)
+	}
+	sem := make(chan struct{}, MagnetResolveConcurrency)
+	wg := sync.WaitGroup{}
+	for i := 0; i < limit; i++ {
+		if sources[i].Magnet != "" || sources[i].Resolver == nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(source *Source) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := source.ResolveMagnet(); err != nil {
+				logrus.Errorln(err)
+			}
+		}(&sources[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,163 @@
+package player
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// versionTimeout is how long a player has to print its version.
+const versionTimeout = 3 * time.Second
+
+// knownLocations are where the built-in players are usually installed besides the PATH, by player and by OS.
+// The ${variables} are expanded, a location with an unset variable is skipped.
+var knownLocations = map[string]map[string][]string{
+	"mpv": {
+		"windows": {
+			`${ProgramFiles}\mpv\mpv.exe`,
+			`${LOCALAPPDATA}\Programs\mpv\mpv.exe`,
+			`${USERPROFILE}\scoop\apps\mpv\current\mpv.exe`,
+			`${ProgramData}\chocolatey\bin\mpv.exe`,
+		},
+		"darwin": {"/Applications/mpv.app/Contents/MacOS/mpv", "/opt/homebrew/bin/mpv", "/usr/local/bin/mpv"},
+		"linux":  {"/usr/local/bin/mpv", "/snap/bin/mpv", "/var/lib/flatpak/exports/bin/io.mpv.Mpv"},
+	},
+	"vlc": {
+		"windows": {`${ProgramFiles}\VideoLAN\VLC\vlc.exe`, `${ProgramFiles(x86)}\VideoLAN\VLC\vlc.exe`},
+		"darwin":  {"/opt/homebrew/bin/vlc", "/usr/local/bin/vlc"},
+		"linux":   {"/snap/bin/vlc", "/var/lib/flatpak/exports/bin/org.videolan.VLC"},
+	},
+	"KMPlayer": {
+		"windows": {
+			`${ProgramFiles}\KMPlayer 64X\KMPlayer64.exe`,
+			`${ProgramFiles}\KMPlayer\KMPlayer.exe`,
+			`${ProgramFiles(x86)}\KMPlayer\KMPlayer.exe`,
+		},
+	},
+}
+
+// versionOptions are the options printing the version of the built-in players, by player.
+// VLC opens a window instead on Windows.
+var versionOptions = map[string]string{
+	"mpv": "--version",
+	"vlc": "--version",
+}
+
+// mpvIPCVersion is the first version of mpv with --input-ipc-server.
+var mpvIPCVersion = []int{0, 17}
+
+var detectOnce sync.Once
+
+// Detect looks for the players on this machine, once: in the PATH, then in their usual install locations.
+// The players found run from the path found, and know their version when they tell it.
+func Detect() {
+	detectOnce.Do(func() {
+		var wg sync.WaitGroup
+		for i := range Players {
+			wg.Add(1)
+			go func(player *Player) {
+				defer wg.Done()
+				player.detect()
+			}(&Players[i])
+		}
+		wg.Wait()
+	})
+}
+
+// Available returns the players installed on this machine, see `Detect`.
+func Available() []Player {
+	Detect()
+	var available []Player
+	for _, player := range Players {
+		if player.Installed {
+			available = append(available, player)
+		}
+	}
+	return available
+}
+
+// detect looks for the command of the player on this OS, and asks its version.
+func (player *Player) detect() {
+	command := player.command()
+	if len(command) == 0 {
+		return
+	}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		path = ""
+		for _, location := range knownLocations[player.Name][runtime.GOOS] {
+			if location, ok := expandLocation(location); ok && isFile(location) {
+				path = location
+				break
+			}
+		}
+	}
+	if path == "" {
+		logrus.Debugf("%s not found: %v", player.Name, err)
+		return
+	}
+	player.Installed = true
+	player.Path = path
+	if option, ok := versionOptions[player.Name]; ok && !player.Template && !(player.Name == "vlc" && runtime.GOOS == "windows") {
+		player.Version = version(path, option)
+	}
+	logrus.Debugf("%s found: %s %s", player.Name, path, player.Version)
+}
+
+// expandLocation expands the ${variables} of a location, and reports whether they are all set.
+func expandLocation(location string) (string, bool) {
+	ok := true
+	expanded := os.Expand(location, func(name string) string {
+		value := os.Getenv(name)
+		ok = ok && value != ""
+		return value
+	})
+	return expanded, ok
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+var versionPattern = regexp.MustCompile(`\d+\.\d+(\.\d+)*`)
+
+// version returns the version the command at {path} prints with {option}, "" when it does not.
+func version(path, option string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, option).Output()
+	if err != nil && len(out) == 0 {
+		logrus.Debugln(path, option, err)
+		return ""
+	}
+	line, _, _ := bytes.Cut(out, []byte("\n"))
+	return string(versionPattern.Find(line))
+}
+
+// atLeast reports whether the version {v} is {minimum} or later, or unknown.
+func atLeast(v string, minimum []int) bool {
+	if v == "" {
+		return true
+	}
+	parts := strings.Split(v, ".")
+	for i, want := range minimum {
+		got := 0
+		if i < len(parts) {
+			got, _ = strconv.Atoi(parts[i])
+		}
+		if got != want {
+			return got > want
+		}
+	}
+	return true
+}
@@ -0,0 +1,277 @@
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrIPCClosed is returned by the commands sent once the connection to mpv is closed (usually because mpv exited).
+var ErrIPCClosed = errors.New("mpv IPC closed")
+
+// MpvEvent is an event sent by mpv: a property change (see `MpvIPC.Observe`), `seek`, `end-file`...
+type MpvEvent struct {
+	Event  string          `json:"event"`
+	ID     int             `json:"id"`   // property-change: ID given to Observe
+	Name   string          `json:"name"` // property-change: name of the property
+	Data   json.RawMessage `json:"data"` // property-change: new value of the property
+	Reason string          `json:"reason"`
+}
+
+type mpvResponse struct {
+	RequestID int             `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// MpvIPC is a connection to the JSON IPC of a running mpv, see https://mpv.io/manual/stable/#json-ipc.
+type MpvIPC struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan mpvResponse
+	events  chan MpvEvent
+	closed  chan struct{}
+	once    sync.Once
+	// Events read and not handed to `Events` yet, see `push`
+	queueMu sync.Mutex
+	queue   []MpvEvent
+	queued  chan struct{} // signals a change of the queue
+	ended   bool          // no more event is queued
+}
+
+// DialMpv connects to the IPC server of mpv at {address} (as given to `--input-ipc-server`).
+// mpv creates the server shortly after starting, so the connection is retried until {timeout}.
+func DialMpv(address string, timeout time.Duration) (*MpvIPC, error) {
+	return dialMpv(address, timeout, nil)
+}
+
+// dialMpv is `DialMpv`, giving up early when {stop} is closed (mpv exited).
+func dialMpv(address string, timeout time.Duration, stop <-chan struct{}) (*MpvIPC, error) {
+	deadline := time.After(timeout)
+	for {
+		conn, err := dialIPC(address)
+		if err == nil {
+			return NewMpvIPC(conn), nil
+		}
+		select {
+		case <-stop:
+			return nil, fmt.Errorf("connecting to mpv: %w", err)
+		case <-deadline:
+			return nil, fmt.Errorf("connecting to mpv: %w", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// NewMpvIPC speaks the mpv JSON IPC protocol over an established connection.
+func NewMpvIPC(conn net.Conn) *MpvIPC {
+	ipc := &MpvIPC{
+		conn:    conn,
+		pending: map[int]chan mpvResponse{},
+		events:  make(chan MpvEvent, 64),
+		closed:  make(chan struct{}),
+		queued:  make(chan struct{}, 1),
+	}
+	go ipc.read()
+	go ipc.dispatch()
+	return ipc
+}
+
+// read dispatches the lines sent by mpv: responses to their command, everything else to the events.
+func (ipc *MpvIPC) read() {
+	defer ipc.Close()
+	defer ipc.endEvents()
+	scanner := bufio.NewScanner(ipc.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var event MpvEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			logrus.Debugf("mpv IPC: invalid message %q: %v", line, err)
+			continue
+		}
+		if event.Event != "" {
+			ipc.push(event)
+			continue
+		}
+		var message mpvResponse
+		if err := json.Unmarshal(line, &message); err != nil {
+			logrus.Debugf("mpv IPC: invalid response %q: %v", line, err)
+			continue
+		}
+		ipc.mu.Lock()
+		response, ok := ipc.pending[message.RequestID]
+		delete(ipc.pending, message.RequestID)
+		ipc.mu.Unlock()
+		if ok {
+			response <- message
+		}
+	}
+}
+
+// push queues an event for `Events`, without blocking the responses when the events are not read.
+// No event is dropped, except a property change followed by another change of the same property:
+// only the last value is kept.
+func (ipc *MpvIPC) push(event MpvEvent) {
+	ipc.queueMu.Lock()
+	if event.Event == "property-change" {
+		for i, queued := range ipc.queue {
+			if queued.Event == "property-change" && queued.ID == event.ID {
+				ipc.queue = append(ipc.queue[:i], ipc.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	ipc.queue = append(ipc.queue, event)
+	ipc.queueMu.Unlock()
+	ipc.signal()
+}
+
+// endEvents tells `dispatch` to close the events once the queue is empty.
+func (ipc *MpvIPC) endEvents() {
+	ipc.queueMu.Lock()
+	ipc.ended = true
+	ipc.queueMu.Unlock()
+	ipc.signal()
+}
+
+func (ipc *MpvIPC) signal() {
+	select {
+	case ipc.queued <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands the queued events to `Events` in order, and closes it after the last one.
+func (ipc *MpvIPC) dispatch() {
+	defer close(ipc.events)
+	for {
+		ipc.queueMu.Lock()
+		if len(ipc.queue) == 0 {
+			ended := ipc.ended
+			ipc.queueMu.Unlock()
+			if ended {
+				return
+			}
+			<-ipc.queued
+			continue
+		}
+		event := ipc.queue[0]
+		ipc.queue = ipc.queue[1:]
+		ipc.queueMu.Unlock()
+		ipc.events <- event
+	}
+}
+
+// Events returns the events sent by mpv, in order (see `push`). The channel is closed after the last event
+// once the connection is closed.
+func (ipc *MpvIPC) Events() <-chan MpvEvent {
+	return ipc.events
+}
+
+// Done is closed once the connection to mpv is closed.
+func (ipc *MpvIPC) Done() <-chan struct{} {
+	return ipc.closed
+}
+
+// Command sends a command (e.g. "loadfile", url) to mpv and returns the data of its response.
+func (ipc *MpvIPC) Command(args ...interface{}) (json.RawMessage, error) {
+	ipc.mu.Lock()
+	ipc.nextID++
+	id := ipc.nextID
+	response := make(chan mpvResponse, 1)
+	ipc.pending[id] = response
+	ipc.mu.Unlock()
+
+	line, err := json.Marshal(map[string]interface{}{"command": args, "request_id": id})
+	if err != nil {
+		return nil, err
+	}
+	ipc.mu.Lock()
+	_, err = ipc.conn.Write(append(line, '\n'))
+	ipc.mu.Unlock()
+	if err != nil {
+		ipc.forget(id)
+		return nil, ErrIPCClosed
+	}
+
+	select {
+	case r := <-response:
+		if r.Error != "success" {
+			return nil, fmt.Errorf("mpv: %v: %s", args[0], r.Error)
+		}
+		return r.Data, nil
+	case <-ipc.closed:
+		ipc.forget(id)
+		return nil, ErrIPCClosed
+	case <-time.After(5 * time.Second):
+		ipc.forget(id)
+		return nil, fmt.Errorf("mpv: %v: no response", args[0])
+	}
+}
+
+func (ipc *MpvIPC) forget(id int) {
+	ipc.mu.Lock()
+	delete(ipc.pending, id)
+	ipc.mu.Unlock()
+}
+
+// Get reads a property of mpv into {value}.
+func (ipc *MpvIPC) Get(property string, value interface{}) error {
+	data, err := ipc.Command("get_property", property)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Set changes a property of mpv.
+func (ipc *MpvIPC) Set(property string, value interface{}) error {
+	_, err := ipc.Command("set_property", property, value)
+	return err
+}
+
+// Observe asks mpv to send a `property-change` event with the given ID whenever the property changes.
+func (ipc *MpvIPC) Observe(id int, property string) error {
+	_, err := ipc.Command("observe_property", id, property)
+	return err
+}
+
+// ShowText shows a message on the OSD of mpv for {duration}.
+func (ipc *MpvIPC) ShowText(text string, duration time.Duration) error {
+	_, err := ipc.Command("show-text", text, duration.Milliseconds())
+	return err
+}
+
+// LoadFile appends a file to the playlist of mpv, played right away when mpv is idle (e.g. at the end of a file).
+func (ipc *MpvIPC) LoadFile(url string) error {
+	_, err := ipc.Command("loadfile", url, "append-play")
+	return err
+}
+
+// Quit makes mpv exit.
+func (ipc *MpvIPC) Quit() error {
+	_, err := ipc.Command("quit")
+	if errors.Is(err, ErrIPCClosed) || errors.Is(err, io.EOF) {
+		return nil // mpv exited before answering
+	}
+	return err
+}
+
+// Close closes the connection to mpv.
+func (ipc *MpvIPC) Close() error {
+	var err error
+	ipc.once.Do(func() {
+		close(ipc.closed)
+		err = ipc.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package player
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ipcAddress returns where mpv creates its IPC server, "" if it is not supported on this OS.
+func ipcAddress() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("torgo-mpv-%d.sock", os.Getpid()))
+}
+
+func dialIPC(address string) (net.Conn, error) {
+	return net.Dial("unix", address)
+}
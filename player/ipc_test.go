@@ -0,0 +1,242 @@
+//go:build !windows
+
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeMpv is a JSON IPC server answering the commands like mpv.
+type fakeMpv struct {
+	listener net.Listener
+	conn     chan net.Conn
+	commands chan []interface{}
+	// answer returns the error and the data of the response to a command, "success" and nil when not set
+	answer func(command []interface{}) (string, interface{})
+}
+
+func newFakeMpv(t *testing.T) (*fakeMpv, string) {
+	t.Helper()
+	address := filepath.Join(t.TempDir(), "mpv.sock")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeMpv{listener: listener, conn: make(chan net.Conn, 1), commands: make(chan []interface{}, 16)}
+	t.Cleanup(func() { _ = listener.Close() })
+	go fake.serve()
+	return fake, address
+}
+
+func (fake *fakeMpv) serve() {
+	conn, err := fake.listener.Accept()
+	if err != nil {
+		return
+	}
+	fake.conn <- conn
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var request struct {
+			Command   []interface{} `json:"command"`
+			RequestID int           `json:"request_id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			continue
+		}
+		fake.commands <- request.Command
+		status, data := "success", interface{}(nil)
+		if fake.answer != nil {
+			status, data = fake.answer(request.Command)
+		}
+		response, _ := json.Marshal(map[string]interface{}{"request_id": request.RequestID, "error": status, "data": data})
+		_, _ = conn.Write(append(response, '\n'))
+	}
+}
+
+// send writes a line to torgo, e.g. an event.
+func (fake *fakeMpv) send(t *testing.T, conn net.Conn, line string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (fake *fakeMpv) command(t *testing.T) []interface{} {
+	t.Helper()
+	select {
+	case command := <-fake.commands:
+		return command
+	case <-time.After(2 * time.Second):
+		t.Fatal("no command received")
+		return nil
+	}
+}
+
+func dialFake(t *testing.T, address string) *MpvIPC {
+	t.Helper()
+	ipc, err := DialMpv(address, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ipc.Close() })
+	return ipc
+}
+
+func TestMpvIPCEvents(t *testing.T) {
+	fake, address := newFakeMpv(t)
+	ipc := dialFake(t, address)
+	conn := <-fake.conn
+
+	fake.send(t, conn, `{"event":"property-change","id":1,"name":"time-pos","data":42.5}`)
+	fake.send(t, conn, `{"event":"property-change","id":2,"name":"pause","data":true}`)
+	fake.send(t, conn, `{"event":"seek"}`)
+	fake.send(t, conn, `{"event":"end-file","reason":"eof"}`)
+
+	var events []MpvEvent
+	for len(events) < 4 {
+		select {
+		case event := <-ipc.Events():
+			events = append(events, event)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("got %d events, want 4", len(events))
+		}
+	}
+	var position float64
+	if err := json.Unmarshal(events[0].Data, &position); err != nil || events[0].Name != "time-pos" || position != 42.5 {
+		t.Errorf("position event = %+v, want time-pos 42.5", events[0])
+	}
+	var paused bool
+	if err := json.Unmarshal(events[1].Data, &paused); err != nil || events[1].Name != "pause" || !paused {
+		t.Errorf("pause event = %+v, want pause true", events[1])
+	}
+	if events[2].Event != "seek" {
+		t.Errorf("event = %q, want seek", events[2].Event)
+	}
+	if events[3].Event != "end-file" || events[3].Reason != "eof" {
+		t.Errorf("event = %+v, want end-file eof", events[3])
+	}
+
+	// The events channel is closed with the connection
+	_ = conn.Close()
+	select {
+	case <-ipc.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("IPC not closed after mpv closed the connection")
+	}
+}
+
+func TestMpvIPCEventsNotDropped(t *testing.T) {
+	fake, address := newFakeMpv(t)
+	fake.answer = func(command []interface{}) (string, interface{}) {
+		return "success", 1.0
+	}
+	ipc := dialFake(t, address)
+	conn := <-fake.conn
+
+	// Far more events than buffered, while nothing reads them
+	for i := 1; i <= 500; i++ {
+		fake.send(t, conn, fmt.Sprintf(`{"event":"property-change","id":1,"name":"time-pos","data":%d}`, i))
+	}
+	fake.send(t, conn, `{"event":"end-file","reason":"eof"}`)
+	fake.send(t, conn, `{"event":"property-change","id":2,"name":"pause","data":true}`)
+	fake.send(t, conn, `{"event":"shutdown"}`)
+
+	// The responses still come back
+	var value float64
+	if err := ipc.Get("volume", &value); err != nil || value != 1 {
+		t.Fatalf("Get(volume) = %v, %v while the events were not read", value, err)
+	}
+	fake.command(t)
+	_ = conn.Close()
+
+	var events []MpvEvent
+	timeout := time.After(2 * time.Second)
+read:
+	for {
+		select {
+		case event, ok := <-ipc.Events():
+			if !ok {
+				break read
+			}
+			events = append(events, event)
+		case <-timeout:
+			t.Fatalf("events not closed, got %d events", len(events))
+		}
+	}
+	if len(events) > 64+4 {
+		t.Errorf("got %d events, want the property changes coalesced", len(events))
+	}
+	var names []string
+	position := 0.0
+	for _, event := range events {
+		if event.Name == "time-pos" {
+			_ = json.Unmarshal(event.Data, &position)
+			continue
+		}
+		names = append(names, event.Event+" "+event.Name)
+	}
+	if position != 500 {
+		t.Errorf("last position = %v, want 500", position)
+	}
+	if want := []string{"end-file ", "property-change pause", "shutdown "}; !reflect.DeepEqual(names, want) {
+		t.Errorf("events = %q, want %q", names, want)
+	}
+}
+
+func TestMpvIPCCommands(t *testing.T) {
+	fake, address := newFakeMpv(t)
+	fake.answer = func(command []interface{}) (string, interface{}) {
+		if command[0] == "get_property" && command[1] == "time-pos" {
+			return "success", 12.5
+		}
+		if command[0] == "get_property" {
+			return "property unavailable", nil
+		}
+		return "success", nil
+	}
+	ipc := dialFake(t, address)
+
+	tests := []struct {
+		name string
+		run  func() error
+		want []interface{}
+	}{
+		{"observe", func() error { return ipc.Observe(1, "time-pos") }, []interface{}{"observe_property", 1.0, "time-pos"}},
+		{"set", func() error { return ipc.Set("idle", "yes") }, []interface{}{"set_property", "idle", "yes"}},
+		{"show-text", func() error { return ipc.ShowText("Downloaded 42%", 1500*time.Millisecond) },
+			[]interface{}{"show-text", "Downloaded 42%", 1500.0}},
+		{"loadfile", func() error { return ipc.LoadFile("http://localhost:8080/files/1/b.mkv") },
+			[]interface{}{"loadfile", "http://localhost:8080/files/1/b.mkv", "append-play"}},
+	}
+	for _, tt := range tests {
+		if err := tt.run(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if got := fake.command(t); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mpv got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	var position float64
+	if err := ipc.Get("time-pos", &position); err != nil || position != 12.5 {
+		t.Errorf("Get(time-pos) = %v, %v, want 12.5", position, err)
+	}
+	fake.command(t)
+	if err := ipc.Get("duration", &position); err == nil {
+		t.Error("Get(duration) succeeded, want the error of mpv")
+	}
+	fake.command(t)
+
+	_ = ipc.Close()
+	if _, err := ipc.Command("quit"); !errors.Is(err, ErrIPCClosed) {
+		t.Errorf("command after Close: %v, want ErrIPCClosed", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package player
+
+import (
+	"errors"
+	"net"
+)
+
+// ipcAddress returns where mpv creates its IPC server, "" if it is not supported on this OS.
+// mpv uses a named pipe on Windows, which the standard library can not dial.
+func ipcAddress() string {
+	return ""
+}
+
+func dialIPC(address string) (net.Conn, error) {
+	return nil, errors.New("mpv IPC is not supported on windows")
+}
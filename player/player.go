@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
@@ -15,8 +16,10 @@ import (
 	"strings"
 	"time"
 
-	// "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
+
 	"github.com/stl3/torgo/config"
+	"github.com/stl3/torgo/transcode"
 )
 
 // // Get the current working directory
@@ -33,11 +36,11 @@ var u, _ = user.Current()
 var home = u.HomeDir
 var configFile = filepath.Join(home, ".torgo.json")
 
-// Declare Mpv_params as a package-level variable
-var MpvParams string
+// MpvParams are the options added to the mpv command on every OS, from `mpv_params` (separated by spaces).
+var MpvParams []string
 
-// Function to load the configuration
-func loadConfig() {
+// loadConfig loads the options of mpv, and returns the players defined in the configuration.
+func loadConfig() []config.PlayerConfig {
 	configurations, err := config.LoadConfig(configFile)
 	if err != nil {
 		fmt.Println("Error loading config:", err)
@@ -45,30 +48,25 @@ func loadConfig() {
 	}
 	// Shows used config options from json
 	// fmt.Printf("Loaded configuration: %+v\n", configurations)
-	MpvParams = configurations.Mpv_params
+	MpvParams = strings.Fields(configurations.Mpv_params)
+	return configurations.Players
 }
 
-// Players holds structs of all supported players.
+// Players holds structs of all supported players, the built-in ones and the ones of the configuration.
 var Players = func() []Player {
-	// fmt.Printf("Loaded configuration: %+v\n", configurations)
-	loadConfig()
-	// Initialize the Players slice
-	return []Player{
+	userPlayers := loadConfig()
+	mpv := append([]string{"mpv"}, MpvParams...)
+	players := []Player{
 		{
 			Name:            "mpv",
-			DarwinCommand:   []string{"mpv"},
-			LinuxCommand:    []string{"mpv"},
+			DarwinCommand:   mpv,
+			LinuxCommand:    mpv,
 			AndroidCommand:  []string{"am", "start", "--user", "0", "-a", "android.intent.action.VIEW", "-d"},
 			SubtitleCommand: "--sub-file=",
 			TitleCommand:    "--force-media-title=", // Shows the movie folder name as title instead of http://localhost:port
-			WindowsCommand: func() []string {
-				fmt.Println("mpv params loaded:", MpvParams)
-				if MpvParams != "" {
-					return []string{"mpv", MpvParams, "--no-resume-playback", "--no-terminal"}
-				}
-				fmt.Println("Mpv_params is empty")
-				return []string{"mpv", "--no-resume-playback", "--no-terminal"}
-			}(),
+			StartCommand:    "--start=",
+			StartPercent:    true,
+			WindowsCommand:  append(mpv[:len(mpv):len(mpv)], "--no-resume-playback", "--no-terminal"),
 		},
 		{
 			Name:           "vlc",
@@ -79,52 +77,92 @@ var Players = func() []Player {
 			WindowsCommand:  []string{"vlc.exe"}, // vlc player should be in users env path in case installed in non-default path
 			SubtitleCommand: "--sub-file=",
 			TitleCommand:    "--meta-title=", //
+			StartCommand:    "--start-time=",
 		},
 		{
 			Name:           "KMPlayer",
 			WindowsCommand: []string{"KMPlayer.exe"}, // Do people use this?
 		},
-		{
-			Name: "chromecast",
-			// ChromecastCommand: []string{"F:\\go\\bin\\go-chromecast.exe", "-a", "10.0.0.107", "load"},
-			WindowsCommand: []string{"go-chromecast.exe", "-a", "10.0.0.107", "load"}, // shit don't work
-		},
 	}
+	for _, userPlayer := range userPlayers {
+		players = addPlayer(players, templatePlayer(userPlayer))
+	}
+	return players
 }()
 
 // Player manages the execution of a media player.
 type Player struct {
 	Name string
 	// Type            PlayerType // New field to indicate the player type
-	DarwinCommand  []string
-	LinuxCommand   []string
-	WindowsCommand []string
-	AndroidCommand []string
-	// ChromecastCommand []string
+	DarwinCommand   []string
+	LinuxCommand    []string
+	WindowsCommand  []string
+	AndroidCommand  []string
 	SubtitleCommand string
 	TitleCommand    string
-	started         bool
+	StartCommand    string // option taking the start position, in seconds
+	StartPercent    bool   // whether StartCommand also takes a percentage (`42.5%`)
+	// Template tells the commands hold the placeholders of `config.PlayerConfig`, instead of taking the options above
+	Template bool
+	// Set by `Detect`: whether the player is installed, the path of its command and its version when it tells it
+	Installed bool
+	Path      string
+	Version   string
+	// OnIPC is called with a connection to the JSON IPC of mpv once it started, when supported.
+	// The connection is closed when mpv exits.
+	OnIPC func(ipc *MpvIPC)
+	// Launch plays the stream instead of a command when set (e.g. on a DLNA renderer), it returns once the playback ended.
+	Launch func(player *Player, url string, subtitlePath string, title string, start Position) error
+	// OnPosition is called by the players launched with Launch with the playback position, when they know it.
+	OnPosition func(position Position)
+	// Transcoder and TranscodeURL are set with the stream, for the players launched with Launch
+	// which play fewer formats: see `transcode.Transcoder.Codecs` and `client.Client.TranscodeURL`.
+	Transcoder   *transcode.Transcoder
+	TranscodeURL string
+	started      bool
+}
+
+// Position is where the playback starts. Seconds is used when known, Percent (of the file) otherwise.
+type Position struct {
+	Seconds float64
+	Percent float64
+}
+
+// startArgument returns the argument starting the playback at the position, or "" if the player can not.
+func (player *Player) startArgument(start Position) string {
+	switch {
+	case player.StartCommand == "":
+		return ""
+	case start.Seconds > 0:
+		return fmt.Sprintf("%s%.0f", player.StartCommand, start.Seconds)
+	case start.Percent > 0 && player.StartPercent:
+		return fmt.Sprintf("%s%.2f%%", player.StartCommand, start.Percent)
+	}
+	return ""
+}
+
+// CanStartAt reports whether the player can start the playback at the position.
+func (player *Player) CanStartAt(start Position) bool {
+	if player.Launch != nil {
+		// The devices seek once the playback started
+		return start.Seconds > 0 || start.Percent > 0
+	}
+	if player.Template {
+		return templateStarts(player.command(), start)
+	}
+	return player.startArgument(start) != ""
 }
 
-// Start launches the Player with the given command and arguments in subprocess.
-func (player *Player) Start(url string, subtitlePath string, title string) {
+// Start launches the Player with the given command and arguments in subprocess, playing from {start}.
+func (player *Player) Start(url string, subtitlePath string, title string, start Position) {
 	// if player.started == true {
 	if player.started {
 		// prevent multiple calls
 		return
 	}
 
-	var command []string
-	switch runtime.GOOS {
-	case "darwin":
-		command = player.DarwinCommand
-	case "linux":
-		command = player.LinuxCommand
-	case "windows":
-		command = player.WindowsCommand
-	case "android":
-		command = player.AndroidCommand
-	}
+	// A copy, the arguments of the stream are appended to it
+	command := append([]string(nil), player.command()...)
 
 	// Wait for server to be ready
 	timeout := 1250 * time.Millisecond // Adjust the timeout as needed
@@ -134,23 +172,53 @@ func (player *Player) Start(url string, subtitlePath string, title string) {
 		return
 	}
 
-	// Append the video URL to the command for non-Android cases
-	command = append(command, url)
-
-	if player.Name == "mpv" && runtime.GOOS == "android" {
-		fmt.Println("Using mpv")
-		command = append(command, "-n", "is.xyz.mpv/.MPVActivity")
+	if player.Launch != nil {
+		player.started = true
+		if err := player.Launch(player, url, subtitlePath, title, start); err != nil {
+			log.Printf("Error playing on %s: %v\n", player.Name, err)
+		}
+		player.started = false
+		return
+	}
 
-	} else if player.Name == "vlc" && runtime.GOOS == "android" {
-		fmt.Println("Using VLC")
-		command = append(command, "-n", "org.videolan.vlc/org.videolan.vlc.gui.video.VideoPlayerActivity")
+	if len(command) == 0 {
+		log.Printf("%s has no command on %s\n", player.Name, runtime.GOOS)
+		return
 	}
+	if player.Path != "" {
+		command[0] = player.Path
+	}
+	if player.Template {
+		command = expandTemplate(command, url, subtitlePath, title, start)
+	} else {
+		// Append the video URL to the command for non-Android cases
+		command = append(command, url)
+
+		if player.Name == "mpv" && runtime.GOOS == "android" {
+			fmt.Println("Using mpv")
+			command = append(command, "-n", "is.xyz.mpv/.MPVActivity")
 
-	if subtitlePath != "" && runtime.GOOS != "android" {
-		command = append(command, player.SubtitleCommand+subtitlePath)
+		} else if player.Name == "vlc" && runtime.GOOS == "android" {
+			fmt.Println("Using VLC")
+			command = append(command, "-n", "org.videolan.vlc/org.videolan.vlc.gui.video.VideoPlayerActivity")
+		}
+
+		if subtitlePath != "" && runtime.GOOS != "android" {
+			command = append(command, player.SubtitleCommand+subtitlePath)
+		}
+		if title != "" && runtime.GOOS != "android" {
+			command = append(command, player.TitleCommand+title)
+		}
+		if arg := player.startArgument(start); arg != "" && runtime.GOOS != "android" {
+			command = append(command, arg)
+		}
 	}
-	if title != "" && runtime.GOOS != "android" {
-		command = append(command, player.TitleCommand+title)
+
+	ipcServer := ""
+	if player.Name == "mpv" && player.OnIPC != nil && runtime.GOOS != "android" && atLeast(player.Version, mpvIPCVersion) {
+		if ipcServer = ipcAddress(); ipcServer != "" {
+			command = append(command, "--input-ipc-server="+ipcServer)
+		}
 	}
 
 	log.Printf("\x1b[36mLaunching player:\x1b[0m \x1b[33m%v\x1b[0m\n", command)
@@ -163,6 +231,29 @@ func (player *Player) Start(url string, subtitlePath string, title string) {
 		log.Printf("Error starting player: %v\n", err)
 		return
 	}
+	if ipcServer != "" {
+		defer os.Remove(ipcServer)
+		ipcDone := make(chan struct{})
+		exited := make(chan struct{})
+		defer func() {
+			close(exited)
+			<-ipcDone
+		}()
+		go func() {
+			defer close(ipcDone)
+			ipc, err := dialMpv(ipcServer, 10*time.Second, exited)
+			if err != nil {
+				logrus.Debugln(err)
+				return
+			}
+			go func() {
+				// Old mpv versions do not close the connection when they exit
+				<-exited
+				_ = ipc.Close()
+			}()
+			player.OnIPC(ipc)
+		}()
+	}
 	// Wait for the player process to complete
 	if err := cmd.Wait(); err != nil {
 		exitErr, ok := err.(*exec.ExitError)
@@ -178,8 +269,24 @@ func (player *Player) Start(url string, subtitlePath string, title string) {
 
 }
 
-// GetPlayer returns the Player struct of the given player name.
+// command returns the command of the player on this OS.
+func (player *Player) command() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return player.DarwinCommand
+	case "linux":
+		return player.LinuxCommand
+	case "windows":
+		return player.WindowsCommand
+	case "android":
+		return player.AndroidCommand
+	}
+	return nil
+}
+
+// GetPlayer returns the Player struct of the given player name, installed or not.
 func GetPlayer(name string) *Player {
+	Detect()
 	for _, player := range Players {
 		if strings.EqualFold(player.Name, name) {
 			return &player
@@ -193,8 +300,9 @@ func waitForServer(url string, timeout time.Duration) error {
 
 	for {
 		// Attempt to make a request to the server
-		_, err := http.Get(url)
+		resp, err := http.Get(url)
 		if err == nil {
+			_ = resp.Body.Close()
 			// Server is reachable
 			fmt.Println("Server is running!")
 			return nil
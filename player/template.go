@@ -0,0 +1,126 @@
+package player
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stl3/torgo/config"
+)
+
+// Placeholders of the command templates, see `config.PlayerConfig`
+const (
+	placeholderURL      = "{url}"
+	placeholderTitle    = "{title}"
+	placeholderSubtitle = "{subtitle}"
+	placeholderStart    = "{start}"
+	placeholderStartMs  = "{startms}"
+	placeholderPercent  = "{percent}"
+)
+
+var placeholders = []string{placeholderURL, placeholderTitle, placeholderSubtitle, placeholderStart, placeholderStartMs, placeholderPercent}
+
+// templatePlayer returns the player defined by a command template of the configuration.
+func templatePlayer(c config.PlayerConfig) Player {
+	command := func(own []string) []string {
+		if len(own) > 0 {
+			return own
+		}
+		return c.Command
+	}
+	return Player{
+		Name:           c.Name,
+		Template:       true,
+		DarwinCommand:  command(c.Darwin),
+		LinuxCommand:   command(c.Linux),
+		WindowsCommand: command(c.Windows),
+		AndroidCommand: command(c.Android),
+	}
+}
+
+// addPlayer adds {p} to the players, in place of the one of the same name.
+func addPlayer(players []Player, p Player) []Player {
+	for i := range players {
+		if strings.EqualFold(players[i].Name, p.Name) {
+			players[i] = p
+			return players
+		}
+	}
+	return append(players, p)
+}
+
+// expandTemplate returns the command template {template} with the values of its placeholders for a stream.
+// The arguments whose placeholders have no value are left out, and the URL is added last when no argument holds it.
+// An argument holding placeholders and spaces is several arguments, left out together.
+func expandTemplate(template []string, url, subtitlePath, title string, start Position) []string {
+	values := map[string]string{
+		placeholderURL:      url,
+		placeholderTitle:    title,
+		placeholderSubtitle: subtitlePath,
+	}
+	if start.Seconds > 0 {
+		values[placeholderStart] = fmt.Sprintf("%.0f", start.Seconds)
+		values[placeholderStartMs] = fmt.Sprintf("%.0f", start.Seconds*1000)
+	}
+	if start.Percent > 0 {
+		values[placeholderPercent] = fmt.Sprintf("%.2f", start.Percent)
+	}
+
+	hasURL := false
+	command := []string{template[0]}
+	for _, arg := range template[1:] {
+		hasURL = hasURL || strings.Contains(arg, placeholderURL)
+		words := []string{arg}
+		if hasPlaceholder(arg) {
+			// An option and its value, e.g. "/sub {subtitle}": both are left out without value
+			words = strings.Fields(arg)
+		}
+		var expanded []string
+		for _, word := range words {
+			if word, ok := expand(word, values); ok {
+				expanded = append(expanded, word)
+			}
+		}
+		if len(expanded) == len(words) {
+			command = append(command, expanded...)
+		}
+	}
+	if !hasURL {
+		command = append(command, url)
+	}
+	return command
+}
+
+// hasPlaceholder reports whether {arg} holds a placeholder.
+func hasPlaceholder(arg string) bool {
+	for _, placeholder := range placeholders {
+		if strings.Contains(arg, placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand replaces the placeholders of {arg} with their values, and reports whether every one of them has a value.
+func expand(arg string, values map[string]string) (string, bool) {
+	ok := true
+	for _, placeholder := range placeholders {
+		if !strings.Contains(arg, placeholder) {
+			continue
+		}
+		value := values[placeholder]
+		ok = ok && value != ""
+		arg = strings.ReplaceAll(arg, placeholder, value)
+	}
+	return arg, ok
+}
+
+// templateStarts reports whether the command template {template} starts the playback at the position.
+func templateStarts(template []string, start Position) bool {
+	for _, arg := range template {
+		if (start.Seconds > 0 && (strings.Contains(arg, placeholderStart) || strings.Contains(arg, placeholderStartMs))) ||
+			(start.Percent > 0 && strings.Contains(arg, placeholderPercent)) {
+			return true
+		}
+	}
+	return false
+}
@@ -7,7 +7,6 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -52,7 +51,7 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 	// Replace "%2F" with "/"
 	// surl = strings.ReplaceAll(surl, "%2F", "/")
 	newSurl := rearrangeURL(surl)
@@ -86,8 +85,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	// Create a new HTTP request with custom headers
 	req, err := http.NewRequest("GET", surl, nil)
 	if err != nil {
-		fmt.Println("Error creating HTTP request:", err)
-		return
+		return nil, err
 	}
 	for key, value := range headers {
 		req.Header.Set(key, value)
@@ -96,8 +94,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	// Perform the HTTP request
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println("Error making HTTP request:", err)
-		return
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -108,16 +105,14 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 		fmt.Println("Resource moved permanently to:", newURL)
 
 		// Follow the redirect by making another request to the new location
-		extractor(newURL, page, results, wg)
-		return
+		return extractor(newURL, page)
 	}
 
 	// Read the response body
 	body, err := ioutil.ReadAll(resp.Body)
 	logrus.Infof("body: [%s]...\n", body)
 	if err != nil {
-		fmt.Println("Error reading response body:", err)
-		return
+		return nil, err
 	}
 
 	// Process the response body
@@ -178,8 +173,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("Audiobookbay: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
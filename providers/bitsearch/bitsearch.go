@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -47,15 +46,13 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 	// func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup, Site string) { // Add Site as a parameter
 
 	logrus.Infof("Bitsearch: [%d] Extracting results...\n", page)
 	_, html, err := request.Get(nil, surl, nil)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("Bitsearch: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
 	var sources []models.Source
@@ -108,8 +105,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("Bitsearch: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
@@ -1,17 +1,19 @@
 package bt4g
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/html"
+	"golang.org/x/time/rate"
 
 	"github.com/stl3/torgo/models"
 	"github.com/stl3/torgo/request"
@@ -24,6 +26,7 @@ const (
 
 type provider struct {
 	models.Provider
+	*rate.Limiter
 }
 
 func New() models.ProviderInterface {
@@ -33,22 +36,21 @@ func New() models.ProviderInterface {
 	provider.Categories = models.Categories{
 		All: "/search?q=%v&category=all&orderby=seeders&p=%d",
 	}
+	provider.Limiter = rate.NewLimiter(rate.Every(time.Second), 1)
 	return provider
 }
 
 func (provider *provider) Search(query string, count int, categoryURL models.CategoryURL) ([]models.Source, error) {
-	results, err := provider.Query(query, categoryURL, count, 50, 1, extractor)
+	results, err := provider.Query(query, categoryURL, count, 50, 1, provider.extractor)
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func (provider *provider) extractor(surl string, page int) ([]models.Source, error) {
 	logrus.Infof("Bt4g: [%d] Extracting results...\n", page)
 
 	_, html, err := request.Get(nil, surl, nil)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("Bt4g: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
 	var sources []models.Source
@@ -71,18 +73,6 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 		URL, _ := result.Find("h5 a").Attr("href")
 		logrus.Infof("URL: %s", URL)
 
-		newURL := "https://bt4gprx.com" + URL
-		logrus.Infof("newURL: %s", newURL)
-
-		hash, err := getHashFromURL(newURL)
-		if err != nil {
-			fmt.Println("Error:", err)
-			return
-		}
-
-		// Construct the magnet URI
-		magnet := fmt.Sprintf("magnet:?xt=urn:btih:%s", hash)
-
 		filesizeStr := result.Find("b.cpill").Text()
 		filesize, _ := humanize.ParseBytes(strings.TrimSpace(filesizeStr))
 
@@ -99,14 +89,14 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 			Seeders:  seeders,
 			Leechers: leechers,
 			FileSize: int64(filesize),
-			Magnet:   magnet,
+			// The listing page has no magnet, it is fetched from the detail page only when needed
+			Resolver: provider.resolveMagnet,
 		}
 		sources = append(sources, source)
 	})
 
 	logrus.Debugf("Bt4g: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
@@ -135,6 +125,16 @@ func decodeHTMLText(text string) (string, error) {
 	}
 }
 
+// resolveMagnet builds the magnet uri from the info hash found on the detail page of the source.
+func (provider *provider) resolveMagnet(source models.Source) (string, error) {
+	_ = provider.Wait(context.Background())
+	hash, err := getHashFromURL(source.URL)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("magnet:?xt=urn:btih:%s", hash), nil
+}
+
 func getHashFromURL(url string) (string, error) {
 	// Make a GET request to the URL
 	response, err := http.Get(url)
@@ -1,9 +1,7 @@
 package btdigg
 
 import (
-	"fmt"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -44,14 +42,12 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 
 	logrus.Infof("BTDigg: [%d] Extracting results...\n", page)
 	_, html, err := request.Get(nil, surl, nil)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("BTDigg: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
 	var sources []models.Source
@@ -90,6 +86,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 			Leechers: 0,
 			FileSize: int64(filesize),
 			Magnet:   magnet,
+			Files:    extractFiles(result.Find("div.torrent_excerpt")),
 		}
 		sources = append(sources, source)
 
@@ -98,8 +95,30 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("BTDigg: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
+}
+
+// extractFiles reads the file list shown under a result: every file is an icon
+// (`fa-file-*`, folders use `fa-folder-*`) followed by its name and a size.
+func extractFiles(excerpt *goquery.Selection) []models.File {
+	var files []models.File
+	excerpt.Find("[class*='fa-file']").Each(func(_ int, icon *goquery.Selection) {
+		var name string
+		for node := icon.Nodes[0].NextSibling; node != nil; node = node.NextSibling {
+			if node.Type == html.TextNode {
+				name += node.Data
+				continue
+			}
+			break
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return
+		}
+		size, _ := humanize.ParseBytes(strings.TrimSpace(icon.NextAllFiltered("span").First().Text()))
+		files = append(files, models.File{Name: name, Size: int64(size)})
+	})
+	return files
 }
 
 // Checks if the text contains HTML-encoded entities
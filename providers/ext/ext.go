@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -78,7 +77,7 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 // 		return
 // 	}
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 	// surl = removeNumberedStrings(surl)
 
 	// Log or display the full URL before making the request
@@ -126,9 +125,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	// Make the HTTP GET request
 	resp, err := client.R().Get(surl)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("Ext: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
 	// // Make the request
@@ -195,8 +192,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("Ext: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
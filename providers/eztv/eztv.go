@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -57,6 +56,9 @@ func New() models.ProviderInterface {
 	provider := &provider{}
 	provider.Name = Name
 	provider.Site = Site
+	provider.Mirrors = []string{
+		"https://eztv.re",
+	}
 	provider.Categories = models.Categories{
 		TV: "/search/%v&%d",
 	}
@@ -70,7 +72,7 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 	surl = removeNumberedStrings(surl)
 
 	// Log or display the full URL before making the request
@@ -106,9 +108,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 		Get(surl)
 
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("EZTV: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
 	var sources []models.Source
@@ -164,8 +164,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("EZTV: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
@@ -1,10 +1,8 @@
 package knaben
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -44,14 +42,12 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 
 	logrus.Infof("knaben: [%d] Extracting results...\n", page)
 	_, html, err := request.Get(nil, surl, nil)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("knaben: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
 	var sources []models.Source
@@ -70,7 +66,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 		} else {
 			logrus.Infof("Title: %s", title)
 		}
-		
+
 		filesizeStr := result.Find("td:nth-child(3)").Text()
 		filesize, _ := humanize.ParseBytes(strings.TrimSpace(filesizeStr))
 		// date := result.Find("td[title^='20']").Text()
@@ -97,8 +93,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("knaben: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
@@ -2,11 +2,9 @@ package leetx
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -37,6 +35,10 @@ func New() models.ProviderInterface {
 	provider := &provider{}
 	provider.Name = Name
 	provider.Site = Site
+	provider.Mirrors = []string{
+		"https://1377x.to",
+		"https://www.1337xx.to",
+	}
 	provider.Categories = models.Categories{
 		All:           "/search/%v/%d/",
 		Movie:         "/category-search/%v/Movies/%d/",
@@ -58,7 +60,7 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func (provider *provider) extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func (provider *provider) extractor(surl string, page int) ([]models.Source, error) {
 	logrus.Infof("1337x: [%d] Extracting results...\n", page)
 	var html string
 	err := retry.Do(func() (err error) {
@@ -74,12 +76,10 @@ func (provider *provider) extractor(surl string, page int, results *[]models.Sou
 		retry.Attempts(3),
 	)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("1337x: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
-	var sources []models.Source // Temporary array for storing models.Source(s) but without magnet and torrent links
+	var sources []models.Source
 	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
 	table := doc.Find("table.table-list.table.table-responsive.table-striped")
 	table.Find("tr").Each(func(i int, tr *goquery.Selection) {
@@ -118,40 +118,34 @@ func (provider *provider) extractor(surl string, page int, results *[]models.Sou
 			Seeders:  seeders,
 			Leechers: leechers,
 			FileSize: int64(filesize),
+			// The listing page has no magnet, it is fetched from the detail page only when needed
+			Resolver: provider.resolveMagnet,
 		}
 		sources = append(sources, source)
 	})
 
 	logrus.Debugf("1337x: [%d] Amount of results: %d", page, len(sources))
-	logrus.Debugf("1337x: [%d] Getting sources in parallel...", page)
-	group := sync.WaitGroup{}
-	for _, source := range sources {
-		group.Add(1)
-		go func(source models.Source) {
-			var magnet string
-
-			_, html, err := request.Get(nil, source.URL, nil)
-			if err != nil {
-				logrus.Errorln(err)
-				group.Done()
-				return
-			}
-			doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
-			dropdown := doc.Find("ul.dropdown-menu")
-			li := dropdown.Find("li")
-			if li != nil {
-				if val, ok := li.Last().Find("a").Attr("href"); ok {
-					magnet = val
-				}
-			}
-			// Assignment
-			source.Magnet = magnet
-			*results = append(*results, source)
-			group.Done()
-		}(source)
+	return sources, nil
+}
+
+// resolveMagnet gets the magnet uri from the detail page of the source.
+func (provider *provider) resolveMagnet(source models.Source) (string, error) {
+	var magnet string
+
+	_ = provider.Wait(context.Background())
+	_, html, err := request.Get(nil, source.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
+	dropdown := doc.Find("ul.dropdown-menu")
+	li := dropdown.Find("li")
+	if li != nil {
+		if val, ok := li.Last().Find("a").Attr("href"); ok {
+			magnet = val
+		}
 	}
-	group.Wait()
-	wg.Done()
+	return magnet, nil
 }
 
 // Checks if the text contains HTML-encoded entities
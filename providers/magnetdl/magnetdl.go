@@ -1,10 +1,8 @@
 package magnetdl
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -31,6 +29,9 @@ func New() models.ProviderInterface {
 	provider := &provider{}
 	provider.Name = Name
 	provider.Site = Site
+	provider.Mirrors = []string{
+		"https://magnetdl.skin",
+	}
 	provider.Categories = models.Categories{
 		// Changed Jan 2024
 		// Format now takes the first letter from query, and changes space to "-"
@@ -53,7 +54,7 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 	// Replace "%2F" with "/"
 	surl = strings.ReplaceAll(surl, "%2F", "/")
 	// Log or display the full URL before making the request
@@ -63,9 +64,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	// _, html, err := request.Get(nil, strings.ReplaceAll(surl, "/", "%2F"), nil)
 	_, html, err := request.Get(nil, surl, nil)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("MagnetDL: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
 	var sources []models.Source
@@ -114,8 +113,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("MagnetDL: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
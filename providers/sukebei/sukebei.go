@@ -1,10 +1,8 @@
 package sukebei
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/dustin/go-humanize"
 	"golang.org/x/net/html"
@@ -41,13 +39,11 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 	logrus.Infof("Sukebei: [%d] Extracting results...\n", page)
 	_, html, err := request.Get(nil, surl, nil)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("Sukebei: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 	var sources []models.Source
 	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
@@ -94,8 +90,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 		sources = append(sources, source)
 	})
 	logrus.Debugf("Sukebei: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
@@ -1,11 +1,9 @@
 package thepiratebay
 
 import (
-	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -56,13 +54,11 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 	logrus.Infof("ThePirateBay: [%d] Extracting results...\n", page)
 	_, html, err := request.Get(nil, surl, nil)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("ThePirateBay: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 	var sources []models.Source
 	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(html))
@@ -119,11 +115,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("ThePirateBay: [%d] Amount of results: %d", page, len(sources))
-	if len(sources) > 0 {
-		*results = append(*results, sources...)
-	}
-
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
@@ -1,10 +1,8 @@
 package torrentquest
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/dustin/go-humanize"
@@ -49,7 +47,7 @@ func (provider *provider) Search(query string, count int, categoryURL models.Cat
 	return results, err
 }
 
-func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGroup) {
+func extractor(surl string, page int) ([]models.Source, error) {
 	// Replace "%2F" with "/"
 	surl = strings.ReplaceAll(surl, "%2F", "/")
 	// Log or display the full URL before making the request
@@ -59,9 +57,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	// _, html, err := request.Get(nil, strings.ReplaceAll(surl, "/", "%2F"), nil)
 	_, html, err := request.Get(nil, surl, nil)
 	if err != nil {
-		logrus.Errorln(fmt.Sprintf("torrentquest: [%d]", page), err)
-		wg.Done()
-		return
+		return nil, err
 	}
 
 	var sources []models.Source
@@ -110,8 +106,7 @@ func extractor(surl string, page int, results *[]models.Source, wg *sync.WaitGro
 	})
 
 	logrus.Debugf("torrentquest: [%d] Amount of results: %d", page, len(sources))
-	*results = append(*results, sources...)
-	wg.Done()
+	return sources, nil
 }
 
 // Checks if the text contains HTML-encoded entities
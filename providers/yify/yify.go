@@ -43,6 +43,9 @@ func New() models.ProviderInterface {
 	provider := &provider{}
 	provider.Name = Name
 	provider.Site = Site
+	provider.Mirrors = []string{
+		"https://yts.am",
+	}
 	provider.Categories = models.Categories{
 		All:   "/v2/list_movies.json?query_term=%v&limit=50&page=%d",
 		Movie: "/v2/list_movies.json?query_term=%v&limit=50&page=%d",
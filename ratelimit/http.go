@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Path is where the handler of the limiter is served, by stream sessions and the daemon.
+const Path = "/api/limits"
+
+// Handler returns the HTTP handler of the limiter:
+//
+//	GET /api/limits   state of the limiter
+//	PUT /api/limits   change the limits: {"download": 2000000, "upload": 0}, or {"reset": true}
+//
+// Both return the state of the limiter, errors are returned as {"error": "..."}.
+func (l *Limiter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, l.Status())
+		case http.MethodPut: // not POST, which the web pages of other sites can send without asking
+			var change Change
+			if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, l.Change(change))
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logrus.Debugln("Error writing the response:", err)
+	}
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Get returns the state of the limiter of the torgo server at {baseURL}, e.g. http://localhost:8789.
+func Get(baseURL string) (Status, error) {
+	return request(http.MethodGet, baseURL, nil)
+}
+
+// Update changes the limits of the torgo server at {baseURL}, and returns the state of its limiter.
+func Update(baseURL string, change Change) (Status, error) {
+	return request(http.MethodPut, baseURL, &change)
+}
+
+func request(method, baseURL string, change *Change) (Status, error) {
+	var status Status
+	var body bytes.Buffer
+	if change != nil {
+		if err := json.NewEncoder(&body).Encode(change); err != nil {
+			return status, err
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(baseURL, "/")+Path, &body)
+	if err != nil {
+		return status, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiError) == nil && apiError.Error != "" {
+			return status, errors.New(apiError.Error)
+		}
+		return status, fmt.Errorf("%s: %s", baseURL, resp.Status)
+	}
+	return status, json.NewDecoder(resp.Body).Decode(&status)
+}
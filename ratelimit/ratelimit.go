@@ -0,0 +1,285 @@
+/*
+Package ratelimit limits the download and upload rates of a torrent client through its rate limiters.
+Alternative limits can be applied during a time-of-day schedule (e.g. full speed at night),
+and the limits can be changed while the client runs, through the HTTP handler of the limiter (see `Limiter.Handler`).
+*/
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/dustin/go-humanize"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+
+	"github.com/stl3/torgo/config"
+)
+
+// burst is the burst of the limiters: the torrent client needs it to fit a whole chunk (16 KiB) and its reads.
+const burst = 256 << 10
+
+// checkInterval is how often the schedule is checked.
+const checkInterval = 30 * time.Second
+
+// Limits are download and upload rates, in bytes per second. 0 is no limit.
+type Limits struct {
+	Download int64 `json:"download"`
+	Upload   int64 `json:"upload"`
+}
+
+func (l Limits) String() string {
+	return fmt.Sprintf("download %s, upload %s", FormatRate(l.Download), FormatRate(l.Upload))
+}
+
+// ParseRate parses a rate in bytes per second such as "2MB", "500 kB/s" or "1MiB".
+// An empty rate, "0", "none" and "unlimited" are no limit.
+func ParseRate(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "/s")
+	switch strings.ToLower(s) {
+	case "", "0", "none", "unlimited":
+		return 0, nil
+	}
+	n, err := humanize.ParseBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, err)
+	}
+	return int64(n), nil
+}
+
+// FormatRate returns a rate in bytes per second as text.
+func FormatRate(rate int64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	return humanize.Bytes(uint64(rate)) + "/s"
+}
+
+// Schedule is the time of the day the alternative limits apply. The zero Schedule never applies.
+type Schedule struct {
+	Start, End time.Duration // since midnight, End is before Start when the schedule spans midnight
+}
+
+// ParseSchedule parses a schedule such as "08:00-18:00" or "22:30-06:00". An empty schedule never applies.
+func ParseSchedule(s string) (Schedule, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Schedule{}, nil
+	}
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return Schedule{}, fmt.Errorf("invalid schedule %q, expected e.g. 08:00-18:00", s)
+	}
+	var schedule Schedule
+	for _, t := range []struct {
+		text  string
+		value *time.Duration
+	}{{start, &schedule.Start}, {end, &schedule.End}} {
+		clock, err := time.Parse("15:04", strings.TrimSpace(t.text))
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule %q, expected e.g. 08:00-18:00", s)
+		}
+		*t.value = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	}
+	if schedule.Start == schedule.End {
+		return Schedule{}, fmt.Errorf("invalid schedule %q: it starts when it ends", s)
+	}
+	return schedule, nil
+}
+
+// Active reports whether the schedule applies at {t}, in the local time.
+func (s Schedule) Active(t time.Time) bool {
+	if s == (Schedule{}) {
+		return false
+	}
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if s.Start < s.End {
+		return now >= s.Start && now < s.End
+	}
+	return now >= s.Start || now < s.End
+}
+
+func (s Schedule) String() string {
+	if s == (Schedule{}) {
+		return ""
+	}
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(s.Start) + "-" + clock(s.End)
+}
+
+// Limiter holds the rate limiters of a torrent client, and sets their limits from the configured limits,
+// the schedule and the changes made while running.
+type Limiter struct {
+	download *rate.Limiter
+	upload   *rate.Limiter
+	mu       sync.Mutex
+	// every field below is guarded by mu
+	normal      Limits
+	alternative Limits
+	schedule    Schedule
+	alternate   bool    // whether the schedule applies the alternative limits
+	override    *Limits // limits changed while running, until the schedule switches
+}
+
+// New returns a limiter applying the {normal} limits, and the {alternative} limits during the {schedule}.
+func New(normal, alternative Limits, schedule Schedule) *Limiter {
+	l := &Limiter{
+		download:    rate.NewLimiter(rate.Inf, burst),
+		upload:      rate.NewLimiter(rate.Inf, burst),
+		normal:      normal,
+		alternative: alternative,
+		schedule:    schedule,
+	}
+	l.mu.Lock()
+	l.alternate = schedule.Active(time.Now())
+	l.apply()
+	l.mu.Unlock()
+	return l
+}
+
+// FromConfig returns the limiter of the limits set in the configuration.
+func FromConfig(cfg config.TorgoConfig) (*Limiter, error) {
+	var normal, alternative Limits
+	for _, r := range []struct {
+		text  string
+		value *int64
+	}{
+		{cfg.DownloadLimit, &normal.Download},
+		{cfg.UploadLimit, &normal.Upload},
+		{cfg.AltDownloadLimit, &alternative.Download},
+		{cfg.AltUploadLimit, &alternative.Upload},
+	} {
+		rate, err := ParseRate(r.text)
+		if err != nil {
+			return nil, err
+		}
+		*r.value = rate
+	}
+	schedule, err := ParseSchedule(cfg.AltSchedule)
+	if err != nil {
+		return nil, err
+	}
+	return New(normal, alternative, schedule), nil
+}
+
+// Configure makes the torrent client of {cfg} use the limiters.
+func (l *Limiter) Configure(cfg *torrent.ClientConfig) {
+	cfg.DownloadRateLimiter = l.download
+	cfg.UploadRateLimiter = l.upload
+}
+
+// Run switches between the normal and the alternative limits on schedule, until {stop} is closed.
+func (l *Limiter) Run(stop <-chan struct{}) {
+	if l.schedule == (Schedule{}) {
+		return
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			l.update(now)
+		}
+	}
+}
+
+// update applies the limits of the schedule at {now}, if it switched.
+func (l *Limiter) update(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	alternate := l.schedule.Active(now)
+	if alternate == l.alternate {
+		return
+	}
+	l.alternate = alternate
+	l.override = nil
+	l.apply()
+	if alternate {
+		logrus.Infof("Alternative rate limits (%s): %s", l.schedule, l.current())
+	} else {
+		logrus.Infof("Rate limits: %s", l.current())
+	}
+}
+
+// current returns the limits in force. mu must be held.
+func (l *Limiter) current() Limits {
+	switch {
+	case l.override != nil:
+		return *l.override
+	case l.alternate:
+		return l.alternative
+	default:
+		return l.normal
+	}
+}
+
+// apply sets the limits in force to the rate limiters. mu must be held.
+func (l *Limiter) apply() {
+	limits := l.current()
+	for _, r := range []struct {
+		limiter *rate.Limiter
+		rate    int64
+	}{{l.download, limits.Download}, {l.upload, limits.Upload}} {
+		if r.rate <= 0 {
+			r.limiter.SetLimit(rate.Inf)
+		} else {
+			r.limiter.SetLimit(rate.Limit(r.rate))
+		}
+	}
+}
+
+// Status is the state of a limiter.
+type Status struct {
+	Limits             // limits in force
+	Alternative bool   `json:"alternative"` // whether the schedule applies the alternative limits
+	Overridden  bool   `json:"overridden"`  // whether the limits were changed while running
+	Schedule    string `json:"schedule,omitempty"`
+}
+
+// Status returns the state of the limiter.
+func (l *Limiter) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Status{
+		Limits:      l.current(),
+		Alternative: l.alternate,
+		Overridden:  l.override != nil,
+		Schedule:    l.schedule.String(),
+	}
+}
+
+// Change is a change of the limits while running: the nil rates are kept,
+// and Reset goes back to the configured limits.
+type Change struct {
+	Download *int64 `json:"download,omitempty"`
+	Upload   *int64 `json:"upload,omitempty"`
+	Reset    bool   `json:"reset,omitempty"`
+}
+
+// Change changes the limits in force, until the schedule switches, and returns the state of the limiter.
+func (l *Limiter) Change(change Change) Status {
+	l.mu.Lock()
+	if change.Reset {
+		l.override = nil
+	}
+	if change.Download != nil || change.Upload != nil {
+		limits := l.current()
+		if change.Download != nil {
+			limits.Download = max(*change.Download, 0)
+		}
+		if change.Upload != nil {
+			limits.Upload = max(*change.Upload, 0)
+		}
+		l.override = &limits
+	}
+	l.apply()
+	l.mu.Unlock()
+	return l.Status()
+}
@@ -0,0 +1,115 @@
+package subtitles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxFileSize is the largest subtitle file downloaded.
+const maxFileSize = 10 << 20
+
+// Quota is what is left of the downloads allowed per day.
+type Quota struct {
+	Remaining int
+	Reset     time.Time // when the downloads are counted again, zero when unknown
+}
+
+// QuotaError is returned when no download is left for the day.
+type QuotaError struct {
+	Message string
+	Reset   time.Time // zero when unknown
+}
+
+func (e *QuotaError) Error() string {
+	message := "OpenSubtitles: no download left for today"
+	if e.Message != "" {
+		message = "OpenSubtitles: " + e.Message
+	}
+	if !e.Reset.IsZero() {
+		message += fmt.Sprintf(" (reset in %s)", time.Until(e.Reset).Round(time.Minute))
+	}
+	return message
+}
+
+// downloadAnswer is the answer of the API to a download, or to a download past the quota.
+type downloadAnswer struct {
+	Link         string    `json:"link"`
+	FileName     string    `json:"file_name"`
+	Remaining    int       `json:"remaining"`
+	Message      string    `json:"message"`
+	ResetTimeUTC time.Time `json:"reset_time_utc"`
+}
+
+func quotaError(answer []byte) error {
+	var download downloadAnswer
+	_ = json.Unmarshal(answer, &download)
+	return &QuotaError{Message: download.Message, Reset: download.ResetTimeUTC}
+}
+
+// Download downloads the subtitle file {fileID} as .srt into {dir}, and returns its path and what is left of the quota.
+func (c *Client) Download(ctx context.Context, fileID int, dir string) (string, Quota, error) {
+	var download downloadAnswer
+	request := map[string]any{"file_id": fileID, "sub_format": "srt"}
+	if err := c.do(ctx, http.MethodPost, "/download", nil, request, &download); err != nil {
+		return "", Quota{}, err
+	}
+	quota := Quota{Remaining: download.Remaining, Reset: download.ResetTimeUTC}
+	if download.Link == "" {
+		return "", quota, quotaError(nil)
+	}
+
+	// The link is a file served by a CDN, without the headers of the API
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, download.Link, nil)
+	if err != nil {
+		return "", quota, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", quota, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", quota, &APIError{Status: resp.StatusCode, Message: "download of " + download.FileName}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", quota, err
+	}
+	path := filepath.Join(dir, fileName(download.FileName, fileID))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", quota, err
+	}
+	_, err = io.Copy(file, io.LimitReader(resp.Body, maxFileSize))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", quota, err
+	}
+	return path, quota, nil
+}
+
+var unsafeName = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]+`)
+
+// fileName returns the name the API gave to the subtitle file, safe on every OS, ending with .srt.
+func fileName(name string, fileID int) string {
+	name = strings.Trim(unsafeName.ReplaceAllString(name, "_"), ". ")
+	if name == "" {
+		name = fmt.Sprintf("%d", fileID)
+	}
+	if !strings.EqualFold(filepath.Ext(name), ".srt") {
+		name += ".srt"
+	}
+	return name
+}
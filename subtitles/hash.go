@@ -0,0 +1,29 @@
+package subtitles
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// hashChunkSize is the size of the beginning and of the end of a file which are hashed.
+const hashChunkSize = 64 << 10
+
+// Hash returns the hash OpenSubtitles identifies a video file of {size} bytes with:
+// the size plus the sum of the 64 bit words of its first and last 64 KiB.
+func Hash(r io.ReaderAt, size int64) (string, error) {
+	if size < hashChunkSize {
+		return "", fmt.Errorf("file too small to be hashed: %d bytes", size)
+	}
+	hash := uint64(size)
+	chunk := make([]byte, hashChunkSize)
+	for _, offset := range []int64{0, size - hashChunkSize} {
+		if _, err := r.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return "", err
+		}
+		for i := 0; i < hashChunkSize; i += 8 {
+			hash += binary.LittleEndian.Uint64(chunk[i:])
+		}
+	}
+	return fmt.Sprintf("%016x", hash), nil
+}
@@ -0,0 +1,61 @@
+package subtitles
+
+import "strings"
+
+// languages are the codes of the API (ISO 639-1, with a region for a few) by ISO 639-2 code,
+// the codes of the former XML-RPC API.
+var languages = map[string]string{
+	"ara": "ar",
+	"bul": "bg",
+	"chi": "zh-cn",
+	"zho": "zh-cn",
+	"zht": "zh-tw",
+	"cze": "cs",
+	"ces": "cs",
+	"dan": "da",
+	"dut": "nl",
+	"nld": "nl",
+	"eng": "en",
+	"fin": "fi",
+	"fre": "fr",
+	"fra": "fr",
+	"ger": "de",
+	"deu": "de",
+	"gre": "el",
+	"ell": "el",
+	"heb": "he",
+	"hin": "hi",
+	"hun": "hu",
+	"ind": "id",
+	"ita": "it",
+	"jpn": "ja",
+	"kor": "ko",
+	"nor": "no",
+	"per": "fa",
+	"fas": "fa",
+	"pol": "pl",
+	"por": "pt-pt",
+	"pob": "pt-br",
+	"rum": "ro",
+	"ron": "ro",
+	"rus": "ru",
+	"spa": "es",
+	"swe": "sv",
+	"tha": "th",
+	"tur": "tr",
+	"ukr": "uk",
+	"vie": "vi",
+}
+
+// LanguageCode returns the code of the API of a language given by its code of the API or its ISO 639-2 code,
+// e.g. en for eng. It returns "" for a code it does not know.
+func LanguageCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if api, ok := languages[code]; ok {
+		return api
+	}
+	if len(code) == 2 || (len(code) == 5 && code[2] == '-') {
+		return code
+	}
+	return ""
+}
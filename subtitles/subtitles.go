@@ -0,0 +1,294 @@
+/*
+Package subtitles searches and downloads subtitles with the REST API of OpenSubtitles.com.
+
+The API needs an API key (https://www.opensubtitles.com/en/consumers), the downloads are counted per day:
+a few without login, more once logged in with an account of the site (see `Client.Login`). The subtitles are
+searched by title, IMDb ID or hash of the file (see `Hash`), and downloaded as .srt files.
+*/
+package subtitles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the address of the API.
+const DefaultBaseURL = "https://api.opensubtitles.com/api/v1"
+
+const (
+	requestTimeout = 30 * time.Second
+	maxRetries     = 3 // of a request rate limited (429)
+)
+
+// ErrNoAPIKey is returned when the client has no API key.
+var ErrNoAPIKey = errors.New("OpenSubtitles needs an API key, see https://www.opensubtitles.com/en/consumers")
+
+// Client is a client of the API, logged in or not.
+type Client struct {
+	APIKey    string
+	Username  string // the downloads are anonymous when empty
+	Password  string
+	BaseURL   string // DefaultBaseURL, or the server the login tells to use
+	UserAgent string // name and version of the application, required by the API
+	HTTP      *http.Client
+	token     string // of the login
+}
+
+// New returns a client of the API with the key {apiKey}, logging in as {username} if not empty.
+func New(apiKey, username, password, userAgent string) *Client {
+	return &Client{
+		APIKey:    apiKey,
+		Username:  username,
+		Password:  password,
+		BaseURL:   DefaultBaseURL,
+		UserAgent: userAgent,
+		HTTP:      &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// APIError is an error answered by the API.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("OpenSubtitles: %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("OpenSubtitles: %s (%d)", e.Message, e.Status)
+}
+
+// do sends a request to the API, and decodes its JSON answer into {out}.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any, out any) error {
+	if c.APIKey == "" {
+		return ErrNoAPIKey
+	}
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	target := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		// Sorted and lowercase, the API redirects the other requests
+		target += "?" + query.Encode()
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Api-Key", c.APIKey)
+		req.Header.Set("User-Agent", c.UserAgent)
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			return err
+		}
+		answer, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			wait := time.Second
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if resp.StatusCode == http.StatusNotAcceptable && path == "/download" {
+			return quotaError(answer)
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			var failure struct {
+				Message string   `json:"message"`
+				Errors  []string `json:"errors"`
+			}
+			_ = json.Unmarshal(answer, &failure)
+			if failure.Message == "" {
+				failure.Message = strings.Join(failure.Errors, ", ")
+			}
+			return &APIError{Status: resp.StatusCode, Message: failure.Message}
+		}
+		if out == nil {
+			return nil
+		}
+		if err := json.Unmarshal(answer, out); err != nil {
+			return fmt.Errorf("OpenSubtitles: %w", err)
+		}
+		return nil
+	}
+}
+
+// Login logs in as the user of the client, which raises the downloads allowed per day.
+// It does nothing without username.
+func (c *Client) Login(ctx context.Context) error {
+	if c.Username == "" || c.token != "" {
+		return nil
+	}
+	var answer struct {
+		Token   string `json:"token"`
+		BaseURL string `json:"base_url"` // host the logged in users are served by
+	}
+	credentials := map[string]string{"username": c.Username, "password": c.Password}
+	if err := c.do(ctx, http.MethodPost, "/login", nil, credentials, &answer); err != nil {
+		return err
+	}
+	c.token = answer.Token
+	if answer.BaseURL != "" && c.BaseURL == DefaultBaseURL {
+		c.BaseURL = "https://" + strings.TrimPrefix(strings.TrimPrefix(answer.BaseURL, "https://"), "http://") + "/api/v1"
+	}
+	return nil
+}
+
+// Logout ends the session of the login, if any.
+func (c *Client) Logout(ctx context.Context) error {
+	if c.token == "" {
+		return nil
+	}
+	err := c.do(ctx, http.MethodDelete, "/logout", nil, nil, nil)
+	c.token = ""
+	return err
+}
+
+// Query is a search of subtitles: by IMDb ID, by hash of the file, or else by title.
+type Query struct {
+	Query     string // title, or release name
+	Year      int
+	IMDbID    string // e.g. tt0111161
+	MovieHash string // see `Hash`
+	Season    int    // of an episode
+	Episode   int
+	Languages []string // codes of the languages, e.g. en or eng (see `LanguageCode`), every language when empty
+}
+
+// values returns the parameters of the search, in the form the API wants.
+func (q Query) values() url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, strings.ToLower(value))
+		}
+	}
+	set("query", strings.TrimSpace(q.Query))
+	if q.Year > 0 {
+		set("year", strconv.Itoa(q.Year))
+	}
+	if id := strings.TrimLeft(strings.TrimPrefix(strings.ToLower(q.IMDbID), "tt"), "0"); id != "" {
+		set("imdb_id", id)
+	}
+	set("moviehash", q.MovieHash)
+	if q.Season > 0 {
+		set("season_number", strconv.Itoa(q.Season))
+	}
+	if q.Episode > 0 {
+		set("episode_number", strconv.Itoa(q.Episode))
+	}
+	var languages []string
+	for _, language := range q.Languages {
+		if code := LanguageCode(language); code != "" {
+			languages = append(languages, code)
+		}
+	}
+	sort.Strings(languages)
+	set("languages", strings.Join(languages, ","))
+	return values
+}
+
+// Subtitle is a subtitle file found.
+type Subtitle struct {
+	FileID          int
+	FileName        string
+	Language        string // code of the language, e.g. en
+	Release         string // name of the release the subtitles are timed for
+	Title           string
+	Year            int
+	HearingImpaired bool
+	Downloads       int
+	Uploader        string
+	MovieHashMatch  bool // timed for the very file searched by hash
+}
+
+// Search returns the subtitles matching the query, the ones of the file searched by hash first.
+func (c *Client) Search(ctx context.Context, q Query) ([]Subtitle, error) {
+	var answer struct {
+		Data []struct {
+			Attributes struct {
+				Language        string `json:"language"`
+				Release         string `json:"release"`
+				HearingImpaired bool   `json:"hearing_impaired"`
+				DownloadCount   int    `json:"download_count"`
+				MovieHashMatch  bool   `json:"moviehash_match"`
+				Uploader        struct {
+					Name string `json:"name"`
+				} `json:"uploader"`
+				FeatureDetails struct {
+					Title     string `json:"title"`
+					MovieName string `json:"movie_name"`
+					Year      int    `json:"year"`
+				} `json:"feature_details"`
+				Files []struct {
+					FileID   int    `json:"file_id"`
+					FileName string `json:"file_name"`
+				} `json:"files"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/subtitles", q.values(), nil, &answer); err != nil {
+		return nil, err
+	}
+	var found []Subtitle
+	for _, data := range answer.Data {
+		a := data.Attributes
+		title := a.FeatureDetails.MovieName
+		if title == "" {
+			title = a.FeatureDetails.Title
+		}
+		// Subtitles split in several files (CDs) are left out, a stream is a single file
+		if len(a.Files) != 1 {
+			continue
+		}
+		found = append(found, Subtitle{
+			FileID:          a.Files[0].FileID,
+			FileName:        a.Files[0].FileName,
+			Language:        a.Language,
+			Release:         a.Release,
+			Title:           title,
+			Year:            a.FeatureDetails.Year,
+			HearingImpaired: a.HearingImpaired,
+			Downloads:       a.DownloadCount,
+			Uploader:        a.Uploader.Name,
+			MovieHashMatch:  a.MovieHashMatch,
+		})
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].MovieHashMatch && !found[j].MovieHashMatch
+	})
+	return found, nil
+}
@@ -0,0 +1,361 @@
+package subtitles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testAPIKey    = "key"
+	testUserAgent = "torgo v0.0.0"
+)
+
+// newTestClient returns a client of the API served by {handler}, whose paths start with /api/v1.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c := New(testAPIKey, "", "", testUserAgent)
+	c.BaseURL = srv.URL + "/api/v1"
+	return c
+}
+
+// checkHeaders fails the test when a request to the API lacks the headers the API requires.
+func checkHeaders(t *testing.T, r *http.Request, token string) {
+	t.Helper()
+	if got := r.Header.Get("Api-Key"); got != testAPIKey {
+		t.Errorf("%s: Api-Key = %q", r.URL.Path, got)
+	}
+	if got := r.Header.Get("User-Agent"); got != testUserAgent {
+		t.Errorf("%s: User-Agent = %q", r.URL.Path, got)
+	}
+	want := ""
+	if token != "" {
+		want = "Bearer " + token
+	}
+	if got := r.Header.Get("Authorization"); got != want {
+		t.Errorf("%s: Authorization = %q, want %q", r.URL.Path, got, want)
+	}
+}
+
+func TestNoAPIKey(t *testing.T) {
+	c := New("", "", "", testUserAgent)
+	if _, err := c.Search(context.Background(), Query{Query: "movie"}); !errors.Is(err, ErrNoAPIKey) {
+		t.Errorf("error = %v, want ErrNoAPIKey", err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	var loggedOut atomic.Bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/login":
+			checkHeaders(t, r, "")
+			var credentials map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+				t.Error(err)
+			}
+			if credentials["username"] != "user" || credentials["password"] != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = io.WriteString(w, `{"message": "Error, invalid username/password", "status": 401}`)
+				return
+			}
+			_, _ = io.WriteString(w, `{"token": "tok", "base_url": "vip-api.opensubtitles.com", "status": 200}`)
+		case "DELETE /api/v1/logout":
+			checkHeaders(t, r, "tok")
+			loggedOut.Store(true)
+			_, _ = io.WriteString(w, `{"message": "token successfully destroyed", "status": 200}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	ctx := context.Background()
+
+	// Without username, nothing is sent
+	if err := c.Login(ctx); err != nil || c.token != "" {
+		t.Fatalf("anonymous login: token %q, %v", c.token, err)
+	}
+
+	c.Username, c.Password = "user", "wrong"
+	var apiErr *APIError
+	if err := c.Login(ctx); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized ||
+		apiErr.Message != "Error, invalid username/password" {
+		t.Fatalf("error = %v, want the 401 of the API", err)
+	}
+
+	c.Password = "secret"
+	baseURL := c.BaseURL
+	if err := c.Login(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.token != "tok" {
+		t.Errorf("token = %q", c.token)
+	}
+	// Only the default server is replaced by the one of the login
+	if c.BaseURL != baseURL {
+		t.Errorf("base URL = %q, want %q", c.BaseURL, baseURL)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !loggedOut.Load() || c.token != "" {
+		t.Errorf("logged out: %t, token %q", loggedOut.Load(), c.token)
+	}
+}
+
+func TestLoginBaseURL(t *testing.T) {
+	c := New(testAPIKey, "user", "secret", testUserAgent)
+	c.HTTP = &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		if r.URL.String() != DefaultBaseURL+"/login" {
+			t.Errorf("URL = %s", r.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"token": "tok", "base_url": "vip-api.opensubtitles.com"}`)),
+			Request:    r,
+		}, nil
+	})}
+	if err := c.Login(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://vip-api.opensubtitles.com/api/v1"; c.BaseURL != want {
+		t.Errorf("base URL = %q, want %q", c.BaseURL, want)
+	}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// searchAnswer is a search answer of the API: a subtitle for the file hashed, one for a release,
+// and one split in two files.
+const searchAnswer = `{
+	"total_count": 3,
+	"data": [
+		{"id": "1", "type": "subtitle", "attributes": {
+			"language": "en", "release": "The.Show.S01E02.720p.HDTV", "download_count": 1200, "hearing_impaired": true,
+			"moviehash_match": false, "uploader": {"name": "someone"},
+			"feature_details": {"title": "Pilot", "movie_name": "The Show - S01E02 Pilot", "year": 2020},
+			"files": [{"file_id": 11, "file_name": "The.Show.S01E02.720p.HDTV"}]}},
+		{"id": "2", "type": "subtitle", "attributes": {
+			"language": "fr", "release": "The.Show.S01E02.CD1-2", "download_count": 10,
+			"feature_details": {"title": "Pilot", "year": 2020},
+			"files": [{"file_id": 21, "file_name": "cd1"}, {"file_id": 22, "file_name": "cd2"}]}},
+		{"id": "3", "type": "subtitle", "attributes": {
+			"language": "fr", "release": "The.Show.S01E02.1080p.WEB", "download_count": 300,
+			"moviehash_match": true, "uploader": {"name": "other"},
+			"feature_details": {"title": "Pilot", "year": 2020},
+			"files": [{"file_id": 31, "file_name": "The.Show.S01E02.1080p.WEB.srt"}]}}
+	]
+}`
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  string // raw query sent
+	}{
+		{"title", Query{Query: " The Show ", Year: 2020, Languages: []string{"fre", "EN", "xx1"}},
+			"languages=en%2Cfr&query=the+show&year=2020"},
+		{"imdb id", Query{IMDbID: "tt0111161", Languages: []string{"eng"}},
+			"imdb_id=111161&languages=en"},
+		{"moviehash and episode", Query{Query: "The Show", MovieHash: "ABC", Season: 1, Episode: 2, Languages: []string{"en", "fr"}},
+			"episode_number=2&languages=en%2Cfr&moviehash=abc&query=the+show&season_number=1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				checkHeaders(t, r, "")
+				if r.Method != http.MethodGet || r.URL.Path != "/api/v1/subtitles" {
+					t.Errorf("request = %s %s", r.Method, r.URL.Path)
+				}
+				if r.URL.RawQuery != test.want {
+					t.Errorf("query = %s, want %s", r.URL.RawQuery, test.want)
+				}
+				_, _ = io.WriteString(w, searchAnswer)
+			})
+			found, err := c.Search(context.Background(), test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The subtitle in two files is left out, the one of the file hashed comes first
+			if len(found) != 2 {
+				t.Fatalf("found %d subtitles, want 2: %+v", len(found), found)
+			}
+			want := Subtitle{
+				FileID: 31, FileName: "The.Show.S01E02.1080p.WEB.srt", Language: "fr", Release: "The.Show.S01E02.1080p.WEB",
+				Title: "Pilot", Year: 2020, Downloads: 300, Uploader: "other", MovieHashMatch: true,
+			}
+			if found[0] != want {
+				t.Errorf("first = %+v, want %+v", found[0], want)
+			}
+			want = Subtitle{
+				FileID: 11, FileName: "The.Show.S01E02.720p.HDTV", Language: "en", Release: "The.Show.S01E02.720p.HDTV",
+				Title: "The Show - S01E02 Pilot", Year: 2020, HearingImpaired: true, Downloads: 1200, Uploader: "someone",
+			}
+			if found[1] != want {
+				t.Errorf("second = %+v, want %+v", found[1], want)
+			}
+		})
+	}
+}
+
+func TestDownload(t *testing.T) {
+	const srt = "1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n"
+	reset := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/download":
+			checkHeaders(t, r, "")
+			var request struct {
+				FileID    int    `json:"file_id"`
+				SubFormat string `json:"sub_format"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Error(err)
+			}
+			if r.Method != http.MethodPost || request.FileID != 31 || request.SubFormat != "srt" {
+				t.Errorf("download request = %s %+v", r.Method, request)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"link":           "http://" + r.Host + "/cdn/file",
+				"file_name":      "The.Show: S01E02?",
+				"requests":       5,
+				"remaining":      15,
+				"reset_time_utc": reset,
+			})
+		case "/cdn/file":
+			// The file is not served by the API
+			if r.Header.Get("Api-Key") != "" {
+				t.Error("API key sent to the download link")
+			}
+			_, _ = io.WriteString(w, srt)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	dir := filepath.Join(t.TempDir(), "subtitles")
+	path, quota, err := c.Download(context.Background(), 31, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "The.Show_ S01E02_.srt"); path != want {
+		t.Errorf("path = %q, want %q", path, want)
+	}
+	if quota.Remaining != 15 || !quota.Reset.Equal(reset) {
+		t.Errorf("quota = %+v", quota)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != srt {
+		t.Errorf("file = %q, want %q", data, srt)
+	}
+}
+
+func TestDownloadQuota(t *testing.T) {
+	reset := time.Now().Add(3 * time.Hour).UTC().Truncate(time.Second)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotAcceptable)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"requests":       21,
+			"remaining":      -1,
+			"message":        "You have downloaded your allowed 20 subtitles for 24h.",
+			"reset_time_utc": reset,
+		})
+	})
+
+	dir := t.TempDir()
+	path, _, err := c.Download(context.Background(), 31, dir)
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("error = %v, want a QuotaError", err)
+	}
+	if quotaErr.Message != "You have downloaded your allowed 20 subtitles for 24h." || !quotaErr.Reset.Equal(reset) {
+		t.Errorf("quota error = %+v", quotaErr)
+	}
+	if !strings.Contains(err.Error(), "reset in 3h0m0s") {
+		t.Errorf("error = %q", err)
+	}
+	if entries, _ := os.ReadDir(dir); path != "" || len(entries) != 0 {
+		t.Errorf("downloaded %q: %v", path, entries)
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = io.WriteString(w, `{"message": "Throttle limit reached. Retry later."}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"data": []}`)
+	})
+	start := time.Now()
+	found, err := c.Search(context.Background(), Query{Query: "movie"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 || requests.Load() != 2 {
+		t.Errorf("found %d subtitles in %d requests", len(found), requests.Load())
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, before the Retry-After", elapsed)
+	}
+}
+
+func TestRetryRateLimitedGivesUp(t *testing.T) {
+	var requests atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	// The wait is cut short by the context
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	if _, err := c.Search(ctx, Query{Query: "movie"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the deadline of the context", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+}
+
+func TestHash(t *testing.T) {
+	// The size, plus the 64 bit words of the first and last 64 KiB
+	data := make([]byte, 3*hashChunkSize)
+	data[0] = 1                                // first chunk
+	data[len(data)-8] = 2                      // last chunk
+	data[hashChunkSize+hashChunkSize/2] = 0xff // neither
+	hash, err := Hash(strings.NewReader(string(data)), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "0000000000030003"; hash != want {
+		t.Errorf("hash = %s, want %s", hash, want)
+	}
+	if _, err := Hash(strings.NewReader("small"), 5); err == nil {
+		t.Error("small file hashed")
+	}
+}
@@ -1,7 +1,11 @@
 package torgo
 
 import (
+	"errors"
+	"fmt"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/briandowns/spinner"
@@ -47,6 +51,32 @@ const (
 	SortBySize     SortBy = "size"
 )
 
+// ErrInvalidCategory and ErrInvalidSortBy are returned for a category or a sort which does not exist.
+var (
+	ErrInvalidCategory = errors.New("invalid category")
+	ErrInvalidSortBy   = errors.New("invalid sort")
+)
+
+// ParseCategory returns the category named {name}, in any case.
+func ParseCategory(name string) (Category, error) {
+	category := Category(strings.ToUpper(name))
+	switch category {
+	case CategoryAll, CategoryMovie, CategoryTV, CategoryAnime, CategoryAudiobook, CategoryPorn, CategoryDocumentaries:
+		return category, nil
+	}
+	return category, fmt.Errorf("%w %q", ErrInvalidCategory, name)
+}
+
+// ParseSortBy returns the sort named {name}, in any case.
+func ParseSortBy(name string) (SortBy, error) {
+	sortBy := SortBy(strings.ToLower(name))
+	switch sortBy {
+	case SortByDefault, SortBySeeders, SortByLeechers, SortBySize:
+		return sortBy, nil
+	}
+	return sortBy, fmt.Errorf("%w %q", ErrInvalidSortBy, name)
+}
+
 // Expose all the providers
 var (
 	SukebeiProvider      = sukebei.New()
@@ -91,20 +121,35 @@ var AllProviders = [...]models.ProviderInterface{
 // ListProviderResults lists all results queried from this specific provider only.
 // It sorts the results and returns at most {count} results.
 func ListProviderResults(provider models.ProviderInterface, query string, count int, category Category, sortBy SortBy) []models.Source {
-	var sources []models.Source
 	categories := provider.GetCategories()
-	caturl := GetCategoryURL(category, categories)
+	caturl, err := LookupCategoryURL(category, categories)
+	if err != nil {
+		logrus.Errorln(err)
+		return nil
+	}
 	if caturl == "" {
 		logrus.Warningf("'%v' provider does not support category '%v', getting default category (ALL)...", provider.GetName(), category)
 	}
 	sources, err := provider.Search(query, count, caturl)
 	if err != nil {
-		logrus.Fatalln(err)
+		// Failed pages do not spoil the results of the pages that did come back
+		var pageErr *models.PageError
+		if !errors.As(err, &pageErr) {
+			logrus.Errorln(err)
+			return nil
+		}
+		for _, e := range unwrapJoined(err) {
+			logrus.Errorln(e)
+		}
 	}
 	if len(sources) == 0 {
 		logrus.Warningf("No torrents found via '%v'\n", provider.GetName())
 	}
-	results := GetSortedResults(sources, sortBy)
+	results, err := SortResults(sources, sortBy)
+	if err != nil {
+		logrus.Errorln(err)
+		return nil
+	}
 	if count > len(results) {
 		count = len(results)
 	}
@@ -115,21 +160,7 @@ func ListProviderResults(provider models.ProviderInterface, query string, count
 // It sorts the results after collected all the sorted results from different providers.
 // Returns at most {count} results.
 func ListResults(providers []interface{}, query string, count int, category Category, sortBy SortBy) []models.Source {
-	var argProviders []models.ProviderInterface
-	for _, p := range providers {
-		switch p.(type) {
-		case string:
-			for _, p2 := range AllProviders {
-				if p2.GetName() == p.(string) {
-					argProviders = append(argProviders, p2)
-				}
-			}
-		case models.ProviderInterface:
-			argProviders = append(argProviders, p.(models.ProviderInterface))
-		default:
-			logrus.Fatalln("Invalid interface type in 'providers': only 'string' and 'models.ProviderInterface' are accepted")
-		}
-	}
+	argProviders := getProviders(providers)
 
 	// Init spinner
 	var s *spinner.Spinner
@@ -160,15 +191,91 @@ func ListResults(providers []interface{}, query string, count int, category Cate
 	}
 	logrus.Infof("Returning %d results in total...\n", len(results))
 
-	results = GetSortedResults(results, sortBy)
+	results, err := SortResults(results, sortBy)
+	if err != nil {
+		logrus.Errorln(err)
+		return nil
+	}
 	if count > len(results) {
 		count = len(results)
 	}
 	return results[:count]
 }
 
-// GetCategoryURL returns CategoryURL according to the category name (constant).
+// StreamResults queries all the specified providers concurrently and hands the sorted results of every provider
+// to {onResults} as soon as that provider is done. {onResults} is never called concurrently.
+// At most {count} results are handed over in total: every provider gets an equal share of them,
+// and the share a provider leaves unused goes to the providers still running.
+func StreamResults(providers []interface{}, query string, count int, category Category, sortBy SortBy, onResults func([]models.Source)) {
+	argProviders := getProviders(providers)
+	if count > 500 {
+		logrus.Warningln("'count' should not be larger than 500, set to 500 automatically")
+		count = 500
+	}
+	if len(argProviders) == 0 {
+		return
+	}
+
+	mu := sync.Mutex{}
+	unused := 0 // of the shares of the providers done
+	wg := sync.WaitGroup{}
+	for i, provider := range argProviders {
+		share := count / len(argProviders)
+		if i < count%len(argProviders) {
+			share++
+		}
+		wg.Add(1)
+		go func(provider models.ProviderInterface, share int) {
+			defer wg.Done()
+			sources := ListProviderResults(provider, query, count, category, sortBy)
+
+			mu.Lock()
+			defer mu.Unlock()
+			allowed := share + unused
+			if len(sources) > allowed {
+				sources = sources[:allowed]
+			}
+			unused = allowed - len(sources)
+			if len(sources) > 0 {
+				onResults(sources)
+			}
+		}(provider, share)
+	}
+	wg.Wait()
+}
+
+// getProviders converts provider names and interfaces to a slice of providers.
+func getProviders(providers []interface{}) []models.ProviderInterface {
+	var argProviders []models.ProviderInterface
+	for _, p := range providers {
+		switch p.(type) {
+		case string:
+			for _, p2 := range AllProviders {
+				if p2.GetName() == p.(string) {
+					argProviders = append(argProviders, p2)
+				}
+			}
+		case models.ProviderInterface:
+			argProviders = append(argProviders, p.(models.ProviderInterface))
+		default:
+			logrus.Fatalln("Invalid interface type in 'providers': only 'string' and 'models.ProviderInterface' are accepted")
+		}
+	}
+	return argProviders
+}
+
+// GetCategoryURL returns CategoryURL according to the category name (constant), "" when the provider does not support it
+// or when the category does not exist (see `LookupCategoryURL` to tell them apart).
 func GetCategoryURL(category Category, categories models.Categories) models.CategoryURL {
+	caturl, err := LookupCategoryURL(category, categories)
+	if err != nil {
+		logrus.Errorln(err)
+	}
+	return caturl
+}
+
+// LookupCategoryURL is `GetCategoryURL`, returning an `ErrInvalidCategory` when the category does not exist.
+func LookupCategoryURL(category Category, categories models.Categories) (models.CategoryURL, error) {
 	var caturl models.CategoryURL
 	switch category {
 	case CategoryAll:
@@ -186,12 +293,30 @@ func GetCategoryURL(category Category, categories models.Categories) models.Cate
 	case CategoryDocumentaries:
 		caturl = categories.Documentaries
 	default:
-		logrus.Fatalln("Invalid category")
+		return "", fmt.Errorf("%w %q", ErrInvalidCategory, category)
 	}
-	return caturl
+	return caturl, nil
 }
 
+// unwrapJoined splits an error created by `errors.Join` back into its parts.
+func unwrapJoined(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// GetSortedResults sorts the results in place, and returns them. They are left unsorted when the sort does not exist
+// (see `SortResults` to know it).
 func GetSortedResults(results []models.Source, sortBy SortBy) []models.Source {
+	if _, err := SortResults(results, sortBy); err != nil {
+		logrus.Errorln(err)
+	}
+	return results
+}
+
+// SortResults is `GetSortedResults`, returning an `ErrInvalidSortBy` when the sort does not exist.
+func SortResults(results []models.Source, sortBy SortBy) ([]models.Source, error) {
 	// Sort results
 	switch sortBy {
 	case SortByDefault:
@@ -209,7 +334,7 @@ func GetSortedResults(results []models.Source, sortBy SortBy) []models.Source {
 			return results[i].FileSize > results[j].FileSize
 		})
 	default:
-		logrus.Fatalln("Invalid SortBy")
+		return nil, fmt.Errorf("%w %q", ErrInvalidSortBy, sortBy)
 	}
-	return results
+	return results, nil
 }
@@ -0,0 +1,140 @@
+package transcode
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MasterPlaylist is the name of the HLS master playlist of a file, under its transcoding route.
+const MasterPlaylist = "master.m3u8"
+
+// Serve serves the transcodes of {in}, {name} is the path of the request under the transcoding route of the file:
+//
+//	master.m3u8            HLS master playlist of the qualities of the ladder the file is transcoded to
+//	<quality>/index.m3u8   HLS playlist of a quality, e.g. 720p/index.m3u8
+//	<quality>/<n>.ts       HLS segment, transcoded when it is requested if it is not cached
+//	<quality>.mp4          fragmented MP4 stream, from the start or from ?t=<seconds>
+//
+// It replies 501 Not Implemented when ffmpeg is not installed.
+func (t *Transcoder) Serve(w http.ResponseWriter, r *http.Request, in Input, name string) {
+	// Allow the players of web pages and cast receivers
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if err := t.Available(); err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	p := t.probe(in)
+	select {
+	case <-p.done:
+	case <-r.Context().Done():
+		return
+	}
+	if p.err != nil {
+		http.Error(w, p.err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if name == MasterPlaylist {
+		t.serveMaster(w, p)
+		return
+	}
+	if quality, ok := strings.CutSuffix(name, ".mp4"); ok && !strings.Contains(quality, "/") {
+		q, ok := p.quality(quality)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		t.serveMP4(w, r, in, p, q)
+		return
+	}
+	quality, file, _ := strings.Cut(name, "/")
+	q, ok := p.quality(quality)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if file == "index.m3u8" {
+		servePlaylist(w, p)
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(file, ".ts"))
+	if err != nil || !strings.HasSuffix(file, ".ts") || n < 0 || n >= p.segments() {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := t.segment(r.Context(), in, p, q, n)
+	if err != nil {
+		if r.Context().Err() == nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp2t")
+	http.ServeFile(w, r, path)
+}
+
+// serveMaster writes the master playlist, a variant for each quality.
+func (t *Transcoder) serveMaster(w http.ResponseWriter, p *probe) {
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	fmt.Fprintln(w, "#EXTM3U")
+	fmt.Fprintln(w, "#EXT-X-VERSION:3")
+	for _, q := range p.qualities() {
+		bandwidth := q.AudioBitrate * 1000
+		codecs := "mp4a.40.2"
+		resolution := ""
+		if p.height > 0 {
+			bandwidth += q.VideoBitrate * 1000
+			codecs = "avc1.640028," + codecs
+			height := min(q.Height, p.height) &^ 1
+			resolution = fmt.Sprintf(",RESOLUTION=%dx%d", (p.width*height/p.height+1)&^1, height)
+		}
+		fmt.Fprintf(w, "#EXT-X-STREAM-INF:BANDWIDTH=%d%s,CODECS=\"%s\",NAME=\"%s\"\n%s/index.m3u8\n",
+			bandwidth, resolution, codecs, q.Name, q.Name)
+	}
+}
+
+// servePlaylist writes the playlist of a quality: every segment of the file, which are transcoded once requested.
+func servePlaylist(w http.ResponseWriter, p *probe) {
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	fmt.Fprintln(w, "#EXTM3U")
+	fmt.Fprintln(w, "#EXT-X-VERSION:3")
+	fmt.Fprintf(w, "#EXT-X-TARGETDURATION:%d\n", SegmentDuration)
+	fmt.Fprintln(w, "#EXT-X-MEDIA-SEQUENCE:0")
+	fmt.Fprintln(w, "#EXT-X-PLAYLIST-TYPE:VOD")
+	segments := p.segments()
+	for n := 0; n < segments; n++ {
+		duration := min(float64(SegmentDuration), p.duration-float64(n*SegmentDuration))
+		fmt.Fprintf(w, "#EXTINF:%.3f,\n%d.ts\n", duration, n)
+	}
+	fmt.Fprintln(w, "#EXT-X-ENDLIST")
+}
+
+// serveMP4 streams the file transcoded to a fragmented MP4 from ?t=<seconds>, while the request lasts.
+// The stream is not cached, seeking is requesting it again from another time.
+func (t *Transcoder) serveMP4(w http.ResponseWriter, r *http.Request, in Input, p *probe, q Quality) {
+	start, _ := strconv.ParseFloat(r.URL.Query().Get("t"), 64)
+	if start < 0 || start >= p.duration {
+		start = 0
+	}
+	args := append(t.args(in, p, q, start),
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4", "pipe:1")
+	cmd := exec.CommandContext(r.Context(), t.ffmpeg, args...)
+	cmd.Stdout = w
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Accept-Ranges", "none")
+	logrus.Debugf("Transcoding %s to a %s MP4 from %.0fs", in.ID, q.Name, start)
+	if err := cmd.Run(); err != nil && r.Context().Err() == nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		logrus.Debugln("ffmpeg:", err)
+	}
+}
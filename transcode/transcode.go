@@ -0,0 +1,449 @@
+/*
+Package transcode converts the files streamed to H.264 video and AAC audio with a local ffmpeg,
+for the browsers, TVs and cast devices which cannot play their codecs (e.g. HEVC in MKV, or DTS audio).
+
+A file is served as HLS in a ladder of qualities (see `Ladder`), or as a single fragmented MP4 stream.
+The HLS segments are cached on disk: ffmpeg starts at the segment requested, and is restarted from another one
+when the player seeks away, so that a seek only costs the transcoding of the segments not cached yet.
+ffmpeg reads the file from its raw stream over HTTP, that is through the torrent reader, which lets it seek as well.
+*/
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SegmentDuration is the duration of the HLS segments in seconds, ffmpeg forces a keyframe at the start of each one.
+const SegmentDuration = 6
+
+// Timings of the transcoding
+const (
+	probeTimeout   = 2 * time.Minute // for ffprobe to read the duration of a file
+	segmentTimeout = 2 * time.Minute // for a segment to be transcoded
+	idleTimeout    = time.Minute     // ffmpeg is stopped when no segment was requested for this long
+	segmentPoll    = 200 * time.Millisecond
+	maxAhead       = 3 // segments past the last one transcoded a request waits for, instead of restarting ffmpeg there
+)
+
+// ErrNoFFmpeg is returned when ffmpeg or ffprobe cannot be found.
+var ErrNoFFmpeg = errors.New("ffmpeg not found")
+
+// Quality is a rung of the quality ladder.
+type Quality struct {
+	Name         string // in the paths of the transcodes, e.g. 720p
+	Height       int    // of the video, the width keeps the aspect ratio
+	VideoBitrate int    // kbit/s
+	AudioBitrate int    // kbit/s
+}
+
+// Ladder is the qualities a file is transcoded to, the ones higher than the file are left out but the lowest.
+var Ladder = []Quality{
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 160},
+	{Name: "480p", Height: 480, VideoBitrate: 1200, AudioBitrate: 128},
+}
+
+// Input is a file to transcode.
+type Input struct {
+	ID  string // unique path of the file, e.g. <info hash>/<index>: its segments are cached under it
+	URL string // raw stream of the file, ffmpeg seeks in it with range requests
+}
+
+// Transcoder runs ffmpeg for the files, and caches their segments in a directory.
+type Transcoder struct {
+	ffmpeg  string
+	ffprobe string
+	dir     string
+	mu      sync.Mutex
+	// every field below is guarded by mu
+	probes map[string]*probe // by input ID
+	jobs   map[string]*job   // by input ID and quality, see `jobKey`
+}
+
+// New returns a transcoder running {ffmpeg} (from the PATH when empty, ffprobe is looked for next to it),
+// which caches the segments in {dir}.
+func New(ffmpeg, dir string) *Transcoder {
+	ffprobe := "ffprobe"
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	} else if d := filepath.Dir(ffmpeg); d != "." {
+		ffprobe = filepath.Join(d, "ffprobe"+filepath.Ext(ffmpeg))
+	}
+	return &Transcoder{
+		ffmpeg:  ffmpeg,
+		ffprobe: ffprobe,
+		dir:     dir,
+		probes:  map[string]*probe{},
+		jobs:    map[string]*job{},
+	}
+}
+
+// FFprobe returns the command running ffprobe: next to ffmpeg when its path is given, else from the PATH.
+func (t *Transcoder) FFprobe() string {
+	return t.ffprobe
+}
+
+// Available returns ErrNoFFmpeg if ffmpeg or ffprobe cannot be run.
+func (t *Transcoder) Available() error {
+	for _, name := range []string{t.ffmpeg, t.ffprobe} {
+		if _, err := exec.LookPath(name); err != nil {
+			return fmt.Errorf("%w: %v", ErrNoFFmpeg, err)
+		}
+	}
+	return nil
+}
+
+// probe is what ffprobe tells about a file.
+type probe struct {
+	done          chan struct{} // closed once the fields below are set
+	duration      float64       // seconds
+	width, height int           // of the video, 0 for an audio file
+	err           error
+}
+
+// segments returns the number of HLS segments of the file.
+func (p *probe) segments() int {
+	return int((p.duration + SegmentDuration - 0.001) / SegmentDuration)
+}
+
+// qualities returns the qualities of the ladder the file is transcoded to.
+func (p *probe) qualities() []Quality {
+	var qualities []Quality
+	for _, q := range Ladder {
+		if q.Height <= p.height {
+			qualities = append(qualities, q)
+		}
+	}
+	if len(qualities) == 0 {
+		qualities = Ladder[len(Ladder)-1:]
+	}
+	return qualities
+}
+
+// quality returns the quality named {name} the file is transcoded to.
+func (p *probe) quality(name string) (Quality, bool) {
+	for _, q := range p.qualities() {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return Quality{}, false
+}
+
+// probe returns the probe of the file, started by the first request. A failed probe is run again by the next one.
+func (t *Transcoder) probe(in Input) *probe {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.probes[in.ID]; ok {
+		return p
+	}
+	p := &probe{done: make(chan struct{})}
+	t.probes[in.ID] = p
+	go func() {
+		p.duration, p.width, p.height, p.err = t.runProbe(in.URL)
+		if p.err != nil {
+			logrus.Debugln(p.err)
+			t.mu.Lock()
+			delete(t.probes, in.ID)
+			t.mu.Unlock()
+		}
+		close(p.done)
+	}()
+	return p
+}
+
+// runProbe reads the duration and the size of the video of the file at {url} with ffprobe.
+func (t *Transcoder) runProbe(url string) (duration float64, width, height int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, t.ffprobe, "-v", "error", "-show_entries", "format=duration:stream=codec_type,width,height",
+		"-of", "json", url).Output()
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	var info struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return 0, 0, 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	duration, err = strconv.ParseFloat(info.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		return 0, 0, 0, fmt.Errorf("ffprobe: no duration for %s", url)
+	}
+	for _, stream := range info.Streams {
+		if stream.CodecType == "video" && stream.Height > 0 {
+			return duration, stream.Width, stream.Height, nil
+		}
+	}
+	return duration, 0, 0, nil
+}
+
+// Codecs are the format and the codecs of a file, as named by ffprobe (e.g. "matroska,webm", "hevc" and "dts").
+type Codecs struct {
+	Format string
+	Video  string // "" for an audio file
+	Audio  string
+}
+
+// Codecs returns the format of the file at {url}, and the codecs of its first video and audio streams,
+// to tell whether a device can play it or needs it transcoded.
+func (t *Transcoder) Codecs(url string) (Codecs, error) {
+	if err := t.Available(); err != nil {
+		return Codecs{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, t.ffprobe, "-v", "error", "-show_entries", "format=format_name:stream=codec_type,codec_name",
+		"-of", "json", url).Output()
+	if err != nil {
+		return Codecs{}, fmt.Errorf("ffprobe: %w", err)
+	}
+	var info struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return Codecs{}, fmt.Errorf("ffprobe: %w", err)
+	}
+	codecs := Codecs{Format: info.Format.FormatName}
+	for _, stream := range info.Streams {
+		switch {
+		case stream.CodecType == "video" && codecs.Video == "" && stream.CodecName != "mjpeg" && stream.CodecName != "png":
+			// Cover arts are video streams too
+			codecs.Video = stream.CodecName
+		case stream.CodecType == "audio" && codecs.Audio == "":
+			codecs.Audio = stream.CodecName
+		}
+	}
+	return codecs, nil
+}
+
+// args returns the arguments of ffmpeg transcoding the file from {start} seconds at the quality {q},
+// the output is left to the caller.
+func (t *Transcoder) args(in Input, p *probe, q Quality, start float64) []string {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin"}
+	if start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(start, 'f', 3, 64))
+	}
+	args = append(args, "-i", in.URL)
+	if p.height > 0 {
+		args = append(args, "-map", "0:v:0",
+			"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "high", "-pix_fmt", "yuv420p",
+			"-vf", fmt.Sprintf("scale=-2:%d", min(q.Height, p.height)&^1),
+			"-b:v", fmt.Sprintf("%dk", q.VideoBitrate),
+			"-maxrate", fmt.Sprintf("%dk", q.VideoBitrate*3/2),
+			"-bufsize", fmt.Sprintf("%dk", q.VideoBitrate*2),
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", SegmentDuration))
+	}
+	return append(args, "-map", "0:a:0?", "-c:a", "aac", "-ac", "2", "-b:a", fmt.Sprintf("%dk", q.AudioBitrate), "-sn")
+}
+
+// job is ffmpeg transcoding a file to the HLS segments of a quality, from a segment on.
+type job struct {
+	dir    string // of the segments
+	start  int    // first segment transcoded
+	cancel context.CancelFunc
+	done   chan struct{} // closed once ffmpeg exited
+	err    error         // why ffmpeg failed, set before done is closed
+	used   atomic.Int64  // when a segment was last requested, in unix nanoseconds
+}
+
+func (j *job) touch() {
+	j.used.Store(time.Now().UnixNano())
+}
+
+// stop stops ffmpeg and waits for it to exit.
+func (j *job) stop() {
+	j.cancel()
+	<-j.done
+}
+
+// running reports whether ffmpeg still runs.
+func (j *job) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// produced returns the segment after the ones transcoded by the job.
+func (j *job) produced() int {
+	n := j.start
+	for exists(segmentFile(j.dir, n)) {
+		n++
+	}
+	return n
+}
+
+// stopIdle stops ffmpeg once no segment was requested for the idle timeout.
+func (j *job) stopIdle() {
+	ticker := time.NewTicker(idleTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.done:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, j.used.Load())) >= idleTimeout {
+				j.cancel()
+			}
+		}
+	}
+}
+
+func jobKey(in Input, q Quality) string {
+	return in.ID + "/" + q.Name
+}
+
+func segmentFile(dir string, n int) string {
+	return filepath.Join(dir, strconv.Itoa(n)+".ts")
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// segment returns the path of the HLS segment {n} of the file at the quality {q}, once it is transcoded.
+// ffmpeg is started at the segment, unless it is transcoding the segments before it.
+func (t *Transcoder) segment(ctx context.Context, in Input, p *probe, q Quality, n int) (string, error) {
+	dir := filepath.Join(t.dir, filepath.FromSlash(in.ID), q.Name)
+	path := segmentFile(dir, n)
+	if exists(path) {
+		return path, nil
+	}
+	j, err := t.job(in, p, q, n, dir)
+	if err != nil {
+		return "", err
+	}
+	ticker := time.NewTicker(segmentPoll)
+	defer ticker.Stop()
+	timeout := time.NewTimer(segmentTimeout)
+	defer timeout.Stop()
+	for {
+		j.touch()
+		if exists(path) {
+			return path, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-j.done:
+			if exists(path) {
+				return path, nil
+			}
+			if j.err != nil {
+				return "", j.err
+			}
+			return "", fmt.Errorf("segment %d of %s was not transcoded", n, in.ID)
+		case <-timeout.C:
+			return "", fmt.Errorf("timed out transcoding segment %d of %s", n, in.ID)
+		case <-ticker.C:
+		}
+	}
+}
+
+// job returns the ffmpeg transcoding the segment {n} soon, or starts one at the segment instead of the one running.
+func (t *Transcoder) job(in Input, p *probe, q Quality, n int, dir string) (*job, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := jobKey(in, q)
+	if j := t.jobs[key]; j != nil && j.running() {
+		if n >= j.start && n <= j.produced()+maxAhead {
+			return j, nil
+		}
+		j.stop()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	start := float64(n * SegmentDuration)
+	args := t.args(in, p, q, start)
+	args = append(args,
+		"-output_ts_offset", strconv.Itoa(n*SegmentDuration),
+		"-f", "hls", "-hls_time", strconv.Itoa(SegmentDuration), "-hls_list_size", "0",
+		"-hls_segment_type", "mpegts", "-hls_flags", "temp_file", "-start_number", strconv.Itoa(n),
+		"-hls_segment_filename", filepath.Join(dir, "%d.ts"), filepath.Join(dir, "ffmpeg.m3u8"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, t.ffmpeg, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+	logrus.Debugf("Transcoding %s to %s from segment %d", in.ID, q.Name, n)
+
+	j := &job{dir: dir, start: n, cancel: cancel, done: make(chan struct{})}
+	j.touch()
+	go func() {
+		err := cmd.Wait()
+		if err != nil && ctx.Err() == nil {
+			j.err = fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+			logrus.Debugln(j.err)
+		}
+		cancel()
+		close(j.done)
+	}()
+	go j.stopIdle()
+	t.jobs[key] = j
+	return j, nil
+}
+
+// Remove stops transcoding the files whose ID starts with {prefix} (e.g. an info hash), and deletes their segments.
+func (t *Transcoder) Remove(prefix string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, j := range t.jobs {
+		if strings.HasPrefix(key, prefix+"/") {
+			j.stop()
+			delete(t.jobs, key)
+		}
+	}
+	for id := range t.probes {
+		if id == prefix || strings.HasPrefix(id, prefix+"/") {
+			delete(t.probes, id)
+		}
+	}
+	return os.RemoveAll(filepath.Join(t.dir, filepath.FromSlash(prefix)))
+}
+
+// Close stops every ffmpeg. The segments are kept.
+func (t *Transcoder) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, j := range t.jobs {
+		j.stop()
+		delete(t.jobs, key)
+	}
+}
@@ -0,0 +1,143 @@
+package tui
+
+import (
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyEnter
+	keyEsc
+	keyBackspace
+	keyTab
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyCtrlC
+	keyCtrlU
+)
+
+// key is a single key press read from the terminal, r is only set for keyRune.
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// parseKeys splits the bytes of a read from a raw terminal into key presses.
+// Escape sequences that are not known are dropped.
+func parseKeys(b []byte) []key {
+	var keys []key
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == 0x1b:
+			if i+1 >= len(b) || (b[i+1] != '[' && b[i+1] != 'O') {
+				// A lone escape (or alt+key, which is handled as escape too)
+				keys = append(keys, key{code: keyEsc})
+				i++
+				if i < len(b) && b[i] != 0x1b {
+					i++
+				}
+				continue
+			}
+			// CSI / SS3 sequence: parameters, then a final byte in 0x40-0x7e
+			j := i + 2
+			for j < len(b) && (b[j] < 0x40 || b[j] > 0x7e) {
+				j++
+			}
+			if j >= len(b) {
+				return keys
+			}
+			params := string(b[i+2 : j])
+			switch b[j] {
+			case 'A':
+				keys = append(keys, key{code: keyUp})
+			case 'B':
+				keys = append(keys, key{code: keyDown})
+			case 'H':
+				keys = append(keys, key{code: keyHome})
+			case 'F':
+				keys = append(keys, key{code: keyEnd})
+			case '~':
+				switch params {
+				case "1", "7":
+					keys = append(keys, key{code: keyHome})
+				case "4", "8":
+					keys = append(keys, key{code: keyEnd})
+				case "5":
+					keys = append(keys, key{code: keyPageUp})
+				case "6":
+					keys = append(keys, key{code: keyPageDown})
+				}
+			}
+			i = j + 1
+			continue
+		case c == '\r' || c == '\n':
+			keys = append(keys, key{code: keyEnter})
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, key{code: keyBackspace})
+		case c == '\t':
+			keys = append(keys, key{code: keyTab})
+		case c == 0x03:
+			keys = append(keys, key{code: keyCtrlC})
+		case c == 0x15:
+			keys = append(keys, key{code: keyCtrlU})
+		case c < 0x20:
+			// other control characters are ignored
+		default:
+			r, size := utf8.DecodeRune(b[i:])
+			keys = append(keys, key{code: keyRune, r: r})
+			i += size
+			continue
+		}
+		i++
+	}
+	return keys
+}
+
+// terminal is the full-screen terminal the browser draws on.
+type terminal struct {
+	in, out *os.File
+	state   *term.State
+}
+
+// Available reports whether the standard input and output are both terminals, which the browser needs.
+func Available() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// open switches the terminal to raw mode and to the alternate screen, with the cursor hidden.
+func open() (*terminal, error) {
+	t := &terminal{in: os.Stdin, out: os.Stdout}
+	enableVirtualTerminal(t.out)
+	state, err := term.MakeRaw(int(t.in.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	t.state = state
+	_, _ = t.out.WriteString("\x1b[?1049h\x1b[?25l")
+	return t, nil
+}
+
+// close restores the terminal as it was before `open`.
+func (t *terminal) close() {
+	_, _ = t.out.WriteString("\x1b[?25h\x1b[?1049l")
+	_ = term.Restore(int(t.in.Fd()), t.state)
+}
+
+// size returns the width and height of the terminal, with a sane fallback.
+func (t *terminal) size() (int, int) {
+	width, height, err := term.GetSize(int(t.out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package tui
+
+import "os"
+
+// enableVirtualTerminal is a no-op: every other terminal understands ANSI escape sequences.
+func enableVirtualTerminal(*os.File) {}
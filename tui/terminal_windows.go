@@ -0,0 +1,19 @@
+//go:build windows
+
+package tui
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualTerminal turns on the processing of ANSI escape sequences, which older consoles leave off.
+func enableVirtualTerminal(out *os.File) {
+	var mode uint32
+	handle := windows.Handle(out.Fd())
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return
+	}
+	_ = windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+}
@@ -0,0 +1,388 @@
+/*
+Package tui is a full-screen terminal browser for search results.
+Results are shown as they come in from the providers, and can be sorted, filtered, scrolled
+and inspected in a detail pane before one or several of them are picked.
+*/
+package tui
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stl3/torgo"
+	"github.com/stl3/torgo/models"
+)
+
+// ErrAborted is returned by `Browse` when the browser is left without picking a result.
+var ErrAborted = errors.New("aborted")
+
+type sortKey int
+
+const (
+	sortArrival sortKey = iota // the order the providers returned the results in
+	sortSeeders
+	sortLeechers
+	sortSize
+	sortTitle
+	sortProvider
+	sortKeys // number of sort keys
+)
+
+func (k sortKey) String() string {
+	return [...]string{"arrival", "seeders", "leechers", "size", "title", "provider"}[k]
+}
+
+// browser is the state of a `Browse` session. Every field is guarded by mu.
+type browser struct {
+	mu       sync.Mutex
+	term     *terminal
+	title    string
+	all      []models.Source // every result, in arrival order
+	view     []int           // indexes in all of the rows shown, filtered and sorted
+	selected map[int]bool    // indexes in all of the selected results
+	cursor   int             // position of the cursor in view
+	offset   int             // position in view of the first row shown
+	sortBy   sortKey
+	reverse  bool
+	filter   string
+	editing  bool // the filter is being typed
+	details  bool // the detail pane is shown
+	done     bool // every provider answered
+	closed   bool // the browser was left, nothing must be drawn anymore
+	width    int
+	height   int
+	frame    int // spinner frame
+}
+
+// Browse shows the results received on {results} in a full-screen browser until the user picks some of them.
+// The results are shown as soon as they are received; {results} should be closed once every provider answered.
+// Enter picks the selected results (space to select), or the one under the cursor if none is selected.
+// It returns `ErrAborted` if the user leaves without picking anything.
+func Browse(title string, results <-chan []models.Source, sortBy torgo.SortBy) ([]models.Source, error) {
+	t, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer t.close()
+
+	b := &browser{term: t, title: title, selected: map[int]bool{}, sortBy: sortSeeders}
+	switch sortBy {
+	case torgo.SortByDefault:
+		b.sortBy = sortArrival
+	case torgo.SortByLeechers:
+		b.sortBy = sortLeechers
+	case torgo.SortBySize:
+		b.sortBy = sortSize
+	}
+	b.width, b.height = t.size()
+
+	b.mu.Lock()
+	b.draw()
+	b.mu.Unlock()
+
+	// Rows are added as they come in; the channel is always drained so the providers never block
+	go func() {
+		for batch := range results {
+			b.mu.Lock()
+			if !b.closed {
+				b.all = append(b.all, batch...)
+				b.refresh()
+				b.draw()
+			}
+			b.mu.Unlock()
+		}
+		b.mu.Lock()
+		b.done = true
+		if !b.closed {
+			b.draw()
+		}
+		b.mu.Unlock()
+	}()
+
+	// Redraw on resize, and animate the spinner while searching
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(150 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				b.mu.Lock()
+				width, height := t.size()
+				if !b.closed && (width != b.width || height != b.height || !b.done) {
+					b.width, b.height = width, height
+					b.frame++
+					b.draw()
+				}
+				b.mu.Unlock()
+			}
+		}
+	}()
+
+	// Keys are read here rather than in a goroutine, so that no read is left pending on stdin once we return
+	buf := make([]byte, 256)
+	for {
+		n, err := t.in.Read(buf)
+		if err != nil {
+			b.leave()
+			return nil, err
+		}
+		b.mu.Lock()
+		for _, k := range parseKeys(buf[:n]) {
+			picked, quit := b.handle(k)
+			if quit {
+				b.closed = true
+				b.mu.Unlock()
+				return nil, ErrAborted
+			}
+			if picked != nil {
+				b.closed = true
+				b.mu.Unlock()
+				return picked, nil
+			}
+		}
+		b.draw()
+		b.mu.Unlock()
+	}
+}
+
+func (b *browser) leave() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+}
+
+// handle applies a key press. It returns the picked results, or quit if the browser must be left.
+func (b *browser) handle(k key) (picked []models.Source, quit bool) {
+	if k.code == keyCtrlC {
+		return nil, true
+	}
+	if b.editing {
+		switch k.code {
+		case keyEnter:
+			b.editing = false
+		case keyEsc:
+			b.editing = false
+			b.filter = ""
+		case keyBackspace:
+			if r := []rune(b.filter); len(r) > 0 {
+				b.filter = string(r[:len(r)-1])
+			}
+		case keyCtrlU:
+			b.filter = ""
+		case keyRune:
+			b.filter += string(k.r)
+		case keyUp, keyDown, keyPageUp, keyPageDown, keyHome, keyEnd:
+			b.move(k)
+			return nil, false
+		}
+		b.refresh()
+		return nil, false
+	}
+
+	switch k.code {
+	case keyEsc:
+		if b.filter != "" {
+			b.filter = ""
+			b.refresh()
+			return nil, false
+		}
+		return nil, true
+	case keyEnter:
+		return b.picked(), false
+	case keyTab:
+		b.details = !b.details
+	case keyCtrlU:
+		b.filter = ""
+		b.refresh()
+	case keyRune:
+		switch k.r {
+		case 'q':
+			return nil, true
+		case 'j':
+			b.move(key{code: keyDown})
+		case 'k':
+			b.move(key{code: keyUp})
+		case 'g':
+			b.move(key{code: keyHome})
+		case 'G':
+			b.move(key{code: keyEnd})
+		case ' ':
+			if len(b.view) > 0 {
+				i := b.view[b.cursor]
+				if b.selected[i] {
+					delete(b.selected, i)
+				} else {
+					b.selected[i] = true
+				}
+				b.move(key{code: keyDown})
+			}
+		case 'a':
+			// Select every row shown, or clear the selection if they already all are
+			all := true
+			for _, i := range b.view {
+				all = all && b.selected[i]
+			}
+			for _, i := range b.view {
+				if all {
+					delete(b.selected, i)
+				} else {
+					b.selected[i] = true
+				}
+			}
+		case 'd':
+			b.details = !b.details
+		case 's':
+			b.sortBy = (b.sortBy + 1) % sortKeys
+			b.refresh()
+		case 'r':
+			b.reverse = !b.reverse
+			b.refresh()
+		case '/':
+			b.editing = true
+		}
+	default:
+		b.move(k)
+	}
+	return nil, false
+}
+
+// picked returns the selected results in the order they are shown, or the one under the cursor.
+func (b *browser) picked() []models.Source {
+	if len(b.view) == 0 {
+		return nil
+	}
+	var picked []models.Source
+	for _, i := range b.view {
+		if b.selected[i] {
+			picked = append(picked, b.all[i])
+		}
+	}
+	// Selected results hidden by the filter are still picked
+	for i := range b.all {
+		if b.selected[i] && !b.shown(i) {
+			picked = append(picked, b.all[i])
+		}
+	}
+	if len(picked) == 0 {
+		picked = append(picked, b.all[b.view[b.cursor]])
+	}
+	return picked
+}
+
+func (b *browser) shown(i int) bool {
+	for _, j := range b.view {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+// move moves the cursor and scrolls the list so that it stays visible.
+func (b *browser) move(k key) {
+	page := b.listHeight()
+	switch k.code {
+	case keyUp:
+		b.cursor--
+	case keyDown:
+		b.cursor++
+	case keyPageUp:
+		b.cursor -= page
+	case keyPageDown:
+		b.cursor += page
+	case keyHome:
+		b.cursor = 0
+	case keyEnd:
+		b.cursor = len(b.view) - 1
+	}
+	b.clamp()
+}
+
+func (b *browser) clamp() {
+	if b.cursor >= len(b.view) {
+		b.cursor = len(b.view) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	page := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	} else if page > 0 && b.cursor >= b.offset+page {
+		b.offset = b.cursor - page + 1
+	}
+	if b.offset < 0 {
+		b.offset = 0
+	}
+}
+
+// refresh rebuilds the rows shown from the filter and the sort, keeping the cursor on the same result.
+func (b *browser) refresh() {
+	current := -1
+	if b.cursor < len(b.view) {
+		current = b.view[b.cursor]
+	}
+
+	terms := strings.Fields(strings.ToLower(b.filter))
+	b.view = b.view[:0]
+	for i, source := range b.all {
+		if matches(source, terms) {
+			b.view = append(b.view, i)
+		}
+	}
+
+	less := func(x, y int) bool {
+		a, c := b.all[x], b.all[y]
+		switch b.sortBy {
+		case sortSeeders:
+			return a.Seeders > c.Seeders
+		case sortLeechers:
+			return a.Leechers > c.Leechers
+		case sortSize:
+			return a.FileSize > c.FileSize
+		case sortTitle:
+			return strings.ToLower(a.Title) < strings.ToLower(c.Title)
+		case sortProvider:
+			return a.From < c.From
+		}
+		return x < y
+	}
+	sort.SliceStable(b.view, func(i, j int) bool {
+		if b.reverse {
+			return less(b.view[j], b.view[i])
+		}
+		return less(b.view[i], b.view[j])
+	})
+
+	b.cursor = 0
+	for pos, i := range b.view {
+		if i == current {
+			b.cursor = pos
+			break
+		}
+	}
+	b.clamp()
+}
+
+// matches reports whether every term of the filter is in the title or the provider of the source.
+// Terms starting with `-` must not be.
+func matches(source models.Source, terms []string) bool {
+	text := strings.ToLower(source.Title + " " + source.From)
+	for _, term := range terms {
+		if strings.HasPrefix(term, "-") && len(term) > 1 {
+			if strings.Contains(text, term[1:]) {
+				return false
+			}
+		} else if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
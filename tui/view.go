@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	detailHeight = 7 // lines of the detail pane, separator included
+	chromeHeight = 3 // header, column names and footer
+
+	reset   = "\x1b[0m"
+	bold    = "\x1b[1m"
+	inverse = "\x1b[7m"
+	grey    = "\x1b[90m"
+	red     = "\x1b[91m"
+	green   = "\x1b[92m"
+	yellow  = "\x1b[93m"
+	blue    = "\x1b[94m"
+	cyan    = "\x1b[96m"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Widths of the fixed columns of the list
+const (
+	markWidth     = 1
+	indexWidth    = 4
+	providerWidth = 13
+	peersWidth    = 6
+	sizeWidth     = 9
+)
+
+// listHeight returns the number of rows of results that fit on the screen.
+func (b *browser) listHeight() int {
+	height := b.height - chromeHeight
+	if b.details {
+		height -= detailHeight
+	}
+	if height < 1 {
+		height = 1
+	}
+	return height
+}
+
+// draw renders the whole screen in a single write.
+func (b *browser) draw() {
+	if b.closed {
+		return
+	}
+	var lines []string
+	lines = append(lines, b.header())
+	lines = append(lines, bold+fit(b.row("", "#", "Provider", "S", "L", "Size", "Title"), b.width)+reset)
+
+	page := b.listHeight()
+	for pos := b.offset; pos < b.offset+page; pos++ {
+		if pos >= len(b.view) {
+			lines = append(lines, "")
+			continue
+		}
+		lines = append(lines, b.line(pos))
+	}
+	if b.details {
+		lines = append(lines, b.detail()...)
+	}
+	lines = append(lines, b.footer())
+
+	var screen strings.Builder
+	screen.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			screen.WriteString("\r\n")
+		}
+		screen.WriteString(line)
+		screen.WriteString(reset + "\x1b[K")
+	}
+	screen.WriteString("\x1b[J")
+	_, _ = b.term.out.WriteString(screen.String())
+}
+
+func (b *browser) header() string {
+	status := green + "done" + reset
+	if !b.done {
+		status = yellow + spinnerFrames[b.frame%len(spinnerFrames)] + " searching..." + reset
+	}
+	order := "↓"
+	if b.reverse {
+		order = "↑"
+	}
+	info := fmt.Sprintf(" %d/%d results, sort: %s %s", len(b.view), len(b.all), b.sortBy, order)
+	if len(b.selected) > 0 {
+		info += fmt.Sprintf(", %d selected", len(b.selected))
+	}
+	title := fit(" "+b.title, b.width-runewidth.StringWidth(info)-16)
+	return bold + blue + title + reset + info + "  " + status
+}
+
+// titleWidth returns the width left to the title column.
+func (b *browser) titleWidth() int {
+	width := b.width - markWidth - indexWidth - providerWidth - 2*peersWidth - sizeWidth - 6
+	if width < 10 {
+		width = 10
+	}
+	return width
+}
+
+// row lays out the columns of a line of the list, without colors.
+func (b *browser) row(mark, index, provider, seeders, leechers, size, title string) string {
+	return strings.Join([]string{
+		fit(mark, markWidth),
+		runewidth.FillLeft(fit(index, indexWidth), indexWidth),
+		fit(provider, providerWidth),
+		runewidth.FillLeft(seeders, peersWidth),
+		runewidth.FillLeft(leechers, peersWidth),
+		runewidth.FillLeft(size, sizeWidth),
+		fit(title, b.titleWidth()),
+	}, " ")
+}
+
+// line renders the result at position {pos} of the view.
+func (b *browser) line(pos int) string {
+	i := b.view[pos]
+	source := b.all[i]
+	mark := ""
+	if b.selected[i] {
+		mark = "●"
+	}
+	cells := []string{
+		fit(mark, markWidth),
+		runewidth.FillLeft(fmt.Sprint(pos+1), indexWidth),
+		fit(source.From, providerWidth),
+		runewidth.FillLeft(fmt.Sprint(source.Seeders), peersWidth),
+		runewidth.FillLeft(fmt.Sprint(source.Leechers), peersWidth),
+		runewidth.FillLeft(humanize.Bytes(uint64(source.FileSize)), sizeWidth),
+	}
+	plain := b.row(cells[0], cells[1], cells[2], cells[3], cells[4], cells[5], clean(source.Title))
+	if pos == b.cursor {
+		return inverse + fit(plain, b.width)
+	}
+	// Same layout, colored cell by cell
+	return yellow + cells[0] + reset + " " +
+		grey + cells[1] + reset + " " +
+		yellow + cells[2] + reset + " " +
+		green + cells[3] + reset + " " +
+		red + cells[4] + reset + " " +
+		cyan + cells[5] + reset + " " +
+		fit(clean(source.Title), b.titleWidth())
+}
+
+// detail renders the pane describing the result under the cursor.
+func (b *browser) detail() []string {
+	lines := []string{grey + strings.Repeat("─", b.width)}
+	if len(b.view) == 0 {
+		for len(lines) < detailHeight {
+			lines = append(lines, "")
+		}
+		return lines
+	}
+	source := b.all[b.view[b.cursor]]
+	label := func(name, value string) string {
+		return bold + blue + name + reset + fit(value, b.width-runewidth.StringWidth(name))
+	}
+
+	title := wrap(clean(source.Title), b.width-7, 2)
+	lines = append(lines, label("Title: ", title[0]))
+	if len(title) > 1 {
+		lines = append(lines, "       "+title[1])
+	} else {
+		lines = append(lines, "")
+	}
+	lines = append(lines, label("From: ", fmt.Sprintf("%s  (%d seeders, %d leechers, %s)",
+		source.From, source.Seeders, source.Leechers, humanize.Bytes(uint64(source.FileSize)))))
+	lines = append(lines, label("URL: ", source.URL))
+	magnet := source.Magnet
+	if magnet == "" && source.Resolver != nil {
+		magnet = "fetched from the detail page once picked"
+	} else if magnet == "" {
+		magnet = "unknown"
+	}
+	lines = append(lines, label("Magnet: ", magnet))
+	if len(source.Files) == 0 {
+		lines = append(lines, label("Files: ", "not listed by "+source.From))
+	} else {
+		var files []string
+		for _, file := range source.Files {
+			if file.Size > 0 {
+				files = append(files, fmt.Sprintf("%s (%s)", file.Name, humanize.Bytes(uint64(file.Size))))
+			} else {
+				files = append(files, file.Name)
+			}
+		}
+		lines = append(lines, label(fmt.Sprintf("Files (%d): ", len(files)), strings.Join(files, ", ")))
+	}
+	return lines
+}
+
+func (b *browser) footer() string {
+	if b.editing {
+		return bold + "/" + reset + b.filter + inverse + " " + reset + grey + "  enter: keep, esc: clear"
+	}
+	help := "↑↓ move  space select  a all  enter pick  / filter  s sort  r reverse  tab details  q quit"
+	if b.filter != "" {
+		return yellow + "filter: " + b.filter + reset + grey + fit("  "+help, b.width-runewidth.StringWidth(b.filter)-8)
+	}
+	return grey + fit(help, b.width)
+}
+
+// fit truncates or pads s to exactly {width} columns.
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.FillRight(runewidth.Truncate(s, width, "…"), width)
+}
+
+// wrap splits s into at most {lines} lines of {width} columns, the last one truncated.
+func wrap(s string, width, lines int) []string {
+	if width <= 0 {
+		return []string{""}
+	}
+	var wrapped []string
+	for len(wrapped) < lines-1 && runewidth.StringWidth(s) > width {
+		head := runewidth.Truncate(s, width, "")
+		wrapped = append(wrapped, head)
+		s = strings.TrimLeft(s[len(head):], " ")
+	}
+	return append(wrapped, runewidth.Truncate(s, width, "…"))
+}
+
+// clean replaces the characters of a scraped title that would break the layout.
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, strings.TrimSpace(s))
+}
@@ -0,0 +1,259 @@
+"use strict";
+
+// State of the page
+const state = {
+	providers: [],   // [{name, categories}]
+	search: 0,       // ID of the last search, to play its results
+	results: [],     // results of the last search
+	sortKey: null,   // column the results are sorted by in the page, null for the order of the server
+	reverse: false,
+	torrent: null,   // info hash of the torrent shown in the player
+	torrents: {},    // info hash -> last status received
+};
+
+const $ = (selector) => document.querySelector(selector);
+
+const categories = ["ALL", "MOVIE", "TV", "ANIME", "AUDIOBOOK", "DOCUMENTARIES", "PORN"];
+const videoExtensions = /\.(mp4|m4v|mkv|webm|avi|mov|mp3|m4a|m4b|flac|ogg|opus|wav)$/i;
+const subtitleExtensions = /\.(srt|vtt)$/i;
+
+function bytes(n) {
+	const units = ["B", "kB", "MB", "GB", "TB"];
+	let i = 0;
+	while (n >= 1000 && i < units.length - 1) {
+		n /= 1000;
+		i++;
+	}
+	return (i ? n.toFixed(1) : n) + " " + units[i];
+}
+
+function element(tag, props = {}, ...children) {
+	const el = document.createElement(tag);
+	Object.assign(el, props);
+	el.append(...children);
+	return el;
+}
+
+async function api(method, path, body) {
+	const options = { method, headers: {} };
+	if (body !== undefined) {
+		options.headers["Content-Type"] = "application/json";
+		options.body = JSON.stringify(body);
+	}
+	const response = await fetch(path, options);
+	const data = await response.json();
+	if (!response.ok) {
+		throw new Error(data.error || response.statusText);
+	}
+	return data;
+}
+
+function setStatus(text) {
+	$("#status").textContent = text;
+}
+
+// Search form
+
+async function loadProviders() {
+	state.providers = await api("GET", "/ui/api/providers");
+	for (const category of categories) {
+		$("#category").append(element("option", { value: category, textContent: category[0] + category.slice(1).toLowerCase() }));
+	}
+	renderProviders();
+}
+
+function renderProviders() {
+	const category = $("#category").value;
+	const box = $("#providers");
+	const checked = new Set([...box.querySelectorAll("input:checked")].map((input) => input.value));
+	box.replaceChildren();
+	for (const provider of state.providers) {
+		const supported = provider.categories.includes(category);
+		const input = element("input", { type: "checkbox", value: provider.name, disabled: !supported });
+		input.checked = supported && (checked.size === 0 || checked.has(provider.name));
+		box.append(element("label", { className: supported ? "" : "unsupported" }, input, " " + provider.name));
+	}
+}
+
+async function search(event) {
+	event.preventDefault();
+	const providers = [...$("#providers").querySelectorAll("input:checked")].map((input) => input.value);
+	const params = new URLSearchParams({
+		q: $("#query").value,
+		category: $("#category").value,
+		sort: $("#sort").value,
+		providers: providers.join(","),
+	});
+	showResults();
+	setStatus("Searching...");
+	$("#results tbody").replaceChildren();
+	try {
+		const data = await api("GET", "/ui/api/search?" + params);
+		state.search = data.id;
+		state.results = (data.results || []).map((result, index) => ({ ...result, index }));
+		setStatus(state.results.length + " results");
+		renderResults();
+	} catch (error) {
+		setStatus(error.message);
+	}
+}
+
+// Results
+
+function matches(result, terms) {
+	const text = (result.title + " " + result.from).toLowerCase();
+	return terms.every((term) => term.startsWith("-") && term.length > 1 ? !text.includes(term.slice(1)) : text.includes(term));
+}
+
+function renderResults() {
+	const terms = $("#filter").value.toLowerCase().split(/\s+/).filter(Boolean);
+	const minSeeders = Number($("#min-seeders").value) || 0;
+	let rows = state.results.filter((result) => result.seeders >= minSeeders && matches(result, terms));
+	if (state.sortKey) {
+		const key = state.sortKey;
+		rows = rows.slice().sort((a, b) => (typeof a[key] === "string" ? a[key].localeCompare(b[key]) : b[key] - a[key]));
+		if (state.reverse) {
+			rows.reverse();
+		}
+	}
+
+	const body = $("#results tbody");
+	body.replaceChildren();
+	for (const result of rows) {
+		const play = element("button", { type: "button", textContent: "Play" });
+		play.addEventListener("click", () => playResult(result, play));
+		body.append(element("tr", {},
+			element("td", { textContent: result.title }),
+			element("td", { textContent: result.from, className: "muted" }),
+			element("td", { textContent: result.seeders, className: "num seeders" }),
+			element("td", { textContent: result.leechers, className: "num leechers" }),
+			element("td", { textContent: bytes(result.size), className: "num" }),
+			element("td", {}, play),
+		));
+	}
+}
+
+function sortBy(key) {
+	state.reverse = state.sortKey === key ? !state.reverse : false;
+	state.sortKey = key;
+	renderResults();
+}
+
+async function playResult(result, button) {
+	button.disabled = true;
+	button.textContent = "...";
+	try {
+		const status = await api("POST", "/ui/api/play", { search: state.search, index: result.index });
+		openTorrent(status.info_hash);
+	} catch (error) {
+		setStatus(error.message);
+	} finally {
+		button.disabled = false;
+		button.textContent = "Play";
+	}
+}
+
+// Player
+
+function showResults() {
+	$("#player-view").hidden = true;
+	$("#results-view").hidden = false;
+	$("#video").pause();
+}
+
+function openTorrent(infoHash) {
+	state.torrent = infoHash;
+	$("#results-view").hidden = true;
+	$("#player-view").hidden = false;
+	$("#video").removeAttribute("src");
+	$("#video").replaceChildren();
+	$("#files").replaceChildren();
+	renderTorrent();
+}
+
+function renderTorrent() {
+	const status = state.torrents[state.torrent];
+	if (!status) {
+		$("#torrent-name").textContent = "Waiting for the torrent...";
+		return;
+	}
+	$("#torrent-name").textContent = status.name || "Fetching the torrent metadata...";
+	$("#torrent-progress").style.width = status.percent + "%";
+	$("#torrent-status").textContent = `${status.state} · ${status.percent.toFixed(1)}% of ${bytes(status.size)} · ${status.peers} peers`;
+
+	// The file list is only built once, so that the buttons do not flicker
+	const list = $("#files");
+	if (list.childElementCount > 0 || status.files.length === 0) {
+		return;
+	}
+	const media = status.files.filter((file) => videoExtensions.test(file.path));
+	for (const file of media.length ? media : status.files) {
+		const button = element("button", { type: "button", textContent: "▶" });
+		button.addEventListener("click", () => playFile(status, file));
+		list.append(element("li", {}, button, file.path + " ", element("span", { className: "muted", textContent: bytes(file.size) })));
+	}
+	if (media.length === 1) {
+		playFile(status, media[0]);
+	}
+}
+
+function playFile(status, file) {
+	const video = $("#video");
+	video.replaceChildren();
+	// Every subtitle file of the torrent is offered, converted to WebVTT by the server
+	let first = true;
+	for (const subtitle of status.files.filter((f) => subtitleExtensions.test(f.path))) {
+		video.append(element("track", {
+			kind: "subtitles",
+			label: subtitle.path.split("/").pop(),
+			src: `/ui/api/subtitles/${status.info_hash}/${subtitle.index}`,
+			default: first,
+		}));
+		first = false;
+	}
+	video.src = file.stream_url;
+	video.play().catch(() => {});
+}
+
+// Torrents
+
+function renderTorrents() {
+	const list = $("#torrents");
+	list.replaceChildren();
+	for (const status of Object.values(state.torrents)) {
+		const open = element("button", { type: "button", textContent: "Open" });
+		open.addEventListener("click", () => openTorrent(status.info_hash));
+		list.append(element("li", {}, open,
+			(status.name || status.info_hash) + " ",
+			element("span", { className: "muted", textContent: `${status.state} ${status.percent.toFixed(1)}% · ${status.peers} peers` })));
+	}
+}
+
+function listen() {
+	const events = new EventSource("/ui/api/events");
+	events.addEventListener("torrents", (event) => {
+		state.torrents = {};
+		for (const status of JSON.parse(event.data)) {
+			state.torrents[status.info_hash] = status;
+		}
+		renderTorrents();
+		if (state.torrent) {
+			renderTorrent();
+		}
+	});
+}
+
+$("#search").addEventListener("submit", search);
+$("#category").addEventListener("change", renderProviders);
+$("#filter").addEventListener("input", renderResults);
+$("#min-seeders").addEventListener("input", renderResults);
+$("#back").addEventListener("click", showResults);
+document.querySelectorAll("#results th").forEach((th, i) => {
+	const key = ["title", "from", "seeders", "leechers", "size"][i];
+	if (key) {
+		th.addEventListener("click", () => sortBy(key));
+	}
+});
+
+loadProviders().catch((error) => setStatus(error.message));
+listen();
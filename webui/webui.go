@@ -0,0 +1,288 @@
+/*
+Package webui is a single-page web interface served by `torgo daemon`, for the devices of the network without a terminal:
+it searches the providers, filters the results, adds the chosen one to the daemon and plays its files in the browser,
+with the subtitles of the torrent converted to WebVTT. The progress of the torrents is pushed with server-sent events.
+*/
+package webui
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/stl3/torgo"
+	"github.com/stl3/torgo/client"
+	"github.com/stl3/torgo/daemon"
+	"github.com/stl3/torgo/models"
+)
+
+//go:embed static
+var static embed.FS
+
+// maxSearches is how many searches are kept to play their results from.
+const maxSearches = 20
+
+// eventInterval is how often the status of the torrents is pushed to the browsers.
+const eventInterval = time.Second
+
+// server is the web UI of a daemon.
+type server struct {
+	d      *daemon.Daemon
+	limit  int // maximum number of results of a search
+	mu     sync.Mutex
+	nextID int
+	// searches keeps the results of the last searches: some magnets are only resolved once a result is played
+	searches map[int][]models.Source
+}
+
+// Handler returns the web UI of the daemon, with the daemon API (see `daemon.Daemon.Handler`) under it:
+//
+//	GET  /                                       the web UI
+//	GET  /ui/api/providers                       providers and the categories they support
+//	GET  /ui/api/search?q=&category=&providers=&sort=  search the providers
+//	POST /ui/api/play                            add a result to the daemon: {"search": id, "index": i} or {"magnet": "..."}
+//	GET  /ui/api/events                          server-sent events with the status of every torrent
+//	GET  /ui/api/subtitles/{hash}/{index}        a subtitle file of a torrent, as WebVTT
+//
+// {limit} is the maximum number of results of a search. The play requests must be sent in JSON, see `daemon.SameOrigin`.
+func Handler(d *daemon.Daemon, limit int) http.Handler {
+	s := &server{d: d, limit: limit, searches: map[int][]models.Source{}}
+	files, _ := fs.Sub(static, "static")
+
+	mux := http.NewServeMux()
+	mux.Handle("/", d.Handler())
+	mux.Handle("GET /{$}", http.FileServer(http.FS(files)))
+	mux.Handle("GET /ui/", http.StripPrefix("/ui/", http.FileServer(http.FS(files))))
+	mux.HandleFunc("GET /ui/api/providers", s.providersHandler)
+	mux.HandleFunc("GET /ui/api/search", s.searchHandler)
+	mux.HandleFunc("POST /ui/api/play", s.playHandler)
+	mux.HandleFunc("GET /ui/api/events", s.eventsHandler)
+	mux.HandleFunc("GET /ui/api/subtitles/{hash}/{index}", s.subtitlesHandler)
+	return daemon.SameOrigin(mux)
+}
+
+// categories are the categories offered by the web UI, in order.
+var categories = []torgo.Category{
+	torgo.CategoryAll, torgo.CategoryMovie, torgo.CategoryTV, torgo.CategoryAnime,
+	torgo.CategoryAudiobook, torgo.CategoryDocumentaries, torgo.CategoryPorn,
+}
+
+func (s *server) providersHandler(w http.ResponseWriter, r *http.Request) {
+	type provider struct {
+		Name       string   `json:"name"`
+		Categories []string `json:"categories"`
+	}
+	providers := []provider{}
+	for _, p := range torgo.AllProviders {
+		entry := provider{Name: p.GetName(), Categories: []string{}}
+		for _, category := range categories {
+			if torgo.GetCategoryURL(category, p.GetCategories()) != "" {
+				entry.Categories = append(entry.Categories, string(category))
+			}
+		}
+		providers = append(providers, entry)
+	}
+	writeJSON(w, http.StatusOK, providers)
+}
+
+func (s *server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing query"))
+		return
+	}
+	category, sortBy := torgo.CategoryAll, torgo.SortBySeeders
+	var err error
+	if name := r.URL.Query().Get("category"); name != "" {
+		if category, err = torgo.ParseCategory(name); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if name := r.URL.Query().Get("sort"); name != "" {
+		if sortBy, err = torgo.ParseSortBy(name); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// Only the providers supporting the category are searched
+	var providers []interface{}
+	names := strings.Split(r.URL.Query().Get("providers"), ",")
+	for _, p := range torgo.AllProviders {
+		if torgo.GetCategoryURL(category, p.GetCategories()) == "" {
+			continue
+		}
+		if names[0] == "" || contains(names, p.GetName()) {
+			providers = append(providers, p)
+		}
+	}
+	if len(providers) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no provider supports the category"))
+		return
+	}
+
+	results := torgo.ListResults(providers, query, s.limit, category, sortBy)
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.searches[id] = results
+	delete(s.searches, id-maxSearches)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "results": results})
+}
+
+func (s *server) playHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Search int    `json:"search"`
+		Index  int    `json:"index"`
+		Magnet string `json:"magnet"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	magnet := body.Magnet
+	if magnet == "" {
+		s.mu.Lock()
+		results, ok := s.searches[body.Search]
+		s.mu.Unlock()
+		if !ok || body.Index < 0 || body.Index >= len(results) {
+			writeError(w, http.StatusNotFound, errors.New("result not found, search again"))
+			return
+		}
+		source := results[body.Index]
+		if err := source.ResolveMagnet(); err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		if source.Magnet == "" {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("no magnet found for %s", source.Title))
+			return
+		}
+		magnet = source.Magnet
+	}
+	status, err := s.d.AddMagnet(magnet)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// eventsHandler pushes the status of every torrent until the browser disconnects.
+func (s *server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ticker := time.NewTicker(eventInterval)
+	defer ticker.Stop()
+	for {
+		data, err := json.Marshal(s.d.List())
+		if err != nil {
+			logrus.Debugln(err)
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: torrents\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// subtitlesHandler serves a .srt or .vtt file of a torrent as WebVTT, the only format of the HTML5 <track>.
+func (s *server) subtitlesHandler(w http.ResponseWriter, r *http.Request) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	file, err := s.d.File(r.PathValue("hash"), index)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(file.Path()))
+	if ext != ".srt" && ext != ".vtt" {
+		writeError(w, http.StatusBadRequest, errors.New("not a subtitle file"))
+		return
+	}
+	reader, err := client.NewFileReader(file)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	if ext == ".vtt" {
+		_, _ = w.Write(data)
+		return
+	}
+	_, _ = io.WriteString(w, SRTToVTT(string(data)))
+}
+
+// SRTToVTT converts SubRip subtitles to WebVTT: a header is added and the milliseconds of the timings
+// are separated by a dot. The cue numbers are kept as cue identifiers.
+func SRTToVTT(srt string) string {
+	srt = strings.TrimPrefix(srt, "\ufeff")
+	srt = strings.ReplaceAll(srt, "\r\n", "\n")
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, line := range strings.Split(srt, "\n") {
+		if strings.Contains(line, "-->") {
+			line = strings.ReplaceAll(line, ",", ".")
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logrus.Debugln("Error writing the response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
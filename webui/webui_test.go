@@ -0,0 +1,28 @@
+package webui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stl3/torgo/daemon"
+)
+
+func TestPlayRejectsCrossSite(t *testing.T) {
+	handler := Handler(&daemon.Daemon{}, 10)
+	for _, headers := range []map[string]string{
+		{"Content-Type": "text/plain"},
+		{"Content-Type": "application/json", "Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "http://127.0.0.1:8790/ui/api/play", strings.NewReader(`{"magnet": "magnet:?xt=urn:btih:0"}`))
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnsupportedMediaType && w.Code != http.StatusForbidden {
+			t.Errorf("%v: status %d, want the request refused", headers, w.Code)
+		}
+	}
+}